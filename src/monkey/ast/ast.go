@@ -7,9 +7,17 @@ import (
    "monkey/token"
 )
 
+/*
+ * Nodes span the source from Pos() to End()
+ *    ~ End() is just after the last byte, e.g. the ")" of a call, the "}" of a block
+ *    ~ statements end with their expression, a following ";" is not part of them
+ *    ~ nodes built by hand (without positions) span the zero position
+ */
 type Node interface {
    TokenLiteral() string
    String() string
+   Pos() token.SourcePosition
+   End() token.SourcePosition
 }
 
 type Statement interface {
@@ -35,6 +43,20 @@ func (p *Program) TokenLiteral() string {
    }
 }
 
+func (p *Program) Pos() token.SourcePosition {
+   if len(p.Statements) > 0 {
+      return p.Statements[0].Pos()
+   }
+   return token.SourcePosition{}
+}
+
+func (p *Program) End() token.SourcePosition {
+   if len(p.Statements) > 0 {
+      return p.Statements[len(p.Statements) - 1].End()
+   }
+   return token.SourcePosition{}
+}
+
 func (p *Program) String() string {
    var out bytes.Buffer
 
@@ -65,6 +87,17 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.SourcePosition { return ls.Token.Position }
+
+func (ls *LetStatement) End() token.SourcePosition {
+   if ls.Value != nil {
+      return ls.Value.End()
+   }
+   if ls.Name != nil {
+      return ls.Name.End()
+   }
+   return ls.Token.End
+}
 
 func (ls *LetStatement) String() string {
    var out bytes.Buffer
@@ -86,6 +119,14 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.SourcePosition { return rs.Token.Position }
+
+func (rs *ReturnStatement) End() token.SourcePosition {
+   if rs.ReturnValue != nil {
+      return rs.ReturnValue.End()
+   }
+   return rs.Token.End
+}
 
 func (rs *ReturnStatement) String() string {
    var out bytes.Buffer
@@ -108,6 +149,20 @@ type ExpressionStatement struct {
 func (es *ExpressionStatement) statementNode() {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
 
+func (es *ExpressionStatement) Pos() token.SourcePosition {
+   if es.Expression != nil {
+      return es.Expression.Pos()
+   }
+   return es.Token.Position
+}
+
+func (es *ExpressionStatement) End() token.SourcePosition {
+   if es.Expression != nil {
+      return es.Expression.End()
+   }
+   return es.Token.End
+}
+
 func (es *ExpressionStatement) String() string {
    if es.Expression != nil {
       return es.Expression.String() 
@@ -119,10 +174,13 @@ func (es *ExpressionStatement) String() string {
 type BlockStatement struct {
    Token token.Token // "{" token
    Statements []Statement
+   Rbrace token.Token // "}" token
 }
 
 func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.SourcePosition { return bs.Token.Position }
+func (bs *BlockStatement) End() token.SourcePosition { return bs.Rbrace.End }
 func (bs *BlockStatement) String() string {
    var out bytes.Buffer
 
@@ -150,10 +208,25 @@ func (bs *BlockStatement) String() string {
 type Identifier struct {
    Token token.Token // token.IDENT
    Value string
+   Address *Address // lexical address (set by resolver), nil if not bound by let or parameter
+}
+
+/*
+ * Lexical address of a binding:
+ *    ~ Depth: number of frames to walk up the environment chain
+ *    ~ Slot: index of the binding within that frame
+ *    ~ Outer: the slot of the name in an enclosing frame, read while this slot is not (yet) bound
+ */
+type Address struct {
+   Depth int
+   Slot int
+   Outer *Address
 }
 
 func (id *Identifier) expressionNode() {}
 func (id *Identifier) TokenLiteral() string { return id.Token.Literal }
+func (id *Identifier) Pos() token.SourcePosition { return id.Token.Position }
+func (id *Identifier) End() token.SourcePosition { return id.Token.End }
 func (id *Identifier) String() string { return id.Value }
 
 // "[^"]*"
@@ -164,8 +237,22 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.SourcePosition { return sl.Token.Position }
+func (sl *StringLiteral) End() token.SourcePosition { return sl.Token.End }
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
 
+// /pattern/flags, Value is the pattern with flags as (?flags)
+type RegexLiteral struct {
+   Token token.Token
+   Value string
+}
+
+func (rl *RegexLiteral) expressionNode() {}
+func (rl *RegexLiteral) TokenLiteral() string { return rl.Token.Literal }
+func (rl *RegexLiteral) Pos() token.SourcePosition { return rl.Token.Position }
+func (rl *RegexLiteral) End() token.SourcePosition { return rl.Token.End }
+func (rl *RegexLiteral) String() string { return "/" + strings.Replace(rl.Value, "/", "\\/", -1) + "/" }
+
 // [0-9]+
 type IntegerLiteral struct {
    Token token.Token
@@ -174,6 +261,8 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.SourcePosition { return il.Token.Position }
+func (il *IntegerLiteral) End() token.SourcePosition { return il.Token.End }
 func (il *IntegerLiteral) String() string { return il.Token.Literal }
 
 // true|false
@@ -184,6 +273,8 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode() {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.SourcePosition { return b.Token.Position }
+func (b *Boolean) End() token.SourcePosition { return b.Token.End }
 func (b *Boolean) String() string { return b.Token.Literal }
 
 // <prefix-operator> <expression>
@@ -195,6 +286,15 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode() {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.SourcePosition { return pe.Token.Position }
+
+func (pe *PrefixExpression) End() token.SourcePosition {
+   if pe.Right != nil {
+      return pe.Right.End()
+   }
+   return pe.Token.End
+}
+
 func (pe *PrefixExpression) String() string {
    var out bytes.Buffer
 
@@ -216,6 +316,20 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode() {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.SourcePosition {
+   if ie.Left != nil {
+      return ie.Left.Pos()
+   }
+   return ie.Token.Position
+}
+
+func (ie *InfixExpression) End() token.SourcePosition {
+   if ie.Right != nil {
+      return ie.Right.End()
+   }
+   return ie.Token.End
+}
+
 func (ie *InfixExpression) String() string {
    var out bytes.Buffer
 
@@ -238,6 +352,18 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.SourcePosition { return ie.Token.Position }
+
+func (ie *IfExpression) End() token.SourcePosition {
+   if ie.Alternative != nil {
+      return ie.Alternative.End()
+   }
+   if ie.Consequence != nil {
+      return ie.Consequence.End()
+   }
+   return ie.Token.End
+}
+
 func (ie *IfExpression) String() string {
    var out bytes.Buffer
 
@@ -259,10 +385,20 @@ type FunctionLiteral struct {
    Token token.Token // "fn" token
    Parameters []*Identifier
    Body *BlockStatement
+   Locals []string // frame layout: name of each slot (set by resolver)
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.SourcePosition { return fl.Token.Position }
+
+func (fl *FunctionLiteral) End() token.SourcePosition {
+   if fl.Body != nil {
+      return fl.Body.End()
+   }
+   return fl.Token.End
+}
+
 func (fl *FunctionLiteral) String() string {
    var out bytes.Buffer
 
@@ -287,10 +423,19 @@ type CallExpression struct {
    Token token.Token // "(" token
    Function Expression
    Arguments []Expression
+   Rparen token.Token // ")" token
 }
 
 func (ce *CallExpression) expressionNode() {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.SourcePosition {
+   if ce.Function != nil {
+      return ce.Function.Pos()
+   }
+   return ce.Token.Position
+}
+
+func (ce *CallExpression) End() token.SourcePosition { return ce.Rparen.End }
 func (ce *CallExpression) String() string {
    var out bytes.Buffer
    
@@ -310,10 +455,13 @@ func (ce *CallExpression) String() string {
 type ArrayLiteral struct {
    Token token.Token // token.LBRACKET
    Elements []Expression
+   Rbracket token.Token // token.RBRACKET
 }
 
 func (al *ArrayLiteral) expressionNode() {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.SourcePosition { return al.Token.Position }
+func (al *ArrayLiteral) End() token.SourcePosition { return al.Rbracket.End }
 func (al *ArrayLiteral) String() string {
    var out bytes.Buffer
 
@@ -332,16 +480,20 @@ func (al *ArrayLiteral) String() string {
 type HashLiteral struct {
    Token token.Token // token.LBRACE
    Pairs map[Expression]Expression
+   Keys []Expression // keys in source order
+   Rbrace token.Token // token.RBRACE
 }
 
 func (hl *HashLiteral) expressionNode() {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.SourcePosition { return hl.Token.Position }
+func (hl *HashLiteral) End() token.SourcePosition { return hl.Rbrace.End }
 func (hl *HashLiteral) String() string {
    var out bytes.Buffer
 
    pairs := []string{}
-   for key, value := range hl.Pairs {
-      pairs = append(pairs, fmt.Sprintf("%s:%s", key.String(), value.String()))
+   for _, key := range hl.Keys {
+      pairs = append(pairs, fmt.Sprintf("%s:%s", key.String(), hl.Pairs[key].String()))
    }
 
    out.WriteString("{")
@@ -350,16 +502,24 @@ func (hl *HashLiteral) String() string {
    return out.String()
 }
 
-
 // <expression>[<expression>]
 type IndexExpression struct {
-   Token token.Token // token.IDENT
+   Token token.Token // token.LBRACKET
    Left Expression
    Index Expression
+   Rbracket token.Token // token.RBRACKET
 }
 
 func (ie *IndexExpression) expressionNode() {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.SourcePosition {
+   if ie.Left != nil {
+      return ie.Left.Pos()
+   }
+   return ie.Token.Position
+}
+
+func (ie *IndexExpression) End() token.SourcePosition { return ie.Rbracket.End }
 func (ie *IndexExpression) String() string {
    var out bytes.Buffer 
    out.WriteString("(")
@@ -27,3 +27,26 @@ func TestString(t *testing.T) {
       t.Errorf("prog.String() wrong. got=%q, want=%q", prog.String(), expected)
    }
 }
+
+func TestPositionsWithoutChildren(t *testing.T) {
+   nodes := []Node{
+      &PrefixExpression{},
+      &InfixExpression{},
+      &IfExpression{},
+      &FunctionLiteral{},
+      &CallExpression{},
+      &IndexExpression{},
+      &LetStatement{},
+      &ExpressionStatement{},
+      &ReturnStatement{},
+   }
+
+   for _, node := range nodes {
+      if pos := node.Pos(); pos != (token.SourcePosition{}) {
+         t.Errorf("%T: wrong Pos. got=%+v", node, pos)
+      }
+      if end := node.End(); end != (token.SourcePosition{}) {
+         t.Errorf("%T: wrong End. got=%+v", node, end)
+      }
+   }
+}
@@ -0,0 +1,363 @@
+package ast
+
+import (
+   "encoding/json"
+   "fmt"
+   "monkey/token"
+)
+
+/*
+ * JSON encoding of syntax trees: {"version": 1, "node": <node>}
+ *    ~ a node is {"kind": <node type, e.g. "InfixExpression">, "token": <token>, "pos": <position>,
+ *      "end": <position>, ...fields}, its children are nodes in named fields ("left", "right",
+ *      "statements", "pairs": [{"key", "value"}], ...), absent when nil
+ *    ~ a token is {"type", "literal", "pos", "end"}, a position {"line", "char", "offset"}
+ *    ~ "value" holds the value of literals and identifiers, "close" the closing token of
+ *      blocks, calls, arrays, hashes and index expressions
+ *    ~ "pos" and "end" of nodes are for readers, they are derived from tokens when decoding
+ *    ~ resolver results (addresses, frame layouts) are not encoded, decoded trees are resolved again
+ *    ~ the version changes when the schema does, older versions are rejected
+ */
+const JSONVersion = 1
+
+type jsonDocument struct {
+   Version int       `json:"version"`
+   Node    *jsonNode `json:"node"`
+}
+
+type jsonPosition struct {
+   Line   int `json:"line"`
+   Char   int `json:"char"`
+   Offset int `json:"offset"`
+}
+
+type jsonToken struct {
+   Type    string       `json:"type"`
+   Literal string       `json:"literal"`
+   Pos     jsonPosition `json:"pos"`
+   End     jsonPosition `json:"end"`
+}
+
+type jsonPair struct {
+   Key   *jsonNode `json:"key"`
+   Value *jsonNode `json:"value"`
+}
+
+type jsonNode struct {
+   Kind        string          `json:"kind"`
+   Token       *jsonToken      `json:"token,omitempty"`
+   Pos         *jsonPosition   `json:"pos,omitempty"`
+   End         *jsonPosition   `json:"end,omitempty"`
+   Value       json.RawMessage `json:"value,omitempty"`
+   Operator    string          `json:"operator,omitempty"`
+   Name        *jsonNode       `json:"name,omitempty"`
+   Expression  *jsonNode       `json:"expression,omitempty"` // also: value of lets, return value
+   Left        *jsonNode       `json:"left,omitempty"`
+   Right       *jsonNode       `json:"right,omitempty"`
+   Condition   *jsonNode       `json:"condition,omitempty"`
+   Consequence *jsonNode       `json:"consequence,omitempty"`
+   Alternative *jsonNode       `json:"alternative,omitempty"`
+   Function    *jsonNode       `json:"function,omitempty"`
+   Index       *jsonNode       `json:"index,omitempty"`
+   Body        *jsonNode       `json:"body,omitempty"`
+   Statements  []*jsonNode     `json:"statements,omitempty"`
+   Parameters  []*jsonNode     `json:"parameters,omitempty"`
+   Arguments   []*jsonNode     `json:"arguments,omitempty"`
+   Elements    []*jsonNode     `json:"elements,omitempty"`
+   Pairs       []jsonPair      `json:"pairs,omitempty"`
+   Close       *jsonToken      `json:"close,omitempty"`
+}
+
+func MarshalJSON(node Node) ([]byte, error) {
+   return json.Marshal(jsonDocument{Version: JSONVersion, Node: encode(node)})
+}
+
+func MarshalIndentJSON(node Node, indent string) ([]byte, error) {
+   return json.MarshalIndent(jsonDocument{Version: JSONVersion, Node: encode(node)}, "", indent)
+}
+
+func UnmarshalJSON(data []byte) (Node, error) {
+   var doc jsonDocument
+   if err := json.Unmarshal(data, &doc); err != nil {
+      return nil, err
+   }
+   if doc.Version != JSONVersion {
+      return nil, fmt.Errorf("unsupported AST version %d, want %d", doc.Version, JSONVersion)
+   }
+   if doc.Node == nil {
+      return nil, fmt.Errorf("no node")
+   }
+   return decode(doc.Node)
+}
+
+// Encoding
+
+func encodePosition(pos token.SourcePosition) jsonPosition {
+   return jsonPosition{Line: pos.Line, Char: pos.Char, Offset: pos.Offset}
+}
+
+func encodeToken(tok token.Token) *jsonToken {
+   return &jsonToken{Type: string(tok.Type), Literal: tok.Literal, Pos: encodePosition(tok.Position), End: encodePosition(tok.End)}
+}
+
+func encodeValue(v interface{}) json.RawMessage {
+   data, _ := json.Marshal(v) // strings, integers and booleans
+   return data
+}
+
+func encode(node Node) *jsonNode {
+   if isNil(node) {
+      return nil
+   }
+   pos, end := encodePosition(node.Pos()), encodePosition(node.End())
+   n := &jsonNode{Pos: &pos, End: &end}
+
+   switch node := node.(type) {
+      // Statements
+      case *Program:
+         n.Kind = "Program"
+         n.Statements = encodeStatements(node.Statements)
+      case *LetStatement:
+         n.Kind, n.Token = "LetStatement", encodeToken(node.Token)
+         n.Name = encode(node.Name)
+         n.Expression = encode(node.Value)
+      case *ReturnStatement:
+         n.Kind, n.Token = "ReturnStatement", encodeToken(node.Token)
+         n.Expression = encode(node.ReturnValue)
+      case *ExpressionStatement:
+         n.Kind, n.Token = "ExpressionStatement", encodeToken(node.Token)
+         n.Expression = encode(node.Expression)
+      case *BlockStatement:
+         n.Kind, n.Token, n.Close = "BlockStatement", encodeToken(node.Token), encodeToken(node.Rbrace)
+         n.Statements = encodeStatements(node.Statements)
+      // Expressions
+      case *Identifier:
+         n.Kind, n.Token, n.Value = "Identifier", encodeToken(node.Token), encodeValue(node.Value)
+      case *StringLiteral:
+         n.Kind, n.Token, n.Value = "StringLiteral", encodeToken(node.Token), encodeValue(node.Value)
+      case *RegexLiteral:
+         n.Kind, n.Token, n.Value = "RegexLiteral", encodeToken(node.Token), encodeValue(node.Value)
+      case *IntegerLiteral:
+         n.Kind, n.Token, n.Value = "IntegerLiteral", encodeToken(node.Token), encodeValue(node.Value)
+      case *Boolean:
+         n.Kind, n.Token, n.Value = "Boolean", encodeToken(node.Token), encodeValue(node.Value)
+      case *PrefixExpression:
+         n.Kind, n.Token, n.Operator = "PrefixExpression", encodeToken(node.Token), node.Operator
+         n.Right = encode(node.Right)
+      case *InfixExpression:
+         n.Kind, n.Token, n.Operator = "InfixExpression", encodeToken(node.Token), node.Operator
+         n.Left = encode(node.Left)
+         n.Right = encode(node.Right)
+      case *IfExpression:
+         n.Kind, n.Token = "IfExpression", encodeToken(node.Token)
+         n.Condition = encode(node.Condition)
+         n.Consequence = encode(node.Consequence)
+         n.Alternative = encode(node.Alternative)
+      case *FunctionLiteral:
+         n.Kind, n.Token = "FunctionLiteral", encodeToken(node.Token)
+         n.Parameters = []*jsonNode{}
+         for _, param := range node.Parameters {
+            n.Parameters = append(n.Parameters, encode(param))
+         }
+         n.Body = encode(node.Body)
+      case *CallExpression:
+         n.Kind, n.Token, n.Close = "CallExpression", encodeToken(node.Token), encodeToken(node.Rparen)
+         n.Function = encode(node.Function)
+         n.Arguments = encodeExpressions(node.Arguments)
+      case *ArrayLiteral:
+         n.Kind, n.Token, n.Close = "ArrayLiteral", encodeToken(node.Token), encodeToken(node.Rbracket)
+         n.Elements = encodeExpressions(node.Elements)
+      case *HashLiteral:
+         n.Kind, n.Token, n.Close = "HashLiteral", encodeToken(node.Token), encodeToken(node.Rbrace)
+         n.Pairs = []jsonPair{}
+         for _, key := range node.Keys {
+            n.Pairs = append(n.Pairs, jsonPair{Key: encode(key), Value: encode(node.Pairs[key])})
+         }
+      case *IndexExpression:
+         n.Kind, n.Token, n.Close = "IndexExpression", encodeToken(node.Token), encodeToken(node.Rbracket)
+         n.Left = encode(node.Left)
+         n.Index = encode(node.Index)
+      default:
+         n.Kind = fmt.Sprintf("%T", node) // rejected when decoding
+   }
+   return n
+}
+
+func encodeStatements(stmts []Statement) []*jsonNode {
+   nodes := []*jsonNode{}
+   for _, stmt := range stmts {
+      nodes = append(nodes, encode(stmt))
+   }
+   return nodes
+}
+
+func encodeExpressions(exps []Expression) []*jsonNode {
+   nodes := []*jsonNode{}
+   for _, exp := range exps {
+      nodes = append(nodes, encode(exp))
+   }
+   return nodes
+}
+
+// Decoding
+
+func decodePosition(pos jsonPosition) token.SourcePosition {
+   return token.SourcePosition{Line: pos.Line, Char: pos.Char, Offset: pos.Offset}
+}
+
+func decodeToken(tok *jsonToken) token.Token {
+   if tok == nil {
+      return token.Token{}
+   }
+   return token.Token{Type: token.TokenType(tok.Type), Literal: tok.Literal, Position: decodePosition(tok.Pos), End: decodePosition(tok.End)}
+}
+
+func decode(n *jsonNode) (Node, error) {
+   var err error
+   // children, the first error is kept
+   required := func(field string, child *jsonNode) *jsonNode {
+      if child == nil && err == nil {
+         err = fmt.Errorf("%s: missing %s", n.Kind, field)
+      }
+      return child
+   }
+   expression := func(n *jsonNode) Expression {
+      if n == nil || err != nil {
+         return nil
+      }
+      node, e := decode(n)
+      if e != nil {
+         err = e
+         return nil
+      }
+      exp, ok := node.(Expression)
+      if !ok {
+         err = fmt.Errorf("%s is not an expression", n.Kind)
+      }
+      return exp
+   }
+   identifier := func(n *jsonNode) *Identifier {
+      id, ok := expression(n).(*Identifier)
+      if !ok && n != nil && err == nil {
+         err = fmt.Errorf("%s is not an identifier", n.Kind)
+      }
+      return id
+   }
+   block := func(n *jsonNode) *BlockStatement {
+      if n == nil || err != nil {
+         return nil
+      }
+      node, e := decode(n)
+      if e != nil {
+         err = e
+         return nil
+      }
+      b, ok := node.(*BlockStatement)
+      if !ok {
+         err = fmt.Errorf("%s is not a block", n.Kind)
+      }
+      return b
+   }
+   statements := func(nodes []*jsonNode) []Statement {
+      stmts := []Statement{}
+      for _, n := range nodes {
+         if required("statement", n) == nil || err != nil {
+            break
+         }
+         node, e := decode(n)
+         if e != nil {
+            err = e
+            break
+         }
+         stmt, ok := node.(Statement)
+         if !ok {
+            err = fmt.Errorf("%s is not a statement", n.Kind)
+            break
+         }
+         stmts = append(stmts, stmt)
+      }
+      return stmts
+   }
+   expressions := func(nodes []*jsonNode) []Expression {
+      exps := []Expression{}
+      for _, n := range nodes {
+         exps = append(exps, expression(required("element", n)))
+      }
+      return exps
+   }
+   value := func(v interface{}) {
+      if e := json.Unmarshal(n.Value, v); e != nil && err == nil {
+         err = fmt.Errorf("%s: bad value: %s", n.Kind, e)
+      }
+   }
+
+   tok := decodeToken(n.Token)
+   var node Node
+   switch n.Kind {
+      // Statements
+      case "Program":
+         node = &Program{Statements: statements(n.Statements)}
+      case "LetStatement":
+         node = &LetStatement{Token: tok, Name: identifier(required("name", n.Name)), Value: expression(required("expression", n.Expression))}
+      case "ReturnStatement":
+         node = &ReturnStatement{Token: tok, ReturnValue: expression(required("expression", n.Expression))}
+      case "ExpressionStatement":
+         node = &ExpressionStatement{Token: tok, Expression: expression(required("expression", n.Expression))}
+      case "BlockStatement":
+         node = &BlockStatement{Token: tok, Statements: statements(n.Statements), Rbrace: decodeToken(n.Close)}
+      // Expressions
+      case "Identifier":
+         id := &Identifier{Token: tok}
+         value(&id.Value)
+         node = id
+      case "StringLiteral":
+         sl := &StringLiteral{Token: tok}
+         value(&sl.Value)
+         node = sl
+      case "RegexLiteral":
+         rl := &RegexLiteral{Token: tok}
+         value(&rl.Value)
+         node = rl
+      case "IntegerLiteral":
+         il := &IntegerLiteral{Token: tok}
+         value(&il.Value)
+         node = il
+      case "Boolean":
+         b := &Boolean{Token: tok}
+         value(&b.Value)
+         node = b
+      case "PrefixExpression":
+         node = &PrefixExpression{Token: tok, Operator: n.Operator, Right: expression(required("right", n.Right))}
+      case "InfixExpression":
+         node = &InfixExpression{Token: tok, Operator: n.Operator, Left: expression(required("left", n.Left)), Right: expression(required("right", n.Right))}
+      case "IfExpression":
+         node = &IfExpression{Token: tok, Condition: expression(required("condition", n.Condition)), Consequence: block(required("consequence", n.Consequence)), Alternative: block(n.Alternative)}
+      case "FunctionLiteral":
+         fl := &FunctionLiteral{Token: tok, Parameters: []*Identifier{}}
+         for _, param := range n.Parameters {
+            fl.Parameters = append(fl.Parameters, identifier(required("parameter", param)))
+         }
+         fl.Body = block(required("body", n.Body))
+         node = fl
+      case "CallExpression":
+         node = &CallExpression{Token: tok, Function: expression(required("function", n.Function)), Arguments: expressions(n.Arguments), Rparen: decodeToken(n.Close)}
+      case "ArrayLiteral":
+         node = &ArrayLiteral{Token: tok, Elements: expressions(n.Elements), Rbracket: decodeToken(n.Close)}
+      case "HashLiteral":
+         hl := &HashLiteral{Token: tok, Pairs: make(map[Expression]Expression), Keys: []Expression{}, Rbrace: decodeToken(n.Close)}
+         for _, pair := range n.Pairs {
+            key := expression(required("key", pair.Key))
+            hl.Pairs[key] = expression(required("value", pair.Value))
+            hl.Keys = append(hl.Keys, key)
+         }
+         node = hl
+      case "IndexExpression":
+         node = &IndexExpression{Token: tok, Left: expression(required("left", n.Left)), Index: expression(required("index", n.Index)), Rbracket: decodeToken(n.Close)}
+      default:
+         return nil, fmt.Errorf("unknown node kind %q", n.Kind)
+   }
+   if err != nil {
+      return nil, err
+   }
+   return node, nil
+}
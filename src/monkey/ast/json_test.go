@@ -0,0 +1,62 @@
+package ast
+
+import (
+   "strings"
+   "testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+   program := sampleProgram()
+   data, err := MarshalJSON(program)
+   if err != nil {
+      t.Fatal(err)
+   }
+   if !strings.HasPrefix(string(data), `{"version":1,"node":{"kind":"Program"`) {
+      t.Errorf("wrong document. got=%s", data)
+   }
+
+   decoded, err := UnmarshalJSON(data)
+   if err != nil {
+      t.Fatal(err)
+   }
+   if decoded.String() != program.String() {
+      t.Errorf("wrong program decoded. want=%q, got=%q", program.String(), decoded.String())
+   }
+   again, _ := MarshalJSON(decoded)
+   if string(again) != string(data) {
+      t.Errorf("encoding not stable.\nfirst= %s\nsecond=%s", data, again)
+   }
+}
+
+func TestJSONErrors(t *testing.T) {
+   tests := []struct {
+      input    string
+      expected string
+   }{
+      {`{"version":2,"node":{"kind":"Program"}}`, "unsupported AST version 2, want 1"},
+      {`{"version":1}`, "no node"},
+      {`{"version":1,"node":{"kind":"WhileLoop"}}`, `unknown node kind "WhileLoop"`},
+      {`{"version":1,"node":{"kind":"Program","statements":[{"kind":"Identifier","value":"x"}]}}`, "Identifier is not a statement"},
+      {`{"version":1,"node":{"kind":"LetStatement","name":{"kind":"IntegerLiteral","value":1}}}`, "IntegerLiteral is not an identifier"},
+      {`{"version":1,"node":{"kind":"IntegerLiteral","value":"one"}}`, "IntegerLiteral: bad value"},
+      {`{"version":1,"node":{"kind":"InfixExpression","operator":"+"}}`, "InfixExpression: missing left"},
+      {`{"version":1,"node":{"kind":"PrefixExpression","operator":"-"}}`, "PrefixExpression: missing right"},
+      {`{"version":1,"node":{"kind":"FunctionLiteral"}}`, "FunctionLiteral: missing body"},
+      {`{"version":1,"node":{"kind":"FunctionLiteral","parameters":[null]}}`, "FunctionLiteral: missing parameter"},
+      {`{"version":1,"node":{"kind":"LetStatement"}}`, "LetStatement: missing name"},
+      {`{"version":1,"node":{"kind":"ReturnStatement"}}`, "ReturnStatement: missing expression"},
+      {`{"version":1,"node":{"kind":"IfExpression","condition":{"kind":"Boolean","value":true}}}`, "IfExpression: missing consequence"},
+      {`{"version":1,"node":{"kind":"CallExpression"}}`, "CallExpression: missing function"},
+      {`{"version":1,"node":{"kind":"ArrayLiteral","elements":[null]}}`, "ArrayLiteral: missing element"},
+      {`{"version":1,"node":{"kind":"IndexExpression","left":{"kind":"Identifier","value":"a"}}}`, "IndexExpression: missing index"},
+      {`{"version":1,"node":{"kind":"HashLiteral","pairs":[{"key":{"kind":"IntegerLiteral","value":1}}]}}`, "HashLiteral: missing value"},
+      {`{"version":1,"node":{"kind":"Program","statements":[null]}}`, "Program: missing statement"},
+   }
+
+   for _, tt := range tests {
+      _, err := UnmarshalJSON([]byte(tt.input))
+      if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+         t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+      }
+   }
+}
@@ -0,0 +1,102 @@
+package ast
+
+type ModifierFunc func(Node) Node
+
+/*
+ * Rewriting: Modify replaces each node by modifier(node), children first (post-order)
+ *    ~ parents are rebuilt in place with their modified children, the result of modifier
+ *      on the root is returned
+ *    ~ a modified child must still fit its field, e.g. an Identifier for let names and parameters,
+ *      a BlockStatement for bodies, otherwise the field is left unchanged
+ *    ~ hash literals get new Pairs and Keys, keys keep their source order
+ */
+func Modify(node Node, modifier ModifierFunc) Node {
+   switch node := node.(type) {
+      // Statements
+      case *Program:
+         modifyStatements(node.Statements, modifier)
+      case *LetStatement:
+         if id, ok := modifyIf(node.Name, modifier).(*Identifier); ok {
+            node.Name = id
+         }
+         node.Value = modifyExpression(node.Value, modifier)
+      case *ReturnStatement:
+         node.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+      case *ExpressionStatement:
+         node.Expression = modifyExpression(node.Expression, modifier)
+      case *BlockStatement:
+         modifyStatements(node.Statements, modifier)
+      // Expressions
+      case *PrefixExpression:
+         node.Right = modifyExpression(node.Right, modifier)
+      case *InfixExpression:
+         node.Left = modifyExpression(node.Left, modifier)
+         node.Right = modifyExpression(node.Right, modifier)
+      case *IfExpression:
+         node.Condition = modifyExpression(node.Condition, modifier)
+         node.Consequence = modifyBlock(node.Consequence, modifier)
+         node.Alternative = modifyBlock(node.Alternative, modifier)
+      case *FunctionLiteral:
+         for i, param := range node.Parameters {
+            if id, ok := modifyIf(param, modifier).(*Identifier); ok {
+               node.Parameters[i] = id
+            }
+         }
+         node.Body = modifyBlock(node.Body, modifier)
+      case *CallExpression:
+         node.Function = modifyExpression(node.Function, modifier)
+         modifyExpressions(node.Arguments, modifier)
+      case *ArrayLiteral:
+         modifyExpressions(node.Elements, modifier)
+      case *HashLiteral:
+         pairs := make(map[Expression]Expression, len(node.Pairs))
+         keys := make([]Expression, 0, len(node.Keys))
+         for _, key := range node.Keys {
+            value := node.Pairs[key]
+            key = modifyExpression(key, modifier)
+            pairs[key] = modifyExpression(value, modifier)
+            keys = append(keys, key)
+         }
+         node.Pairs, node.Keys = pairs, keys
+      case *IndexExpression:
+         node.Left = modifyExpression(node.Left, modifier)
+         node.Index = modifyExpression(node.Index, modifier)
+   }
+
+   return modifier(node)
+}
+
+func modifyIf(node Node, modifier ModifierFunc) Node {
+   if isNil(node) {
+      return node
+   }
+   return Modify(node, modifier)
+}
+
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+   if modified, ok := modifyIf(exp, modifier).(Expression); ok {
+      return modified
+   }
+   return exp
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+   if modified, ok := modifyIf(block, modifier).(*BlockStatement); ok {
+      return modified
+   }
+   return block
+}
+
+func modifyStatements(stmts []Statement, modifier ModifierFunc) {
+   for i, stmt := range stmts {
+      if modified, ok := modifyIf(stmt, modifier).(Statement); ok {
+         stmts[i] = modified
+      }
+   }
+}
+
+func modifyExpressions(exps []Expression, modifier ModifierFunc) {
+   for i, exp := range exps {
+      exps[i] = modifyExpression(exp, modifier)
+   }
+}
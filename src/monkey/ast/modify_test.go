@@ -0,0 +1,135 @@
+package ast
+
+import (
+   "strings"
+   "testing"
+)
+
+func TestModify(t *testing.T) {
+   one := func() Expression { return integer(1) }
+   two := func() Expression { return integer(2) }
+   turnOneIntoTwo := func(node Node) Node {
+      if il, ok := node.(*IntegerLiteral); ok && il.Value == 1 {
+         return integer(2)
+      }
+      return node
+   }
+
+   tests := []struct {
+      input    Node
+      expected Node
+   }{
+      {one(), two()},
+      {&Program{Statements: []Statement{expStmt(one())}}, &Program{Statements: []Statement{expStmt(two())}}},
+      {&InfixExpression{Left: one(), Operator: "+", Right: two()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+      {&PrefixExpression{Operator: "-", Right: one()}, &PrefixExpression{Operator: "-", Right: two()}},
+      {&IndexExpression{Left: one(), Index: one()}, &IndexExpression{Left: two(), Index: two()}},
+      {
+         &IfExpression{Condition: one(), Consequence: block(expStmt(one())), Alternative: block(expStmt(one()))},
+         &IfExpression{Condition: two(), Consequence: block(expStmt(two())), Alternative: block(expStmt(two()))},
+      },
+      {&IfExpression{Condition: one(), Consequence: block()}, &IfExpression{Condition: two(), Consequence: block()}},
+      {&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+      {&LetStatement{Name: ident("x"), Value: one()}, &LetStatement{Name: ident("x"), Value: two()}},
+      {
+         &FunctionLiteral{Parameters: []*Identifier{}, Body: block(expStmt(one()))},
+         &FunctionLiteral{Parameters: []*Identifier{}, Body: block(expStmt(two()))},
+      },
+      {&CallExpression{Function: ident("f"), Arguments: []Expression{one(), one()}}, &CallExpression{Function: ident("f"), Arguments: []Expression{two(), two()}}},
+      {&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+   }
+
+   for _, tt := range tests {
+      modified := Modify(tt.input, turnOneIntoTwo)
+      if modified.String() != tt.expected.String() {
+         t.Errorf("not modified. want=%s, got=%s", tt.expected.String(), modified.String())
+      }
+   }
+}
+
+func TestModifyHashLiteral(t *testing.T) {
+   hash := &HashLiteral{Pairs: map[Expression]Expression{}}
+   for _, k := range []int64{3, 1, 2} {
+      key := integer(k)
+      hash.Pairs[key] = integer(k * 10)
+      hash.Keys = append(hash.Keys, key)
+   }
+
+   // new nodes for keys and values, the hash must be rebuilt with them
+   double := func(node Node) Node {
+      if il, ok := node.(*IntegerLiteral); ok {
+         return integer(il.Value * 2)
+      }
+      return node
+   }
+   modified := Modify(hash, double).(*HashLiteral)
+
+   if len(modified.Pairs) != 3 || len(modified.Keys) != 3 {
+      t.Fatalf("wrong number of pairs. got=%d, keys=%d", len(modified.Pairs), len(modified.Keys))
+   }
+   for i, want := range []int64{6, 2, 4} {
+      key := modified.Keys[i].(*IntegerLiteral)
+      if key.Value != want {
+         t.Errorf("key %d wrong. want=%d, got=%d", i, want, key.Value)
+      }
+      value, ok := modified.Pairs[key].(*IntegerLiteral)
+      if !ok || value.Value != want * 10 {
+         t.Errorf("value of %d wrong. want=%d, got=%v", want, want * 10, modified.Pairs[key])
+      }
+   }
+}
+
+func TestModifyRebuildsParents(t *testing.T) {
+   program := sampleProgram()
+   rename := func(node Node) Node { // x -> y everywhere, binding and uses
+      if id, ok := node.(*Identifier); ok && id.Value == "x" {
+         return ident("y")
+      }
+      return node
+   }
+   modified := Modify(program, rename)
+
+   expected := "let f = fn(y) { if (y) { ({1:y}[1]) }else { [y, (-2)] } }; f(3)"
+   if modified != program || modified.String() != expected {
+      t.Errorf("parents not rebuilt. want=%q, got=%q", expected, modified.String())
+   }
+   fl := program.Statements[0].(*LetStatement).Value.(*FunctionLiteral)
+   if fl.Parameters[0].Value != "y" {
+      t.Errorf("parameter not replaced. got=%q", fl.Parameters[0].Value)
+   }
+
+   // a node that does not fit its field leaves it unchanged
+   Modify(program, func(node Node) Node {
+      if _, ok := node.(*BlockStatement); ok {
+         return integer(0)
+      }
+      return node
+   })
+   if fl.Body == nil || len(fl.Body.Statements) != 1 {
+      t.Errorf("body replaced by a node of the wrong type. got=%v", fl.Body)
+   }
+}
+
+func TestModifyOrder(t *testing.T) {
+   id := func(name string) *Identifier { return &Identifier{Value: name} }
+   a, b, c, d := id("a"), id("b"), id("c"), id("d")
+   hash := &HashLiteral{Keys: []Expression{a, c}, Pairs: map[Expression]Expression{a: b, c: d}}
+
+   walked := []string{}
+   Inspect(hash, func(node Node) bool {
+      if id, ok := node.(*Identifier); ok {
+         walked = append(walked, id.Value)
+      }
+      return true
+   })
+   modified := []string{}
+   Modify(hash, func(node Node) Node {
+      if id, ok := node.(*Identifier); ok {
+         modified = append(modified, id.Value)
+      }
+      return node
+   })
+   if strings.Join(walked, " ") != "a b c d" || strings.Join(modified, " ") != strings.Join(walked, " ") {
+      t.Errorf("wrong order. Inspect=%v, Modify=%v", walked, modified)
+   }
+}
@@ -0,0 +1,117 @@
+package ast
+
+import (
+   "bytes"
+   "fmt"
+   "strconv"
+   "strings"
+)
+
+/*
+ * Tree views of a syntax tree, each node shown as its type, operator or value, and position,
+ * e.g. InfixExpression + @1:9
+ *    ~ Tree: indented ASCII tree, children prefixed with their field, e.g. "left: "
+ *    ~ SExpr: S-expression, (InfixExpression + @1:9 (IntegerLiteral 1 @1:9) (IntegerLiteral 2 @1:13))
+ *    ~ Dot: Graphviz DOT digraph, edges labelled with the field of the child
+ */
+func Tree(node Node) string {
+   var out bytes.Buffer
+   out.WriteString(label(node) + "\n")
+   tree(&out, node, "")
+   return out.String()
+}
+
+func tree(out *bytes.Buffer, node Node, indent string) {
+   cs := children(node)
+   for i, c := range cs {
+      branch, next := "|-- ", "|   "
+      if i == len(cs) - 1 {
+         branch, next = "`-- ", "    "
+      }
+      out.WriteString(indent + branch + c.label + ": " + label(c.node) + "\n")
+      tree(out, c.node, indent + next)
+   }
+}
+
+func SExpr(node Node) string {
+   var out bytes.Buffer
+   sexpr(&out, node)
+   return out.String()
+}
+
+func sexpr(out *bytes.Buffer, node Node) {
+   out.WriteString("(" + label(node))
+   for _, c := range children(node) {
+      out.WriteString(" ")
+      sexpr(out, c.node)
+   }
+   out.WriteString(")")
+}
+
+func Dot(node Node) string {
+   var out bytes.Buffer
+   out.WriteString("digraph AST {\n")
+   out.WriteString("   node [shape=box, fontname=\"monospace\"];\n")
+   next := 0
+   var dot func(node Node) int
+   dot = func(node Node) int {
+      id := next
+      next += 1
+      text := describe(node)
+      if pos := position(node); pos != "" {
+         text += "\n" + pos
+      }
+      fmt.Fprintf(&out, "   n%d [label=%s];\n", id, dotString(text))
+      for _, c := range children(node) {
+         childID := dot(c.node)
+         fmt.Fprintf(&out, "   n%d -> n%d [label=%s];\n", id, childID, dotString(c.label))
+      }
+      return id
+   }
+   dot(node)
+   out.WriteString("}\n")
+   return out.String()
+}
+
+// a quoted DOT string, newlines as \n
+func dotString(s string) string {
+   r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+   return `"` + r.Replace(s) + `"`
+}
+
+// type, operator or value, and position of a node, e.g. Identifier x @1:5
+func label(node Node) string {
+   if pos := position(node); pos != "" {
+      return describe(node) + " " + pos
+   }
+   return describe(node)
+}
+
+// "@line:char", empty for nodes without position
+func position(node Node) string {
+   if pos := node.Pos(); pos.Line > 0 {
+      return fmt.Sprintf("@%d:%d", pos.Line, pos.Char)
+   }
+   return ""
+}
+
+func describe(node Node) string {
+   parts := []string{strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")}
+   switch node := node.(type) {
+      case *Identifier:
+         parts = append(parts, node.Value)
+      case *IntegerLiteral:
+         parts = append(parts, node.String())
+      case *Boolean:
+         parts = append(parts, node.String())
+      case *StringLiteral:
+         parts = append(parts, strconv.Quote(node.Value))
+      case *RegexLiteral:
+         parts = append(parts, node.String())
+      case *PrefixExpression:
+         parts = append(parts, node.Operator)
+      case *InfixExpression:
+         parts = append(parts, node.Operator)
+   }
+   return strings.Join(parts, " ")
+}
@@ -0,0 +1,73 @@
+package ast
+
+import (
+   "testing"
+   "monkey/token"
+)
+
+// 1 + 2 * x, as parsed from the first line
+func sampleExpression() Node {
+   at := func(tt token.TokenType, literal string, char int) token.Token {
+      pos := token.SourcePosition{Line: 1, Char: char, Offset: char - 1}
+      end := token.SourcePosition{Line: 1, Char: char + len(literal), Offset: char - 1 + len(literal)}
+      return token.Token{Type: tt, Literal: literal, Position: pos, End: end}
+   }
+   product := &InfixExpression{
+      Token: at(token.ASTERISK, "*", 7),
+      Operator: "*",
+      Left: &IntegerLiteral{Token: at(token.INT, "2", 5), Value: 2},
+      Right: &Identifier{Token: at(token.IDENT, "x", 9), Value: "x"},
+   }
+   return &InfixExpression{
+      Token: at(token.PLUS, "+", 3),
+      Operator: "+",
+      Left: &IntegerLiteral{Token: at(token.INT, "1", 1), Value: 1},
+      Right: product,
+   }
+}
+
+func TestTree(t *testing.T) {
+   expected := "InfixExpression + @1:1\n" +
+      "|-- left: IntegerLiteral 1 @1:1\n" +
+      "`-- right: InfixExpression * @1:5\n" +
+      "    |-- left: IntegerLiteral 2 @1:5\n" +
+      "    `-- right: Identifier x @1:9\n"
+   if got := Tree(sampleExpression()); got != expected {
+      t.Errorf("wrong tree.\ngot=\n%s\nwant=\n%s", got, expected)
+   }
+}
+
+func TestSExpr(t *testing.T) {
+   expected := "(InfixExpression + @1:1 (IntegerLiteral 1 @1:1) (InfixExpression * @1:5 (IntegerLiteral 2 @1:5) (Identifier x @1:9)))"
+   if got := SExpr(sampleExpression()); got != expected {
+      t.Errorf("wrong S-expression.\ngot= %s\nwant=%s", got, expected)
+   }
+
+   // nodes without positions, string values quoted
+   hash := &HashLiteral{Pairs: map[Expression]Expression{}}
+   key := &StringLiteral{Value: `a "b"`}
+   hash.Pairs[key], hash.Keys = &Boolean{Token: token.Token{Literal: "true"}, Value: true}, []Expression{key}
+   expected = `(HashLiteral (StringLiteral "a \"b\"") (Boolean true))`
+   if got := SExpr(hash); got != expected {
+      t.Errorf("wrong S-expression.\ngot= %s\nwant=%s", got, expected)
+   }
+}
+
+func TestDot(t *testing.T) {
+   expected := `digraph AST {
+   node [shape=box, fontname="monospace"];
+   n0 [label="InfixExpression +\n@1:1"];
+   n1 [label="IntegerLiteral 1\n@1:1"];
+   n0 -> n1 [label="left"];
+   n2 [label="InfixExpression *\n@1:5"];
+   n3 [label="IntegerLiteral 2\n@1:5"];
+   n2 -> n3 [label="left"];
+   n4 [label="Identifier x\n@1:9"];
+   n2 -> n4 [label="right"];
+   n0 -> n2 [label="right"];
+}
+`
+   if got := Dot(sampleExpression()); got != expected {
+      t.Errorf("wrong DOT graph.\ngot=\n%s\nwant=\n%s", got, expected)
+   }
+}
@@ -0,0 +1,120 @@
+package ast
+
+/*
+ * Traversal: Walk visits a node and its children depth-first, children in source order
+ *    ~ v.Visit(node) is called first, the children are walked with the visitor it returns,
+ *      none if that is nil
+ *    ~ after the children, v.Visit(nil) is called with the returned visitor (end of node)
+ *    ~ children: statements of programs and blocks, names and values of lets, parameters and body
+ *      of function literals, condition, consequence and alternative of ifs, keys and values of
+ *      hash literals (key, value, in source order), operands, functions and arguments of calls
+ */
+type Visitor interface {
+   Visit(node Node) (w Visitor)
+}
+
+func Walk(v Visitor, node Node) {
+   if v = v.Visit(node); v == nil {
+      return
+   }
+   for _, c := range children(node) {
+      Walk(v, c.node)
+   }
+   v.Visit(nil)
+}
+
+// a child node and the name of its field, e.g. "left", "key"
+type child struct {
+   label string
+   node  Node
+}
+
+// children of a node in source order, without nil ones
+func children(node Node) []child {
+   var cs []child
+   add := func(label string, node Node) {
+      if !isNil(node) {
+         cs = append(cs, child{label, node})
+      }
+   }
+
+   switch node := node.(type) {
+      // Statements
+      case *Program:
+         for _, stmt := range node.Statements {
+            add("statement", stmt)
+         }
+      case *LetStatement:
+         add("name", node.Name)
+         add("value", node.Value)
+      case *ReturnStatement:
+         add("value", node.ReturnValue)
+      case *ExpressionStatement:
+         add("expression", node.Expression)
+      case *BlockStatement:
+         for _, stmt := range node.Statements {
+            add("statement", stmt)
+         }
+      // Expressions
+      case *PrefixExpression:
+         add("right", node.Right)
+      case *InfixExpression:
+         add("left", node.Left)
+         add("right", node.Right)
+      case *IfExpression:
+         add("condition", node.Condition)
+         add("consequence", node.Consequence)
+         add("alternative", node.Alternative)
+      case *FunctionLiteral:
+         for _, param := range node.Parameters {
+            add("parameter", param)
+         }
+         add("body", node.Body)
+      case *CallExpression:
+         add("function", node.Function)
+         for _, arg := range node.Arguments {
+            add("argument", arg)
+         }
+      case *ArrayLiteral:
+         for _, el := range node.Elements {
+            add("element", el)
+         }
+      case *HashLiteral:
+         for _, key := range node.Keys {
+            add("key", key)
+            add("value", node.Pairs[key])
+         }
+      case *IndexExpression:
+         add("left", node.Left)
+         add("index", node.Index)
+      // Identifiers and literals have no children
+   }
+   return cs
+}
+
+func isNil(node Node) bool {
+   switch node := node.(type) {
+      case nil:
+         return true
+      case *Identifier:
+         return node == nil
+      case *BlockStatement:
+         return node == nil
+      default:
+         return false
+   }
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+   if f(node) {
+      return f
+   }
+   return nil
+}
+
+// walks node, calling f for each node (and with nil after its children), children are skipped if f returns false
+func Inspect(node Node, f func(Node) bool) {
+   Walk(inspector(f), node)
+}
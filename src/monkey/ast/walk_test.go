@@ -0,0 +1,95 @@
+package ast
+
+import (
+   "fmt"
+   "strings"
+   "testing"
+   "monkey/token"
+)
+
+func ident(name string) *Identifier { return &Identifier{Value: name} }
+
+func integer(value int64) *IntegerLiteral {
+   return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: fmt.Sprint(value)}, Value: value}
+}
+
+func block(stmts ...Statement) *BlockStatement { return &BlockStatement{Statements: stmts} }
+
+func expStmt(exp Expression) *ExpressionStatement { return &ExpressionStatement{Expression: exp} }
+
+// let f = fn(x) { if (x) { {1: x}[1] } else { [x, -2] } }; f(3)
+func sampleProgram() *Program {
+   key, value := integer(1), ident("x")
+   hash := &HashLiteral{Pairs: map[Expression]Expression{key: value}, Keys: []Expression{key}}
+   ifExp := &IfExpression{
+      Condition: ident("x"),
+      Consequence: block(expStmt(&IndexExpression{Left: hash, Index: integer(1)})),
+      Alternative: block(expStmt(&ArrayLiteral{Elements: []Expression{ident("x"), &PrefixExpression{Operator: "-", Right: integer(2)}}})),
+   }
+   fl := &FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "fn"}, Parameters: []*Identifier{ident("x")}, Body: block(expStmt(ifExp))}
+   return &Program{Statements: []Statement{
+      &LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: ident("f"), Value: fl},
+      expStmt(&CallExpression{Function: ident("f"), Arguments: []Expression{integer(3)}}),
+   }}
+}
+
+func TestInspect(t *testing.T) {
+   var visited []string
+   Inspect(sampleProgram(), func(node Node) bool {
+      if node != nil {
+         visited = append(visited, describe(node))
+      }
+      return true
+   })
+
+   expected := []string{
+      "Program", "LetStatement", "Identifier f", "FunctionLiteral", "Identifier x", "BlockStatement",
+      "ExpressionStatement", "IfExpression", "Identifier x",
+      "BlockStatement", "ExpressionStatement", "IndexExpression", "HashLiteral", "IntegerLiteral 1", "Identifier x", "IntegerLiteral 1",
+      "BlockStatement", "ExpressionStatement", "ArrayLiteral", "Identifier x", "PrefixExpression -", "IntegerLiteral 2",
+      "ExpressionStatement", "CallExpression", "Identifier f", "IntegerLiteral 3",
+   }
+   if strings.Join(visited, ", ") != strings.Join(expected, ", ") {
+      t.Errorf("wrong nodes visited.\ngot= %v\nwant=%v", visited, expected)
+   }
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+   count := 0
+   Inspect(sampleProgram(), func(node Node) bool {
+      if node != nil {
+         count += 1
+      }
+      _, isFunction := node.(*FunctionLiteral)
+      return !isFunction
+   })
+   if count != 8 { // Program, LetStatement, f, FunctionLiteral, ExpressionStatement, CallExpression, f, 3
+      t.Errorf("wrong number of nodes visited. want=%d, got=%d", 8, count)
+   }
+}
+
+type depthVisitor struct {
+   depth, max *int
+}
+
+func (v depthVisitor) Visit(node Node) Visitor {
+   if node == nil {
+      *v.depth -= 1
+      return nil
+   }
+   *v.depth += 1
+   *v.max = max(*v.max, *v.depth)
+   return v
+}
+
+func TestWalkEndOfNode(t *testing.T) {
+   depth, maxDepth := 0, 0
+   Walk(depthVisitor{&depth, &maxDepth}, sampleProgram())
+   if depth != 0 {
+      t.Errorf("Visit(nil) not called once per node. depth=%d", depth)
+   }
+   // Program, Let, FunctionLiteral, Block, ExpressionStatement, If, Block, ExpressionStatement, Array, Prefix, Integer
+   if maxDepth != 11 {
+      t.Errorf("wrong maximum depth. want=11, got=%d", maxDepth)
+   }
+}
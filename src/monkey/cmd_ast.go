@@ -0,0 +1,65 @@
+package main
+
+import (
+   "flag"
+   "fmt"
+   "io"
+   "io/ioutil"
+   "monkey/ast"
+)
+
+var astFormats = map[string]func(ast.Node) string{
+   "tree": ast.Tree,
+   "sexpr": func(node ast.Node) string { return ast.SExpr(node) + "\n" },
+   "dot": ast.Dot,
+}
+
+/*
+ * monkey ast [-format=tree|sexpr|dot] [files...]
+ *    ~ prints the syntax tree of each file (standard input without files)
+ *    ~ tree: indented ASCII tree (default), sexpr: S-expression, dot: Graphviz graph (monkey ast -format=dot f.mo | dot -Tsvg)
+ *    ~ exits with 1 if a file does not parse
+ */
+func runAST(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+   flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+   flags.SetOutput(stderr)
+   format := flags.String("format", "tree", "output format: tree, sexpr or dot")
+   if err := flags.Parse(args); err != nil {
+      return 2
+   }
+   render, ok := astFormats[*format]
+   if !ok {
+      fmt.Fprintf(stderr, "ast: unknown format %q, want tree, sexpr or dot\n", *format)
+      return 2
+   }
+
+   if flags.NArg() == 0 {
+      src, err := ioutil.ReadAll(stdin)
+      if err != nil {
+         fmt.Fprintf(stderr, "ast: %s\n", err)
+         return 2
+      }
+      return astFile("<standard input>", src, render, stdout, stderr)
+   }
+
+   status := 0
+   for _, filename := range flags.Args() {
+      src, err := ioutil.ReadFile(filename)
+      if err != nil {
+         fmt.Fprintf(stderr, "ast: %s\n", err)
+         status = 2
+         continue
+      }
+      status = max(status, astFile(filename, src, render, stdout, stderr))
+   }
+   return status
+}
+
+func astFile(filename string, src []byte, render func(ast.Node) string, stdout, stderr io.Writer) int {
+   program := parseSource(filename, src, stderr)
+   if program == nil {
+      return 1
+   }
+   io.WriteString(stdout, render(program))
+   return 0
+}
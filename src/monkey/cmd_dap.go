@@ -0,0 +1,22 @@
+package main
+
+import (
+   "fmt"
+   "io"
+   "monkey/dap"
+)
+
+/*
+ * monkey dap: debug adapter on standard input and output, started by editors
+ */
+func runDAP(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+   if len(args) > 0 {
+      fmt.Fprintf(stderr, "usage: monkey dap\n")
+      return 2
+   }
+   if err := dap.Serve(stdin, stdout); err != nil {
+      fmt.Fprintf(stderr, "dap: %s\n", err)
+      return 1
+   }
+   return 0
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+   "fmt"
+   "io"
+   "monkey/debug"
+)
+
+/*
+ * monkey debug <file>: step debugger on standard input/output (see debug.Start)
+ *    ~ the program stops before its first statement, "help" lists the commands
+ *    ~ output of puts goes to standard output, interleaved with the debugger's
+ *    ~ exits with 1 if the file does not parse or resolve, or the program ends with an error
+ */
+func runDebug(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+   if len(args) != 1 {
+      fmt.Fprintf(stderr, "usage: monkey debug <file>\n")
+      return 2
+   }
+   filename := args[0]
+   s, status := loadProgram("debug", filename, stdout, stderr)
+   if s == nil {
+      return status
+   }
+   defer s.close()
+   return debug.Start(filename, s.source, s.program, stdin, stdout, s.options...)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+   "bytes"
+   "flag"
+   "fmt"
+   "io"
+   "io/ioutil"
+   "strings"
+   "monkey/format"
+)
+
+/*
+ * monkey fmt [-w] [-d] [files...]
+ *    ~ prints the formatted files, or standard input without files
+ *    ~ -w rewrites files whose formatting differs, -d prints a diff instead of the formatted source
+ */
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+   flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+   flags.SetOutput(stderr)
+   write := flags.Bool("w", false, "write result to the source file instead of standard output")
+   diff := flags.Bool("d", false, "display diffs instead of rewriting files")
+   if err := flags.Parse(args); err != nil {
+      return 2
+   }
+
+   if flags.NArg() == 0 {
+      if *write {
+         fmt.Fprintf(stderr, "fmt: cannot use -w with standard input\n")
+         return 2
+      }
+      src, err := ioutil.ReadAll(stdin)
+      if err != nil {
+         fmt.Fprintf(stderr, "fmt: %s\n", err)
+         return 2
+      }
+      return formatFile("<standard input>", src, false, *diff, stdout, stderr)
+   }
+
+   status := 0
+   for _, filename := range flags.Args() {
+      src, err := ioutil.ReadFile(filename)
+      if err != nil {
+         fmt.Fprintf(stderr, "fmt: %s\n", err)
+         status = 2
+         continue
+      }
+      status = max(status, formatFile(filename, src, *write, *diff, stdout, stderr))
+   }
+   return status
+}
+
+func formatFile(filename string, src []byte, write, diff bool, stdout, stderr io.Writer) int {
+   formatted, err := format.Source(src)
+   if err != nil {
+      printErrors(stderr, filename, err)
+      return 1
+   }
+   if diff {
+      io.WriteString(stdout, unifiedDiff(filename, string(src), string(formatted)))
+   }
+   if write && !bytes.Equal(src, formatted) {
+      if err := ioutil.WriteFile(filename, formatted, 0644); err != nil {
+         fmt.Fprintf(stderr, "fmt: %s\n", err)
+         return 2
+      }
+   }
+   if !write && !diff {
+      stdout.Write(formatted)
+   }
+   return 0
+}
+
+// parse errors, one "line:char: message" per line, as "file:line:char: message"
+func printErrors(w io.Writer, filename string, err error) {
+   for _, msg := range strings.Split(err.Error(), "\n") {
+      fmt.Fprintf(w, "%s:%s\n", filename, msg)
+   }
+}
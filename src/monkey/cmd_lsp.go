@@ -0,0 +1,22 @@
+package main
+
+import (
+   "fmt"
+   "io"
+   "monkey/lsp"
+)
+
+/*
+ * monkey lsp: language server on standard input and output, started by editors
+ */
+func runLSP(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+   if len(args) > 0 {
+      fmt.Fprintf(stderr, "usage: monkey lsp\n")
+      return 2
+   }
+   if err := lsp.Serve(stdin, stdout); err != nil {
+      fmt.Fprintf(stderr, "lsp: %s\n", err)
+      return 1
+   }
+   return 0
+}
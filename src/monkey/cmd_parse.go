@@ -0,0 +1,84 @@
+package main
+
+import (
+   "errors"
+   "flag"
+   "fmt"
+   "io"
+   "io/ioutil"
+   "strings"
+   "monkey/ast"
+   "monkey/lexer"
+   "monkey/parser"
+)
+
+/*
+ * monkey parse [-json] [-trace] [files...]
+ *    ~ prints the parsed program of each file (standard input without files), fully parenthesised
+ *    ~ -json prints the syntax tree as a versioned JSON document instead (see ast.MarshalJSON)
+ *    ~ -trace writes the BEGIN/END events of the parsing functions to standard error
+ *    ~ exits with 1 if a file does not parse
+ */
+func runParse(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+   flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+   flags.SetOutput(stderr)
+   asJSON := flags.Bool("json", false, "print the syntax tree as JSON")
+   trace := flags.Bool("trace", false, "trace the parsing functions to standard error")
+   if err := flags.Parse(args); err != nil {
+      return 2
+   }
+   var options []parser.Option
+   if *trace {
+      options = append(options, parser.WithTracer(stderr))
+   }
+
+   if flags.NArg() == 0 {
+      src, err := ioutil.ReadAll(stdin)
+      if err != nil {
+         fmt.Fprintf(stderr, "parse: %s\n", err)
+         return 2
+      }
+      return parseFile("<standard input>", src, *asJSON, options, stdout, stderr)
+   }
+
+   status := 0
+   for _, filename := range flags.Args() {
+      src, err := ioutil.ReadFile(filename)
+      if err != nil {
+         fmt.Fprintf(stderr, "parse: %s\n", err)
+         status = 2
+         continue
+      }
+      status = max(status, parseFile(filename, src, *asJSON, options, stdout, stderr))
+   }
+   return status
+}
+
+// the program in src, nil if it does not parse (errors are printed)
+func parseSource(filename string, src []byte, stderr io.Writer, options ...parser.Option) *ast.Program {
+   p := parser.New(lexer.New(string(src)), options...)
+   program := p.ParseProgram()
+   if len(p.Errors()) != 0 {
+      printErrors(stderr, filename, errors.New(strings.Join(p.Errors(), "\n")))
+      return nil
+   }
+   return program
+}
+
+func parseFile(filename string, src []byte, asJSON bool, options []parser.Option, stdout, stderr io.Writer) int {
+   program := parseSource(filename, src, stderr, options...)
+   if program == nil {
+      return 1
+   }
+   if !asJSON {
+      fmt.Fprintln(stdout, program.String())
+      return 0
+   }
+   data, err := ast.MarshalIndentJSON(program, "  ")
+   if err != nil {
+      fmt.Fprintf(stderr, "parse: %s: %s\n", filename, err)
+      return 2
+   }
+   fmt.Fprintf(stdout, "%s\n", data)
+   return 0
+}
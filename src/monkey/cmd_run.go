@@ -0,0 +1,121 @@
+package main
+
+import (
+   "flag"
+   "fmt"
+   "io"
+   "io/ioutil"
+   "os"
+   "monkey/ast"
+   "monkey/evaluator"
+   "monkey/object"
+   "monkey/profile"
+)
+
+/*
+ * monkey run [-profile file] [-top n] <file>
+ *    ~ evaluates a program, output of puts goes to standard output
+ *    ~ -profile writes a profile of the Monkey code in pprof format (see profile.Profiler),
+ *      e.g. for go tool pprof -http=: file, and prints the top n functions to standard error
+ *    ~ exits with 1 if the file does not parse or resolve, or the program ends with an error
+ */
+func runRun(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+   flags := flag.NewFlagSet("run", flag.ContinueOnError)
+   flags.SetOutput(stderr)
+   profileFile := flags.String("profile", "", "write a pprof profile to `file`")
+   top := flags.Int("top", 10, "number of functions in the profile summary")
+   if err := flags.Parse(args); err != nil {
+      return 2
+   }
+   if flags.NArg() != 1 {
+      fmt.Fprintf(stderr, "usage: monkey run [-profile file] [-top n] <file>\n")
+      return 2
+   }
+   filename := flags.Arg(0)
+   s, status := loadProgram("run", filename, stdout, stderr)
+   if s == nil {
+      return status
+   }
+   defer s.close()
+
+   options := s.options
+   var profiler *profile.Profiler
+   if *profileFile != "" {
+      profiler = profile.New(filename)
+      options = append(options, evaluator.WithHooks(profiler))
+   }
+   result := evaluator.New(options...).Eval(s.program, object.NewEnvironment())
+
+   if result != nil && result.Type() == object.ERROR_OBJ {
+      fmt.Fprintf(stderr, "%s: %s\n", filename, result.Inspect())
+      status = 1
+   }
+   if profiler != nil {
+      profiler.Stop()
+      if err := writeProfile(*profileFile, profiler); err != nil {
+         fmt.Fprintf(stderr, "run: %s\n", err)
+         return 2
+      }
+      profiler.WriteTop(stderr, *top)
+   }
+   return status
+}
+
+/*
+ * script: a program loaded by run or debug
+ *    ~ options: puts writes to the command's stdout, files are read from the working directory
+ *    ~ close releases the working directory
+ */
+type script struct {
+   source  string
+   program *ast.Program
+   options []evaluator.Option
+   fsys    evaluator.FileSystem // nil if the working directory cannot be opened
+}
+
+// reads, parses and resolves filename, prints the problems to stderr and returns nil
+// with the status to exit with if there are any
+func loadProgram(command, filename string, stdout, stderr io.Writer) (*script, int) {
+   src, err := ioutil.ReadFile(filename)
+   if err != nil {
+      fmt.Fprintf(stderr, "%s: %s\n", command, err)
+      return nil, 2
+   }
+   program := parseSource(filename, src, stderr)
+   if program == nil {
+      return nil, 1
+   }
+   resolver := evaluator.NewResolver()
+   resolver.Resolve(program)
+   if len(resolver.Errors()) != 0 {
+      for _, msg := range resolver.Errors() {
+         fmt.Fprintf(stderr, "%s: %s\n", filename, msg)
+      }
+      return nil, 1
+   }
+
+   s := &script{source: string(src), program: program, options: []evaluator.Option{evaluator.WithOutput(stdout)}}
+   if fsys, err := evaluator.DirFS("."); err == nil { // scripts see the working directory
+      s.fsys = fsys
+      s.options = append(s.options, evaluator.WithFileSystem(fsys))
+   }
+   return s, 0
+}
+
+func (s *script) close() {
+   if s.fsys != nil {
+      s.fsys.Close()
+   }
+}
+
+func writeProfile(filename string, profiler *profile.Profiler) error {
+   f, err := os.Create(filename)
+   if err != nil {
+      return err
+   }
+   if err := profiler.WritePprof(f); err != nil {
+      f.Close()
+      return err
+   }
+   return f.Close()
+}
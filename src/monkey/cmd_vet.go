@@ -0,0 +1,58 @@
+package main
+
+import (
+   "flag"
+   "fmt"
+   "io"
+   "io/ioutil"
+   "monkey/lint"
+)
+
+/*
+ * monkey vet [files...] (also: monkey lint)
+ *    ~ prints "file:line:char: message (check)" for each diagnostic, checks standard input without files
+ *    ~ exits with 1 if a file has diagnostics or does not parse
+ */
+func runVet(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+   flags := flag.NewFlagSet("vet", flag.ContinueOnError)
+   flags.SetOutput(stderr)
+   if err := flags.Parse(args); err != nil {
+      return 2
+   }
+
+   if flags.NArg() == 0 {
+      src, err := ioutil.ReadAll(stdin)
+      if err != nil {
+         fmt.Fprintf(stderr, "vet: %s\n", err)
+         return 2
+      }
+      return vetFile("<standard input>", src, stdout, stderr)
+   }
+
+   status := 0
+   for _, filename := range flags.Args() {
+      src, err := ioutil.ReadFile(filename)
+      if err != nil {
+         fmt.Fprintf(stderr, "vet: %s\n", err)
+         status = 2
+         continue
+      }
+      status = max(status, vetFile(filename, src, stdout, stderr))
+   }
+   return status
+}
+
+func vetFile(filename string, src []byte, stdout, stderr io.Writer) int {
+   diagnostics, err := lint.Source(src)
+   if err != nil {
+      printErrors(stderr, filename, err)
+      return 1
+   }
+   for _, d := range diagnostics {
+      fmt.Fprintf(stdout, "%s:%s\n", filename, d)
+   }
+   if len(diagnostics) > 0 {
+      return 1
+   }
+   return 0
+}
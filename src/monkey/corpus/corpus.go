@@ -0,0 +1,31 @@
+package corpus
+
+import (
+   "go/ast"
+   "go/parser"
+   "go/token"
+   "strconv"
+)
+
+/*
+ * Test corpus: the Monkey programs embedded in Go test files
+ *    ~ StringLiterals returns every string literal of a Go file, programs and expected
+ *      values alike, callers keep the ones that parse (e.g. without errors, with statements)
+ *    ~ shared by tests of several packages (format, parser), so it is no _test file
+ */
+func StringLiterals(filename string) ([]string, error) {
+   file, err := parser.ParseFile(token.NewFileSet(), filename, nil, 0)
+   if err != nil {
+      return nil, err
+   }
+   var literals []string
+   ast.Inspect(file, func(node ast.Node) bool {
+      if lit, ok := node.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+         if value, err := strconv.Unquote(lit.Value); err == nil {
+            literals = append(literals, value)
+         }
+      }
+      return true
+   })
+   return literals, nil
+}
@@ -0,0 +1,343 @@
+package dap
+
+import (
+   "bufio"
+   "encoding/json"
+   "fmt"
+   "io"
+   "monkey/framing"
+   "os"
+   "path/filepath"
+   "reflect"
+   "testing"
+   "time"
+)
+
+const program = `let double = fn(x) {
+   let y = x * 2;
+   y
+};
+let h = {"a": [1, 2]};
+let a = double(3);
+let b = double(a);
+puts(a + b);
+`
+
+// scripted client: sends requests to a server running on a goroutine, reads its responses and events
+type client struct {
+   t        *testing.T
+   in       *io.PipeWriter
+   messages chan message
+   events   []message // read, not yet waited for
+   seq      int
+   served   chan error
+}
+
+func start(t *testing.T) *client {
+   t.Helper()
+   inR, inW := io.Pipe()
+   outR, outW := io.Pipe()
+   c := &client{t: t, in: inW, messages: make(chan message), served: make(chan error, 1)}
+   go func() {
+      c.served <- Serve(inR, outW)
+      outW.Close()
+   }()
+   go func() {
+      r := bufio.NewReader(outR)
+      for {
+         content, err := framing.Read(r)
+         if err != nil {
+            close(c.messages)
+            return
+         }
+         var msg message
+         if err := json.Unmarshal(content, &msg); err != nil {
+            t.Errorf("bad message %s: %s", content, err)
+         }
+         c.messages <- msg
+      }
+   }()
+   return c
+}
+
+func (c *client) next() message {
+   c.t.Helper()
+   select {
+      case msg, ok := <-c.messages:
+         if !ok {
+            c.t.Fatalf("server output ended")
+         }
+         return msg
+      case <-time.After(5 * time.Second):
+         c.t.Fatalf("timed out waiting for the server")
+   }
+   return message{}
+}
+
+// sends a request and returns its response, events read meanwhile are kept
+func (c *client) request(command string, args interface{}) message {
+   c.t.Helper()
+   c.seq += 1
+   data, _ := json.Marshal(args)
+   content, _ := json.Marshal(&message{Seq: c.seq, Type: "request", Command: command, Arguments: data})
+   fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(content), content)
+   for {
+      msg := c.next()
+      if msg.Type == "response" && msg.RequestSeq == c.seq {
+         if msg.Command != command {
+            c.t.Errorf("wrong response command. want=%q, got=%q", command, msg.Command)
+         }
+         return msg
+      }
+      c.events = append(c.events, msg)
+   }
+}
+
+// a request expected to succeed, its body decoded into body (if not nil)
+func (c *client) call(command string, args interface{}, body interface{}) {
+   c.t.Helper()
+   response := c.request(command, args)
+   if !response.Success {
+      c.t.Fatalf("%s failed: %s", command, response.Message)
+   }
+   if body != nil {
+      if err := json.Unmarshal(response.Body, body); err != nil {
+         c.t.Fatalf("%s: bad body %s: %s", command, response.Body, err)
+      }
+   }
+}
+
+// waits for an event, decoding its body into body (if not nil)
+func (c *client) event(name string, body interface{}) {
+   c.t.Helper()
+   for {
+      var msg message
+      if len(c.events) > 0 {
+         msg, c.events = c.events[0], c.events[1:]
+      } else {
+         msg = c.next()
+      }
+      if msg.Type == "event" && msg.Event == name {
+         if body != nil {
+            if err := json.Unmarshal(msg.Body, body); err != nil {
+               c.t.Fatalf("%s: bad body %s: %s", name, msg.Body, err)
+            }
+         }
+         return
+      }
+   }
+}
+
+func (c *client) disconnect() {
+   c.t.Helper()
+   c.call("disconnect", nil, nil)
+   c.in.Close()
+   if err := <-c.served; err != nil {
+      c.t.Errorf("Serve failed: %s", err)
+   }
+}
+
+// initializes a session and launches the program in a temporary file, returns its path
+func launch(t *testing.T, c *client, stopOnEntry bool) string {
+   t.Helper()
+   path := filepath.Join(t.TempDir(), "double.mo")
+   if err := os.WriteFile(path, []byte(program), 0644); err != nil {
+      t.Fatal(err)
+   }
+   var capabilities Capabilities
+   c.call("initialize", map[string]string{"adapterID": "monkey"}, &capabilities)
+   if !capabilities.SupportsConditionalBreakpoints || !capabilities.SupportsConfigurationDoneRequest {
+      t.Errorf("missing capabilities: %+v", capabilities)
+   }
+   c.event("initialized", nil)
+   c.call("launch", LaunchArguments{Program: path, StopOnEntry: stopOnEntry}, nil)
+   return path
+}
+
+type variablesBody struct {
+   Variables []Variable `json:"variables"`
+}
+
+func TestSession(t *testing.T) {
+   c := start(t)
+   path := launch(t, c, false)
+
+   var breakpoints struct {
+      Breakpoints []Breakpoint `json:"breakpoints"`
+   }
+   c.call("setBreakpoints", SetBreakpointsArguments{
+      Source: Source{Path: path},
+      Breakpoints: []SourceBreakpoint{{Line: 3, Condition: "x > 3"}, {Line: 4}},
+   }, &breakpoints)
+   expectedBreakpoints := []Breakpoint{{Verified: true, Line: 3}, {Verified: false, Line: 4, Message: "no statement on this line"}}
+   if !reflect.DeepEqual(breakpoints.Breakpoints, expectedBreakpoints) {
+      t.Errorf("wrong breakpoints. want=%+v, got=%+v", expectedBreakpoints, breakpoints.Breakpoints)
+   }
+   c.call("configurationDone", nil, nil)
+
+   var stopped StoppedEvent
+   c.event("stopped", &stopped)
+   if stopped != (StoppedEvent{Reason: "breakpoint", ThreadID: threadID, AllThreadsStopped: true}) {
+      t.Errorf("wrong stopped event: %+v", stopped)
+   }
+
+   var threads struct {
+      Threads []Thread `json:"threads"`
+   }
+   c.call("threads", nil, &threads)
+   if len(threads.Threads) != 1 || threads.Threads[0].ID != threadID {
+      t.Errorf("wrong threads: %+v", threads.Threads)
+   }
+
+   var stack struct {
+      StackFrames []StackFrame `json:"stackFrames"`
+      TotalFrames int          `json:"totalFrames"`
+   }
+   c.call("stackTrace", map[string]int{"threadId": threadID}, &stack)
+   source := &Source{Name: "double.mo", Path: path}
+   expectedFrames := []StackFrame{
+      {ID: 1, Name: "double", Source: source, Line: 3, Column: 4},
+      {ID: 2, Name: "<program>", Source: source, Line: 7, Column: 9},
+   }
+   if !reflect.DeepEqual(stack.StackFrames, expectedFrames) || stack.TotalFrames != 2 {
+      t.Errorf("wrong stack. want=%+v, got=%+v", expectedFrames, stack.StackFrames)
+   }
+
+   var scopes struct {
+      Scopes []Scope `json:"scopes"`
+   }
+   c.call("scopes", map[string]int{"frameId": 1}, &scopes)
+   if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "Locals" || scopes.Scopes[1].Name != "Globals" {
+      t.Fatalf("wrong scopes: %+v", scopes.Scopes)
+   }
+   var locals variablesBody
+   c.call("variables", map[string]int{"variablesReference": scopes.Scopes[0].VariablesReference}, &locals)
+   expectedLocals := []Variable{{Name: "x", Value: "6", Type: "INTEGER"}, {Name: "y", Value: "12", Type: "INTEGER"}}
+   if !reflect.DeepEqual(locals.Variables, expectedLocals) {
+      t.Errorf("wrong locals. want=%+v, got=%+v", expectedLocals, locals.Variables)
+   }
+
+   var result struct {
+      Result             string `json:"result"`
+      VariablesReference int    `json:"variablesReference"`
+   }
+   c.call("evaluate", EvaluateArguments{Expression: "y + x", FrameID: 1}, &result)
+   if result.Result != "18" {
+      t.Errorf("wrong result. want=18, got=%q", result.Result)
+   }
+   if response := c.request("evaluate", EvaluateArguments{Expression: "z", FrameID: 1}); response.Success {
+      t.Errorf("evaluating an unknown identifier succeeded")
+   }
+
+   c.call("stepOut", map[string]int{"threadId": threadID}, nil)
+   c.event("stopped", &stopped)
+   c.call("stackTrace", map[string]int{"threadId": threadID}, &stack)
+   if stopped.Reason != "step" || len(stack.StackFrames) != 1 || stack.StackFrames[0].Line != 8 {
+      t.Errorf("wrong stop after stepOut: %+v at %+v", stopped, stack.StackFrames)
+   }
+
+   // hashes and arrays expand
+   c.call("evaluate", EvaluateArguments{Expression: "h"}, &result)
+   var hash, array variablesBody
+   c.call("variables", map[string]int{"variablesReference": result.VariablesReference}, &hash)
+   if len(hash.Variables) != 1 || hash.Variables[0].Name != "a" || hash.Variables[0].Value != "[1, 2]" {
+      t.Fatalf("wrong hash variables: %+v", hash.Variables)
+   }
+   c.call("variables", map[string]int{"variablesReference": hash.Variables[0].VariablesReference}, &array)
+   expectedArray := []Variable{{Name: "0", Value: "1", Type: "INTEGER"}, {Name: "1", Value: "2", Type: "INTEGER"}}
+   if !reflect.DeepEqual(array.Variables, expectedArray) {
+      t.Errorf("wrong array variables. want=%+v, got=%+v", expectedArray, array.Variables)
+   }
+
+   c.call("continue", map[string]int{"threadId": threadID}, nil)
+   var output OutputEvent
+   c.event("output", &output)
+   if output != (OutputEvent{Category: "stdout", Output: "18\n"}) {
+      t.Errorf("wrong output: %+v", output)
+   }
+   var exited ExitedEvent
+   c.event("exited", &exited)
+   if exited.ExitCode != 0 {
+      t.Errorf("wrong exit code. want=0, got=%d", exited.ExitCode)
+   }
+   c.event("terminated", nil)
+   if response := c.request("stackTrace", map[string]int{"threadId": threadID}); response.Success {
+      t.Errorf("stackTrace succeeded after the program ended")
+   }
+   c.disconnect()
+}
+
+func TestStepping(t *testing.T) {
+   c := start(t)
+   launch(t, c, true)
+   c.call("configurationDone", nil, nil)
+
+   var stopped StoppedEvent
+   var stack struct {
+      StackFrames []StackFrame `json:"stackFrames"`
+   }
+   expected := []struct {
+      command string
+      reason  string
+      line    int
+      frames  int
+   }{
+      {"", "entry", 1, 1},
+      {"next", "step", 5, 1},
+      {"next", "step", 6, 1},
+      {"stepIn", "step", 2, 2},
+      {"next", "step", 3, 2},
+      {"stepOut", "step", 7, 1},
+   }
+   for _, tt := range expected {
+      if tt.command != "" {
+         c.call(tt.command, map[string]int{"threadId": threadID}, nil)
+      }
+      c.event("stopped", &stopped)
+      c.call("stackTrace", map[string]int{"threadId": threadID}, &stack)
+      if stopped.Reason != tt.reason || stack.StackFrames[0].Line != tt.line || len(stack.StackFrames) != tt.frames {
+         t.Errorf("%s: wrong stop. want=%s at line %d (%d frames), got=%s at line %d (%d frames)",
+            tt.command, tt.reason, tt.line, tt.frames, stopped.Reason, stack.StackFrames[0].Line, len(stack.StackFrames))
+      }
+   }
+
+   // terminated while stopped
+   c.call("terminate", nil, nil)
+   var exited ExitedEvent
+   c.event("exited", &exited)
+   if exited.ExitCode != 1 {
+      t.Errorf("wrong exit code. want=1, got=%d", exited.ExitCode)
+   }
+   c.event("terminated", nil)
+   c.disconnect()
+}
+
+func TestErrors(t *testing.T) {
+   c := start(t)
+   c.call("initialize", nil, nil)
+
+   tests := []struct {
+      command string
+      args    interface{}
+      message string
+   }{
+      {"launch", LaunchArguments{Program: "/nonexistent/x.mo"}, "open /nonexistent/x.mo: no such file or directory"},
+      {"stackTrace", map[string]int{"threadId": threadID}, "the program is not stopped"},
+      {"continue", map[string]int{"threadId": threadID}, "the program is not stopped"},
+      {"evaluate", EvaluateArguments{Expression: "1"}, "the program is not stopped"},
+      {"restart", nil, "unknown command: restart"},
+   }
+   for _, tt := range tests {
+      response := c.request(tt.command, tt.args)
+      if response.Success || response.Message != tt.message {
+         t.Errorf("%s: wrong response. want message %q, got success=%t, message=%q", tt.command, tt.message, response.Success, response.Message)
+      }
+   }
+
+   path := filepath.Join(t.TempDir(), "bad.mo")
+   os.WriteFile(path, []byte("let = 1;"), 0644)
+   if response := c.request("launch", LaunchArguments{Program: path}); response.Success {
+      t.Errorf("launching a program with syntax errors succeeded")
+   }
+   c.disconnect()
+}
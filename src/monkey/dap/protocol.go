@@ -0,0 +1,115 @@
+package dap
+
+import (
+   "encoding/json"
+   "io"
+   "monkey/framing"
+)
+
+/*
+ * Protocol: the parts of the Debug Adapter Protocol used by the server
+ *    ~ https://microsoft.github.io/debug-adapter-protocol/specification
+ *    ~ messages are requests (client), responses and events (server), numbered by seq
+ *    ~ lines and columns are 1-based, as in token.SourcePosition
+ *    ~ framed like the Language Server Protocol (see framing.Read)
+ */
+type message struct {
+   Seq        int             `json:"seq"`
+   Type       string          `json:"type"` // "request", "response" or "event"
+   Command    string          `json:"command,omitempty"`
+   Arguments  json.RawMessage `json:"arguments,omitempty"`
+   RequestSeq int             `json:"request_seq,omitempty"`
+   Success    bool            `json:"success,omitempty"`
+   Message    string          `json:"message,omitempty"`
+   Event      string          `json:"event,omitempty"`
+   Body       json.RawMessage `json:"body,omitempty"`
+}
+
+type Capabilities struct {
+   SupportsConfigurationDoneRequest bool `json:"supportsConfigurationDoneRequest"`
+   SupportsConditionalBreakpoints   bool `json:"supportsConditionalBreakpoints"`
+   SupportsEvaluateForHovers        bool `json:"supportsEvaluateForHovers"`
+   SupportsTerminateRequest         bool `json:"supportsTerminateRequest"`
+}
+
+type LaunchArguments struct {
+   Program     string `json:"program"`
+   StopOnEntry bool   `json:"stopOnEntry"`
+}
+
+type Source struct {
+   Name string `json:"name,omitempty"`
+   Path string `json:"path,omitempty"`
+}
+
+type SourceBreakpoint struct {
+   Line      int    `json:"line"`
+   Condition string `json:"condition,omitempty"`
+}
+
+type SetBreakpointsArguments struct {
+   Source      Source             `json:"source"`
+   Breakpoints []SourceBreakpoint `json:"breakpoints"`
+}
+
+type Breakpoint struct {
+   Verified bool   `json:"verified"`
+   Line     int    `json:"line,omitempty"`
+   Message  string `json:"message,omitempty"`
+}
+
+type Thread struct {
+   ID   int    `json:"id"`
+   Name string `json:"name"`
+}
+
+type StackFrame struct {
+   ID     int     `json:"id"`
+   Name   string  `json:"name"`
+   Source *Source `json:"source,omitempty"`
+   Line   int     `json:"line"`
+   Column int     `json:"column"`
+}
+
+type Scope struct {
+   Name               string `json:"name"`
+   VariablesReference int    `json:"variablesReference"`
+   Expensive          bool   `json:"expensive"`
+}
+
+type Variable struct {
+   Name               string `json:"name"`
+   Value              string `json:"value"`
+   Type               string `json:"type,omitempty"`
+   VariablesReference int    `json:"variablesReference"`
+}
+
+type EvaluateArguments struct {
+   Expression string `json:"expression"`
+   FrameID    int    `json:"frameId"`
+   Context    string `json:"context,omitempty"`
+}
+
+type StoppedEvent struct {
+   Reason            string `json:"reason"`
+   ThreadID          int    `json:"threadId"`
+   AllThreadsStopped bool   `json:"allThreadsStopped"`
+}
+
+type OutputEvent struct {
+   Category string `json:"category"` // "stdout" or "stderr"
+   Output   string `json:"output"`
+}
+
+type ExitedEvent struct {
+   ExitCode int `json:"exitCode"`
+}
+
+// a message in the base protocol (see framing.Read)
+func writeMessage(w io.Writer, msg *message) error {
+   content, err := json.Marshal(msg)
+   if err != nil {
+      return err
+   }
+   return framing.Write(w, content)
+}
@@ -0,0 +1,378 @@
+package dap
+
+import (
+   "bufio"
+   "encoding/json"
+   "errors"
+   "fmt"
+   "io"
+   "io/ioutil"
+   "path/filepath"
+   "strings"
+   "sync"
+   "monkey/ast"
+   "monkey/debug"
+   "monkey/evaluator"
+   "monkey/framing"
+   "monkey/lexer"
+   "monkey/object"
+   "monkey/parser"
+)
+
+const threadID = 1 // programs run on a single thread
+
+/*
+ * Server: a debug adapter for Monkey programs over a pair of streams (stdin/stdout for editors)
+ *    ~ requests are handled one at a time, in order, on the goroutine of Serve
+ *    ~ the program runs on a goroutine of its own once it was launched and configured
+ *      (configurationDone), output of puts is sent as "output" events
+ *    ~ while the program is stopped, its goroutine waits in onStop for a continue, next, stepIn or
+ *      stepOut request, stackTrace, scopes, variables and evaluate inspect it meanwhile
+ *    ~ Serve returns after a "disconnect" request (the error is nil), or when the input ends
+ */
+type Server struct {
+   out     io.Writer
+   writeMu sync.Mutex // guards out and seq, the program goroutine writes events
+   seq     int
+
+   debugger    *debug.Debugger
+   path        string // of the launched program, absolute
+   program     *ast.Program
+   stopOnEntry bool
+   configured  bool
+   breakpoints map[string][]SourceBreakpoint // by absolute path, set before or after launch
+   done        chan struct{}                 // closed when the program ended, nil before it started
+   after       func()                        // run after the response to the current request
+
+   mu          sync.Mutex // guards the fields below, set by the program goroutine
+   stop        *debug.Stop
+   refs        []interface{} // variablesReference - 1: *object.Environment, *object.Array or *object.Hash
+   terminating bool
+   resume      chan func()
+}
+
+type handler func(s *Server, args json.RawMessage) (interface{}, error)
+
+// requests by command
+var handlers = map[string]handler{
+   "initialize": (*Server).initialize,
+   "launch": (*Server).launch,
+   "setBreakpoints": (*Server).setBreakpoints,
+   "setExceptionBreakpoints": func(s *Server, args json.RawMessage) (interface{}, error) {
+      return map[string]interface{}{"breakpoints": []Breakpoint{}}, nil
+   },
+   "configurationDone": (*Server).configurationDone,
+   "threads": func(s *Server, args json.RawMessage) (interface{}, error) {
+      return map[string]interface{}{"threads": []Thread{{ID: threadID, Name: "main"}}}, nil
+   },
+   "stackTrace": (*Server).stackTrace,
+   "scopes": (*Server).scopes,
+   "variables": (*Server).variables,
+   "evaluate": (*Server).evaluate,
+   "continue": func(s *Server, args json.RawMessage) (interface{}, error) {
+      if err := s.resumeWith(s.debugger.Continue); err != nil {
+         return nil, err
+      }
+      return map[string]interface{}{"allThreadsContinued": true}, nil
+   },
+   "next": func(s *Server, args json.RawMessage) (interface{}, error) {
+      return nil, s.resumeWith(s.debugger.StepOver)
+   },
+   "stepIn": func(s *Server, args json.RawMessage) (interface{}, error) {
+      return nil, s.resumeWith(s.debugger.StepInto)
+   },
+   "stepOut": func(s *Server, args json.RawMessage) (interface{}, error) {
+      return nil, s.resumeWith(s.debugger.StepOut)
+   },
+   "terminate": func(s *Server, args json.RawMessage) (interface{}, error) {
+      s.terminate()
+      return nil, nil
+   },
+   "disconnect": func(s *Server, args json.RawMessage) (interface{}, error) {
+      s.terminate()
+      return nil, nil
+   },
+}
+
+func Serve(in io.Reader, out io.Writer) error {
+   s := &Server{out: out, breakpoints: make(map[string][]SourceBreakpoint), resume: make(chan func())}
+   options := []evaluator.Option{evaluator.WithOutput(&output{s, "stdout"})}
+   if fsys, err := evaluator.DirFS("."); err == nil { // programs see the working directory
+      defer fsys.Close()
+      options = append(options, evaluator.WithFileSystem(fsys))
+   }
+   s.debugger = debug.New(options...)
+   s.debugger.OnStop = s.onStop
+
+   r := bufio.NewReader(in)
+   for {
+      content, err := framing.Read(r)
+      if err == io.EOF {
+         s.terminate()
+         return fmt.Errorf("input ended without disconnect")
+      }
+      if err != nil {
+         s.terminate()
+         return err
+      }
+      var msg message
+      if err := json.Unmarshal(content, &msg); err != nil || msg.Type != "request" {
+         continue // nothing to respond to
+      }
+      s.handle(&msg)
+      if msg.Command == "disconnect" {
+         return nil
+      }
+   }
+}
+
+func (s *Server) handle(msg *message) {
+   s.after = nil
+   body, err := s.dispatch(msg)
+   response := &message{Type: "response", RequestSeq: msg.Seq, Command: msg.Command, Success: err == nil}
+   if err != nil {
+      response.Message = err.Error()
+   } else if body != nil {
+      data, err := json.Marshal(body)
+      if err != nil {
+         response.Success, response.Message = false, err.Error()
+      } else {
+         response.Body = data
+      }
+   }
+   s.write(response)
+   if s.after != nil {
+      s.after()
+   }
+}
+
+func (s *Server) dispatch(msg *message) (body interface{}, err error) {
+   h, ok := handlers[msg.Command]
+   if !ok {
+      return nil, fmt.Errorf("unknown command: %s", msg.Command)
+   }
+   defer func() { // a bug in a request should not take the editor's session down
+      if r := recover(); r != nil {
+         body, err = nil, fmt.Errorf("%s: internal error: %v", msg.Command, r)
+      }
+   }()
+   return h(s, msg.Arguments)
+}
+
+func (s *Server) event(event string, body interface{}) {
+   msg := &message{Type: "event", Event: event}
+   if body != nil {
+      data, err := json.Marshal(body)
+      if err != nil {
+         return
+      }
+      msg.Body = data
+   }
+   s.write(msg)
+}
+
+func (s *Server) write(msg *message) {
+   s.writeMu.Lock()
+   defer s.writeMu.Unlock()
+   s.seq += 1
+   msg.Seq = s.seq
+   writeMessage(s.out, msg)
+}
+
+// output events of a category, e.g. for puts
+type output struct {
+   s        *Server
+   category string
+}
+
+func (o *output) Write(p []byte) (int, error) {
+   o.s.event("output", OutputEvent{Category: o.category, Output: string(p)})
+   return len(p), nil
+}
+
+func decode(args json.RawMessage, v interface{}) error {
+   if len(args) == 0 {
+      return nil
+   }
+   return json.Unmarshal(args, v)
+}
+
+func (s *Server) initialize(args json.RawMessage) (interface{}, error) {
+   s.after = func() { s.event("initialized", nil) }
+   return Capabilities{
+      SupportsConfigurationDoneRequest: true,
+      SupportsConditionalBreakpoints: true,
+      SupportsEvaluateForHovers: true,
+      SupportsTerminateRequest: true,
+   }, nil
+}
+
+func (s *Server) launch(args json.RawMessage) (interface{}, error) {
+   var params LaunchArguments
+   if err := decode(args, &params); err != nil {
+      return nil, err
+   }
+   if s.program != nil {
+      return nil, errors.New("a program was launched already")
+   }
+   path, err := filepath.Abs(params.Program)
+   if err != nil {
+      return nil, err
+   }
+   src, err := ioutil.ReadFile(path)
+   if err != nil {
+      return nil, err
+   }
+   p := parser.New(lexer.New(string(src)))
+   program := p.ParseProgram()
+   if len(p.Errors()) != 0 {
+      return nil, fmt.Errorf("%s:%s", params.Program, strings.Join(p.Errors(), "\n" + params.Program + ":"))
+   }
+   resolver := evaluator.NewResolver()
+   resolver.Resolve(program)
+   if len(resolver.Errors()) != 0 {
+      return nil, fmt.Errorf("%s: %s", params.Program, strings.Join(resolver.Errors(), "\n"))
+   }
+
+   s.path, s.program, s.stopOnEntry = path, program, params.StopOnEntry
+   s.applyBreakpoints()
+   if s.configured {
+      s.after = s.start
+   }
+   return nil, nil
+}
+
+func (s *Server) configurationDone(args json.RawMessage) (interface{}, error) {
+   s.configured = true
+   if s.program != nil && s.done == nil {
+      s.after = s.start
+   }
+   return nil, nil
+}
+
+// replaces the breakpoints of a source
+func (s *Server) setBreakpoints(args json.RawMessage) (interface{}, error) {
+   var params SetBreakpointsArguments
+   if err := decode(args, &params); err != nil {
+      return nil, err
+   }
+   path, err := filepath.Abs(params.Source.Path)
+   if err != nil {
+      return nil, err
+   }
+   s.breakpoints[path] = params.Breakpoints
+
+   var lines map[int]bool // with statements, nil before launch
+   if s.program != nil {
+      s.applyBreakpoints()
+      lines = statementLines(s.program)
+   }
+   breakpoints := []Breakpoint{}
+   for _, bp := range params.Breakpoints {
+      breakpoint := Breakpoint{Verified: true, Line: bp.Line}
+      switch {
+         case s.program != nil && path != s.path:
+            breakpoint.Verified, breakpoint.Message = false, "not the launched program"
+         case lines != nil && !lines[bp.Line]:
+            breakpoint.Verified, breakpoint.Message = false, "no statement on this line"
+      }
+      breakpoints = append(breakpoints, breakpoint)
+   }
+   return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// sets the breakpoints of the launched program in the debugger
+func (s *Server) applyBreakpoints() {
+   s.debugger.ClearBreakpoints()
+   for _, bp := range s.breakpoints[s.path] {
+      s.debugger.SetConditionalBreakpoint(bp.Line, bp.Condition)
+   }
+}
+
+// lines on which statements start
+func statementLines(program *ast.Program) map[int]bool {
+   lines := make(map[int]bool)
+   ast.Inspect(program, func(node ast.Node) bool {
+      switch node.(type) {
+         case *ast.LetStatement, *ast.ReturnStatement, *ast.ExpressionStatement:
+            lines[node.Pos().Line] = true
+      }
+      return true
+   })
+   return lines
+}
+
+// runs the program until it ends or is terminated, then sends the exited and terminated events
+func (s *Server) start() {
+   s.done = make(chan struct{})
+   go func() {
+      defer close(s.done)
+      result, err := s.debugger.Run(s.program, object.NewEnvironment())
+      exitCode := 0
+      if err != nil {
+         exitCode = 1
+      } else if result != nil && result.Type() == object.ERROR_OBJ {
+         s.event("output", OutputEvent{Category: "stderr", Output: result.Inspect() + "\n"})
+         exitCode = 1
+      }
+      s.event("exited", ExitedEvent{ExitCode: exitCode})
+      s.event("terminated", nil)
+   }()
+}
+
+// called on the program goroutine, waits for the action resuming the program
+func (s *Server) onStop(stop *debug.Stop) {
+   if stop.Reason == debug.STOP_ENTRY && !s.stopOnEntry {
+      return
+   }
+   s.mu.Lock()
+   if s.terminating {
+      s.mu.Unlock()
+      return
+   }
+   s.stop, s.refs = stop, nil
+   s.mu.Unlock()
+
+   s.event("stopped", StoppedEvent{Reason: string(stop.Reason), ThreadID: threadID, AllThreadsStopped: true})
+   action := <-s.resume
+   action()
+}
+
+// the current stop, an error if the program is not stopped
+func (s *Server) stopped() (*debug.Stop, error) {
+   s.mu.Lock()
+   defer s.mu.Unlock()
+   if s.stop == nil {
+      return nil, errors.New("the program is not stopped")
+   }
+   return s.stop, nil
+}
+
+// resumes the stopped program with action after the response
+func (s *Server) resumeWith(action func()) error {
+   s.mu.Lock()
+   defer s.mu.Unlock()
+   if s.stop == nil {
+      return errors.New("the program is not stopped")
+   }
+   s.stop, s.refs = nil, nil
+   s.after = func() { s.resume <- action }
+   return nil
+}
+
+// stops the program (if it runs) and waits for it to end
+func (s *Server) terminate() {
+   if s.done == nil {
+      return
+   }
+   s.debugger.Terminate()
+   s.mu.Lock()
+   s.terminating = true
+   stopped := s.stop != nil
+   s.stop, s.refs = nil, nil
+   s.mu.Unlock()
+   if stopped {
+      s.resume <- func() {}
+   }
+   <-s.done
+}
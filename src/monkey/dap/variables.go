@@ -0,0 +1,160 @@
+package dap
+
+import (
+   "encoding/json"
+   "errors"
+   "fmt"
+   "path/filepath"
+   "strconv"
+   "monkey/debug"
+   "monkey/object"
+)
+
+/*
+ * Inspection of a stopped program
+ *    ~ frame ids are 1-based positions in the call stack, innermost frame first
+ *    ~ scopes are the environments of a frame: Locals, Closure (one per enclosing function)
+ *      and Globals (the top-level environment)
+ *    ~ variables references number environments, arrays and hashes, they are valid until
+ *      the program is resumed; arrays are listed by index, hashes by key
+ */
+func (s *Server) stackTrace(args json.RawMessage) (interface{}, error) {
+   if _, err := s.stopped(); err != nil {
+      return nil, err
+   }
+   source := &Source{Name: filepath.Base(s.path), Path: s.path}
+   frames := []StackFrame{}
+   for i, frame := range s.debugger.Stack() {
+      frames = append(frames, StackFrame{
+         ID: i + 1,
+         Name: frame.Name,
+         Source: source,
+         Line: frame.Pos.Line,
+         Column: frame.Pos.Char,
+      })
+   }
+   return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *Server) scopes(args json.RawMessage) (interface{}, error) {
+   var params struct {
+      FrameID int `json:"frameId"`
+   }
+   if err := decode(args, &params); err != nil {
+      return nil, err
+   }
+   frame, err := s.frame(params.FrameID)
+   if err != nil {
+      return nil, err
+   }
+   envs := frame.Scopes()
+   scopes := []Scope{}
+   for i, env := range envs {
+      name := "Closure"
+      if i == len(envs) - 1 {
+         name = "Globals"
+      } else if i == 0 {
+         name = "Locals"
+      }
+      scopes = append(scopes, Scope{Name: name, VariablesReference: s.reference(env)})
+   }
+   return map[string]interface{}{"scopes": scopes}, nil
+}
+
+func (s *Server) variables(args json.RawMessage) (interface{}, error) {
+   var params struct {
+      VariablesReference int `json:"variablesReference"`
+   }
+   if err := decode(args, &params); err != nil {
+      return nil, err
+   }
+   if _, err := s.stopped(); err != nil {
+      return nil, err
+   }
+   s.mu.Lock()
+   var container interface{}
+   if ref := params.VariablesReference; ref >= 1 && ref <= len(s.refs) {
+      container = s.refs[ref - 1]
+   }
+   s.mu.Unlock()
+
+   variables := []Variable{}
+   switch container := container.(type) {
+      case *object.Environment:
+         for _, binding := range container.Bindings() {
+            variables = append(variables, s.variable(binding.Name, binding.Value))
+         }
+      case *object.Array:
+         for i := 0; i < container.Len(); i++ {
+            variables = append(variables, s.variable(strconv.Itoa(i), container.Get(i)))
+         }
+      case *object.Hash:
+         for _, pair := range container.Pairs() {
+            variables = append(variables, s.variable(pair.Key.Inspect(), pair.Value))
+         }
+      default:
+         return nil, fmt.Errorf("unknown variables reference %d", params.VariablesReference)
+   }
+   return map[string]interface{}{"variables": variables}, nil
+}
+
+func (s *Server) evaluate(args json.RawMessage) (interface{}, error) {
+   var params EvaluateArguments
+   if err := decode(args, &params); err != nil {
+      return nil, err
+   }
+   frame, err := s.frame(params.FrameID)
+   if err != nil {
+      return nil, err
+   }
+   value, err := s.debugger.Evaluate(frame, params.Expression)
+   if err != nil {
+      return nil, err
+   }
+   if value == nil {
+      return map[string]interface{}{"result": "", "variablesReference": 0}, nil
+   }
+   if value.Type() == object.ERROR_OBJ {
+      return nil, errors.New(value.Inspect())
+   }
+   v := s.variable("", value)
+   return map[string]interface{}{"result": v.Value, "type": v.Type, "variablesReference": v.VariablesReference}, nil
+}
+
+// frame of a frame id, the innermost frame for 0
+func (s *Server) frame(id int) (*debug.Frame, error) {
+   if _, err := s.stopped(); err != nil {
+      return nil, err
+   }
+   stack := s.debugger.Stack()
+   if id == 0 {
+      id = 1
+   }
+   if id < 1 || id > len(stack) {
+      return nil, fmt.Errorf("unknown frame %d", id)
+   }
+   return stack[id - 1], nil
+}
+
+// arrays and hashes with elements can be expanded
+func (s *Server) variable(name string, value object.Object) Variable {
+   v := Variable{Name: name, Value: value.Inspect(), Type: string(value.Type())}
+   switch value := value.(type) {
+      case *object.Array:
+         if value.Len() > 0 {
+            v.VariablesReference = s.reference(value)
+         }
+      case *object.Hash:
+         if value.Len() > 0 {
+            v.VariablesReference = s.reference(value)
+         }
+   }
+   return v
+}
+
+func (s *Server) reference(container interface{}) int {
+   s.mu.Lock()
+   defer s.mu.Unlock()
+   s.refs = append(s.refs, container)
+   return len(s.refs)
+}
@@ -0,0 +1,294 @@
+package debug
+
+import (
+   "bufio"
+   "fmt"
+   "io"
+   "sort"
+   "strconv"
+   "strings"
+   "monkey/ast"
+   "monkey/evaluator"
+   "monkey/object"
+)
+
+const PROMPT = "(debug) "
+
+/*
+ * Start: command-line debugger for a resolved program, read from in, written to out
+ *    ~ the program stops before its first statement, so breakpoints can be set
+ *    ~ at each stop the position and source line are printed, followed by a prompt
+ *    ~ an empty line repeats the last command, the end of in terminates the program
+ *    ~ returns 1 if the program ended with an error or was terminated, 0 otherwise
+ */
+func Start(filename, source string, program *ast.Program, in io.Reader, out io.Writer, options ...evaluator.Option) int {
+   s := &session{
+      d: New(options...),
+      filename: filename,
+      lines: strings.Split(source, "\n"),
+      scanner: bufio.NewScanner(in),
+      out: out,
+   }
+   s.d.OnStop = s.stopped
+
+   result, err := s.d.Run(program, object.NewEnvironment())
+   switch {
+      case err != nil:
+         fmt.Fprintf(out, "%s\n", err)
+         return 1
+      case result != nil && result.Type() == object.ERROR_OBJ:
+         fmt.Fprintf(out, "program exited with %s\n", result.Inspect())
+         return 1
+      default:
+         fmt.Fprintf(out, "program exited\n")
+         return 0
+   }
+}
+
+type session struct {
+   d        *Debugger
+   filename string
+   lines    []string
+   scanner  *bufio.Scanner
+   out      io.Writer
+   stop     *Stop
+   last     string // last command, repeated by an empty line
+}
+
+/*
+ * Commands: "name argument" lines read while the program is stopped
+ *    ~ step, next, finish and continue resume the program, the others inspect it
+ *    ~ names can be abbreviated as in aliases, e.g. "b 12", "p n - 1"
+ */
+type command struct {
+   usage string
+   help  string
+   run   func(s *session, arg string) bool // true: resume the program
+}
+
+var commands = map[string]*command{
+   "break": &command{
+      usage: "break [line [if expr]]",
+      help: "stop at the statements of a line (if expr is truthy), list the breakpoints without line",
+      run: func(s *session, arg string) bool {
+         if arg == "" {
+            for _, line := range s.d.Breakpoints() {
+               s.printBreakpoint(line)
+            }
+            return false
+         }
+         arg, condition, _ := strings.Cut(arg, " if ")
+         if line, ok := s.line(strings.TrimSpace(arg), "break"); ok {
+            s.d.SetConditionalBreakpoint(line, strings.TrimSpace(condition))
+            s.printBreakpoint(line)
+         }
+         return false
+      },
+   },
+   "clear": &command{
+      usage: "clear <line>",
+      help: "remove the breakpoint of a line",
+      run: func(s *session, arg string) bool {
+         if line, ok := s.line(arg, "clear"); ok {
+            s.d.ClearBreakpoint(line)
+         }
+         return false
+      },
+   },
+   "step": &command{
+      usage: "step",
+      help: "run to the next statement, entering function calls",
+      run: func(s *session, arg string) bool {
+         s.d.StepInto()
+         return true
+      },
+   },
+   "next": &command{
+      usage: "next",
+      help: "run to the next statement of this function, over function calls",
+      run: func(s *session, arg string) bool {
+         s.d.StepOver()
+         return true
+      },
+   },
+   "finish": &command{
+      usage: "finish",
+      help: "run until this function returns",
+      run: func(s *session, arg string) bool {
+         s.d.StepOut()
+         return true
+      },
+   },
+   "continue": &command{
+      usage: "continue",
+      help: "run to the next breakpoint",
+      run: func(s *session, arg string) bool {
+         s.d.Continue()
+         return true
+      },
+   },
+   "backtrace": &command{
+      usage: "backtrace",
+      help: "print the call stack, innermost call first",
+      run: func(s *session, arg string) bool {
+         for i, frame := range s.d.Stack() {
+            if frame.Pos.Line == 0 { // builtins have no position
+               fmt.Fprintf(s.out, "#%d %s\n", i, frame.Name)
+               continue
+            }
+            fmt.Fprintf(s.out, "#%d %s at %s:%d:%d\n", i, frame.Name, s.filename, frame.Pos.Line, frame.Pos.Char)
+         }
+         return false
+      },
+   },
+   "scopes": &command{
+      usage: "scopes",
+      help: "print the bindings of each scope, innermost first",
+      run: func(s *session, arg string) bool {
+         scopes := s.stop.Frame.Scopes()
+         for i, env := range scopes {
+            kind := "closure"
+            if i == len(scopes) - 1 {
+               kind = "global"
+            } else if i == 0 {
+               kind = "local"
+            }
+            fmt.Fprintf(s.out, "scope %d (%s):\n", i, kind)
+            for _, binding := range env.Bindings() {
+               fmt.Fprintf(s.out, "   %s = %s\n", binding.Name, binding.Value.Inspect())
+            }
+         }
+         return false
+      },
+   },
+   "print": &command{
+      usage: "print <expr>",
+      help: "evaluate an expression in the current frame",
+      run: func(s *session, arg string) bool {
+         if arg == "" {
+            fmt.Fprintf(s.out, "usage: print <expr>\n")
+            return false
+         }
+         value, err := s.d.Evaluate(s.stop.Frame, arg)
+         if err != nil {
+            fmt.Fprintf(s.out, "%s\n", err)
+         } else if value != nil {
+            fmt.Fprintf(s.out, "%s\n", value.Inspect())
+         }
+         return false
+      },
+   },
+   "list": &command{
+      usage: "list",
+      help: "print the source around the current statement",
+      run: func(s *session, arg string) bool {
+         current := s.stop.Statement.Pos().Line
+         for line := max(current - 3, 1); line <= min(current + 3, len(s.lines)); line++ {
+            marker := "  "
+            if line == current {
+               marker = "=>"
+            }
+            fmt.Fprintf(s.out, "%s %4d  %s\n", marker, line, s.lines[line - 1])
+         }
+         return false
+      },
+   },
+   "quit": &command{
+      usage: "quit",
+      help: "terminate the program",
+      run: func(s *session, arg string) bool {
+         s.d.Terminate()
+         return true
+      },
+   },
+}
+
+var aliases = map[string]string{
+   "b": "break",
+   "s": "step",
+   "n": "next",
+   "c": "continue",
+   "bt": "backtrace",
+   "p": "print",
+   "l": "list",
+   "q": "quit",
+}
+
+func init() {
+   commands["help"] = &command{ // refers to commands
+      usage: "help",
+      help: "list the commands",
+      run: func(s *session, arg string) bool {
+         names := make([]string, 0, len(commands))
+         for name := range commands {
+            names = append(names, name)
+         }
+         sort.Strings(names)
+         for _, name := range names {
+            fmt.Fprintf(s.out, "%-22s %s\n", commands[name].usage, commands[name].help)
+         }
+         return false
+      },
+   }
+}
+
+// reads and runs commands until one resumes the program
+func (s *session) stopped(stop *Stop) {
+   s.stop = stop
+   pos := stop.Statement.Pos()
+   fmt.Fprintf(s.out, "stopped at %s:%d:%d (%s)\n", s.filename, pos.Line, pos.Char, stop.Reason)
+   if pos.Line >= 1 && pos.Line <= len(s.lines) {
+      fmt.Fprintf(s.out, "%4d  %s\n", pos.Line, s.lines[pos.Line - 1])
+   }
+
+   for {
+      fmt.Fprint(s.out, PROMPT)
+      if !s.scanner.Scan() {
+         fmt.Fprintln(s.out)
+         s.d.Terminate()
+         return
+      }
+      input := strings.TrimSpace(s.scanner.Text())
+      if input == "" {
+         input = s.last
+      }
+      if input == "" {
+         continue
+      }
+      s.last = input
+      if s.command(input) {
+         return
+      }
+   }
+}
+
+func (s *session) command(input string) bool {
+   name, arg, _ := strings.Cut(input, " ")
+   if alias, ok := aliases[name]; ok {
+      name = alias
+   }
+   cmd, ok := commands[name]
+   if !ok {
+      fmt.Fprintf(s.out, "unknown command %s, try help\n", name)
+      return false
+   }
+   return cmd.run(s, strings.TrimSpace(arg))
+}
+
+func (s *session) printBreakpoint(line int) {
+   if condition, _ := s.d.Breakpoint(line); condition != "" {
+      fmt.Fprintf(s.out, "breakpoint at %s:%d if %s\n", s.filename, line, condition)
+   } else {
+      fmt.Fprintf(s.out, "breakpoint at %s:%d\n", s.filename, line)
+   }
+}
+
+// a line number argument, usage is printed if it is not one
+func (s *session) line(arg, name string) (int, bool) {
+   line, err := strconv.Atoi(arg)
+   if err != nil || line < 1 {
+      fmt.Fprintf(s.out, "usage: %s <line>\n", name)
+      return 0, false
+   }
+   return line, true
+}
@@ -0,0 +1,203 @@
+package debug
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+const program = `let double = fn(x) {
+   let y = x * 2;
+   y
+};
+let a = double(3);
+let b = double(a);
+a + b`
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	prog := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	evaluator.NewResolver().Resolve(prog)
+	return prog
+}
+
+// runs the program, resuming each stop with the next action, returns the stops as "reason line"
+func stops(t *testing.T, d *Debugger, actions ...func()) []string {
+	var got []string
+	d.OnStop = func(stop *Stop) {
+		got = append(got, fmt.Sprintf("%s %d", stop.Reason, stop.Statement.Pos().Line))
+		if len(actions) > 0 {
+			actions[0]()
+			actions = actions[1:]
+		}
+	}
+	if _, err := d.Run(parse(t, program), object.NewEnvironment()); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	return got
+}
+
+func TestStepping(t *testing.T) {
+	tests := []struct {
+		name     string
+		actions  func(d *Debugger) []func()
+		expected []string
+	}{
+		{"continue", func(d *Debugger) []func() { return nil }, []string{"entry 1"}},
+		{"step into", func(d *Debugger) []func() {
+			return []func(){d.StepInto, d.StepInto, d.StepInto, d.StepInto}
+		}, []string{"entry 1", "step 5", "step 2", "step 3", "step 6"}},
+		{"step over", func(d *Debugger) []func() {
+			return []func(){d.StepOver, d.StepOver, d.StepOver}
+		}, []string{"entry 1", "step 5", "step 6", "step 7"}},
+		{"step out", func(d *Debugger) []func() {
+			return []func(){d.StepInto, d.StepInto, d.StepOut}
+		}, []string{"entry 1", "step 5", "step 2", "step 6"}},
+	}
+
+	for _, tt := range tests {
+		d := New()
+		got := stops(t, d, tt.actions(d)...)
+		if strings.Join(got, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("%s: wrong stops. want=%q, got=%q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	d := New()
+	d.SetBreakpoint(3)
+	d.SetBreakpoint(7)
+	got := stops(t, d)
+	expected := []string{"entry 1", "breakpoint 3", "breakpoint 3", "breakpoint 7"}
+	if strings.Join(got, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("wrong stops. want=%q, got=%q", expected, got)
+	}
+
+	d.ClearBreakpoint(3)
+	if lines := d.Breakpoints(); len(lines) != 1 || lines[0] != 7 {
+		t.Errorf("wrong breakpoints. want=[7], got=%v", lines)
+	}
+}
+
+func TestConditionalBreakpoints(t *testing.T) {
+	tests := []struct {
+		condition string
+		expected  []string
+	}{
+		{"x > 3", []string{"entry 1", "breakpoint 3"}},
+		{"x > 10", []string{"entry 1"}},
+		{"unknown", []string{"entry 1", "breakpoint 3", "breakpoint 3"}}, // stops if it cannot be evaluated
+	}
+
+	for _, tt := range tests {
+		d := New()
+		d.SetConditionalBreakpoint(3, tt.condition)
+		var values []string
+		got := stops(t, d, func() {}, func() {
+			value, _ := d.Evaluate(d.Stack()[0], "x")
+			values = append(values, value.Inspect())
+		})
+		if strings.Join(got, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("%s: wrong stops. want=%q, got=%q", tt.condition, tt.expected, got)
+		}
+		if tt.condition == "x > 3" && (len(values) != 1 || values[0] != "6") {
+			t.Errorf("%s: stopped with x=%q, want x=6", tt.condition, values)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	d := New()
+	d.SetBreakpoint(3)
+	var stack, scopes []string
+	var value object.Object
+	d.OnStop = func(stop *Stop) {
+		if stop.Reason != STOP_BREAKPOINT || stack != nil {
+			return
+		}
+		for _, frame := range d.Stack() {
+			stack = append(stack, fmt.Sprintf("%s %d:%d", frame.Name, frame.Pos.Line, frame.Pos.Char))
+		}
+		for _, env := range stop.Frame.Scopes() {
+			var names []string
+			for _, binding := range env.Bindings() {
+				names = append(names, binding.Name+"="+binding.Value.Inspect())
+			}
+			scopes = append(scopes, strings.Join(names, " "))
+		}
+		var err error
+		if value, err = d.Evaluate(stop.Frame, "let z = y + x; z * 10"); err != nil {
+			t.Errorf("Evaluate failed: %s", err)
+		}
+	}
+	if _, err := d.Run(parse(t, program), object.NewEnvironment()); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	if expected := []string{"double 3:4", "<program> 5:9"}; strings.Join(stack, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("wrong stack. want=%q, got=%q", expected, stack)
+	}
+	if len(scopes) != 2 || scopes[0] != "x=3 y=6" || !strings.HasPrefix(scopes[1], "double=") {
+		t.Errorf("wrong scopes. got=%q", scopes)
+	}
+	if value == nil || value.Inspect() != "90" {
+		t.Errorf("wrong value. want=90, got=%v", value)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	d := New()
+	d.OnStop = func(stop *Stop) { d.Terminate() }
+	result, err := d.Run(parse(t, program), object.NewEnvironment())
+	if err != ErrTerminated || result != nil {
+		t.Errorf("not terminated. result=%v, err=%v", result, err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	input := "break 3\ncontinue\nbacktrace\nprint x + 1\nfinish\nfoo\nquit\n"
+	var out bytes.Buffer
+	status := Start("double.mo", program, parse(t, program), strings.NewReader(input), &out)
+
+	expected := `stopped at double.mo:1:1 (entry)
+   1  let double = fn(x) {
+(debug) breakpoint at double.mo:3
+(debug) stopped at double.mo:3:4 (breakpoint)
+   3     y
+(debug) #0 double at double.mo:3:4
+#1 <program> at double.mo:5:9
+(debug) 4
+(debug) stopped at double.mo:6:1 (step)
+   6  let b = double(a);
+(debug) unknown command foo, try help
+(debug) terminated
+`
+	if status != 1 || out.String() != expected {
+		t.Errorf("wrong session (status %d). want=\n%s\ngot=\n%s", status, expected, out.String())
+	}
+}
+
+func TestBacktraceThroughBuiltin(t *testing.T) {
+	source := "let f = fn(x) {\n  x * 2\n};\nmap([1], f);\n"
+	input := "break 2\ncontinue\nbacktrace\nquit\n"
+	var out bytes.Buffer
+	Start("map.mo", source, parse(t, source), strings.NewReader(input), &out)
+
+	expected := `(debug) #0 fn at map.mo:2:3
+#1 map
+#2 <program> at map.mo:4:1
+`
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("wrong backtrace. want=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,290 @@
+package debug
+
+import (
+   "errors"
+   "sort"
+   "strings"
+   "sync"
+   "monkey/ast"
+   "monkey/evaluator"
+   "monkey/lexer"
+   "monkey/object"
+   "monkey/parser"
+   "monkey/token"
+)
+
+// Run's error when the program was terminated from a stop
+var ErrTerminated = errors.New("terminated")
+
+type StopReason string
+
+const (
+   STOP_ENTRY      StopReason = "entry"      // before the first statement
+   STOP_BREAKPOINT StopReason = "breakpoint" // at a statement on a breakpoint line
+   STOP_STEP       StopReason = "step"       // after a step into, over or out
+)
+
+type Stop struct {
+   Reason    StopReason
+   Statement ast.Statement // to be evaluated next
+   Frame     *Frame        // of the statement
+}
+
+/*
+ * Frame: a function application on the call stack, or the program at the bottom
+ *    ~ Pos: the statement being evaluated, the call for frames that called another function
+ *    ~ Env: environment of the function body, nil until its first statement (and for builtins)
+ */
+type Frame struct {
+   Name string
+   Call *ast.CallExpression // nil for the program and calls from builtins
+   Env  *object.Environment
+   Pos  token.SourcePosition
+}
+
+// Env and its outer environments, innermost first (the last one is the top-level scope)
+func (f *Frame) Scopes() []*object.Environment {
+   scopes := []*object.Environment{}
+   for env := f.Env; env != nil; env = env.Outer() {
+      scopes = append(scopes, env)
+   }
+   return scopes
+}
+
+type stepMode int
+
+const (
+   run stepMode = iota // until a breakpoint
+   stepInto            // until the next statement
+   stepOver            // until the next statement in this or a calling frame
+   stepOut             // until the next statement in a calling frame
+)
+
+/*
+ * Debugger: evaluator hooks pausing a program at statements (let, return, expressions)
+ *    ~ OnStop is called on the evaluating goroutine when the program stops, the program
+ *      continues when it returns, as set by Continue, StepInto, StepOver, StepOut or Terminate
+ *      (Continue if none was called)
+ *    ~ while stopped, Stack, Scopes and Evaluate inspect the program, statements of the
+ *      evaluated code do not stop
+ *    ~ breakpoints are lines (1-based), a breakpoint stops at the first statement starting on
+ *      its line, once per visit of the line by a frame
+ *    ~ a conditional breakpoint only stops if its condition evaluates to a truthy value in the
+ *      frame (or fails to evaluate)
+ *    ~ breakpoints can be changed and Terminate called from other goroutines while the program
+ *      runs, terminating at the next statement
+ */
+type Debugger struct {
+   evaluator.BaseHooks
+   OnStop func(stop *Stop)
+
+   in          *evaluator.Interpreter
+   stack       []*Frame
+   mode        stepMode
+   stepDepth   int  // stack depth when stepping started
+   evaluating  bool // Evaluate in progress
+
+   mu          sync.Mutex // guards breakpoints and terminated
+   breakpoints map[int]string // line: condition, "" for none
+   terminated  bool
+}
+
+func New(options ...evaluator.Option) *Debugger {
+   d := &Debugger{breakpoints: make(map[int]string)}
+   d.in = evaluator.New(append(options, evaluator.WithHooks(d))...)
+   return d
+}
+
+// evaluate a resolved program, stopping before its first statement
+func (d *Debugger) Run(program *ast.Program, env *object.Environment) (result object.Object, err error) {
+   d.stack = []*Frame{&Frame{Name: "<program>", Env: env}}
+   d.mode = stepInto
+   d.mu.Lock()
+   d.terminated = false
+   d.mu.Unlock()
+   defer func() {
+      if r := recover(); r != nil {
+         if r != ErrTerminated {
+            panic(r)
+         }
+         result, err = nil, ErrTerminated
+      }
+      d.stack = nil
+   }()
+   return d.in.Eval(program, env), nil
+}
+
+func (d *Debugger) SetBreakpoint(line int) {
+   d.SetConditionalBreakpoint(line, "")
+}
+
+// breakpoint stopping only if condition is truthy, e.g. "n < 2"
+func (d *Debugger) SetConditionalBreakpoint(line int, condition string) {
+   d.mu.Lock()
+   defer d.mu.Unlock()
+   d.breakpoints[line] = condition
+}
+
+func (d *Debugger) ClearBreakpoint(line int) {
+   d.mu.Lock()
+   defer d.mu.Unlock()
+   delete(d.breakpoints, line)
+}
+
+func (d *Debugger) ClearBreakpoints() {
+   d.mu.Lock()
+   defer d.mu.Unlock()
+   d.breakpoints = make(map[int]string)
+}
+
+// condition of the breakpoint of a line, ok is false without breakpoint
+func (d *Debugger) Breakpoint(line int) (condition string, ok bool) {
+   d.mu.Lock()
+   defer d.mu.Unlock()
+   condition, ok = d.breakpoints[line]
+   return condition, ok
+}
+
+// breakpoint lines in ascending order
+func (d *Debugger) Breakpoints() []int {
+   d.mu.Lock()
+   defer d.mu.Unlock()
+   lines := make([]int, 0, len(d.breakpoints))
+   for line := range d.breakpoints {
+      lines = append(lines, line)
+   }
+   sort.Ints(lines)
+   return lines
+}
+
+func (d *Debugger) Continue() { d.resume(run) }
+func (d *Debugger) StepInto() { d.resume(stepInto) }
+func (d *Debugger) StepOver() { d.resume(stepOver) }
+func (d *Debugger) StepOut()  { d.resume(stepOut) }
+
+// stop evaluating, Run returns ErrTerminated
+func (d *Debugger) Terminate() {
+   d.mu.Lock()
+   defer d.mu.Unlock()
+   d.terminated = true
+}
+
+func (d *Debugger) isTerminated() bool {
+   d.mu.Lock()
+   defer d.mu.Unlock()
+   return d.terminated
+}
+
+func (d *Debugger) resume(mode stepMode) {
+   d.mode = mode
+   d.stepDepth = len(d.stack)
+}
+
+// the call stack, innermost frame first
+func (d *Debugger) Stack() []*Frame {
+   stack := make([]*Frame, len(d.stack))
+   for i, frame := range d.stack {
+      stack[len(d.stack) - 1 - i] = frame
+   }
+   return stack
+}
+
+// evaluate source in the environment of frame, e.g. "n - 1"
+func (d *Debugger) Evaluate(frame *Frame, source string) (object.Object, error) {
+   if frame.Env == nil {
+      return nil, errors.New("frame has no environment")
+   }
+   p := parser.New(lexer.New(source))
+   program := p.ParseProgram()
+   if len(p.Errors()) != 0 {
+      return nil, errors.New(strings.Join(p.Errors(), "\n"))
+   }
+   resolver := evaluator.NewResolverFor(frame.Env)
+   resolver.Resolve(program)
+   if len(resolver.Errors()) != 0 {
+      return nil, errors.New(strings.Join(resolver.Errors(), "\n"))
+   }
+   d.evaluating = true
+   defer func() { d.evaluating = false }()
+   return d.in.Eval(program, frame.Env), nil
+}
+
+func (d *Debugger) EnterNode(node ast.Node, env *object.Environment) {
+   stmt, ok := node.(ast.Statement)
+   if !ok || d.evaluating || len(d.stack) == 0 {
+      return
+   }
+   if _, ok := stmt.(*ast.BlockStatement); ok {
+      return
+   }
+   if d.isTerminated() {
+      panic(ErrTerminated)
+   }
+   frame := d.stack[len(d.stack) - 1]
+   line := frame.Pos.Line
+   frame.Env, frame.Pos = env, stmt.Pos()
+
+   var reason StopReason
+   switch {
+      case d.mode == stepInto:
+         reason = STOP_STEP
+      case d.mode == stepOver && len(d.stack) <= d.stepDepth:
+         reason = STOP_STEP
+      case d.mode == stepOut && len(d.stack) < d.stepDepth:
+         reason = STOP_STEP
+      case frame.Pos.Line != line && d.breaksAt(frame):
+         reason = STOP_BREAKPOINT
+      default:
+         return
+   }
+   if len(d.stack) == 1 && line == 0 { // first statement of the program
+      reason = STOP_ENTRY
+   }
+   d.stop(&Stop{Reason: reason, Statement: stmt, Frame: frame})
+}
+
+// whether a breakpoint on the line of frame stops
+func (d *Debugger) breaksAt(frame *Frame) bool {
+   condition, ok := d.Breakpoint(frame.Pos.Line)
+   if !ok || condition == "" {
+      return ok
+   }
+   value, err := d.Evaluate(frame, condition)
+   return err != nil || value == nil || (value != evaluator.FALSE && value != evaluator.NULL)
+}
+
+func (d *Debugger) stop(stop *Stop) {
+   d.resume(run)
+   if d.OnStop != nil {
+      d.OnStop(stop)
+   }
+   if d.isTerminated() {
+      panic(ErrTerminated)
+   }
+}
+
+func (d *Debugger) Call(node *ast.CallExpression, fn object.Object, args []object.Object) {
+   if d.evaluating || len(d.stack) == 0 {
+      return
+   }
+   frame := &Frame{Name: functionName(fn), Call: node}
+   if node != nil {
+      frame.Name = node.Function.String()
+      d.stack[len(d.stack) - 1].Pos = node.Pos()
+   }
+   d.stack = append(d.stack, frame)
+}
+
+func (d *Debugger) Return(node *ast.CallExpression, fn object.Object, result object.Object) {
+   if d.evaluating || len(d.stack) == 0 {
+      return
+   }
+   d.stack = d.stack[:len(d.stack) - 1]
+}
+
+func functionName(fn object.Object) string {
+   if b, ok := fn.(*object.Builtin); ok {
+      return b.Name
+   }
+   return "fn"
+}
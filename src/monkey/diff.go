@@ -0,0 +1,116 @@
+package main
+
+import (
+   "bytes"
+   "fmt"
+   "strings"
+)
+
+const diffContext = 3
+
+type diffLine struct {
+   kind byte // ' ', '-' or '+'
+   text string
+}
+
+// unified diff of two texts, "" if they are equal
+func unifiedDiff(filename, a, b string) string {
+   if a == b {
+      return ""
+   }
+   lines := diffLines(splitLines(a), splitLines(b))
+
+   var out bytes.Buffer
+   fmt.Fprintf(&out, "--- %s\n+++ %s\n", filename, filename)
+   for start := 0; start < len(lines); {
+      if lines[start].kind == ' ' {
+         start += 1
+         continue
+      }
+      // a hunk: changes less than 2 * diffContext unchanged lines apart, with context around them
+      end := start
+      for i := start; i < len(lines) && i - end <= 2 * diffContext; i++ {
+         if lines[i].kind != ' ' {
+            end = i + 1
+         }
+      }
+      from, to := max(start - diffContext, 0), min(end + diffContext, len(lines))
+
+      aStart, bStart := 1, 1 // line numbers of lines[from]
+      for _, line := range lines[:from] {
+         if line.kind != '+' {
+            aStart += 1
+         }
+         if line.kind != '-' {
+            bStart += 1
+         }
+      }
+      aCount, bCount := 0, 0
+      for _, line := range lines[from:to] {
+         if line.kind != '+' {
+            aCount += 1
+         }
+         if line.kind != '-' {
+            bCount += 1
+         }
+      }
+      fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+      for _, line := range lines[from:to] {
+         out.WriteByte(line.kind)
+         out.WriteString(line.text + "\n")
+      }
+      start = to
+   }
+   return out.String()
+}
+
+func hunkRange(start, count int) string {
+   if count == 0 {
+      return fmt.Sprintf("%d,0", start - 1) // empty range: the line before
+   }
+   if count == 1 {
+      return fmt.Sprintf("%d", start)
+   }
+   return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(text string) []string {
+   if text == "" {
+      return nil
+   }
+   return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// edit script from a to b along a longest common subsequence of lines
+func diffLines(a, b []string) []diffLine {
+   lcs := make([][]int, len(a) + 1) // lcs[i][j]: length for a[i:] and b[j:]
+   for i := range lcs {
+      lcs[i] = make([]int, len(b) + 1)
+   }
+   for i := len(a) - 1; i >= 0; i-- {
+      for j := len(b) - 1; j >= 0; j-- {
+         if a[i] == b[j] {
+            lcs[i][j] = lcs[i + 1][j + 1] + 1
+         } else {
+            lcs[i][j] = max(lcs[i + 1][j], lcs[i][j + 1])
+         }
+      }
+   }
+
+   var lines []diffLine
+   i, j := 0, 0
+   for i < len(a) || j < len(b) {
+      switch {
+         case i < len(a) && j < len(b) && a[i] == b[j]:
+            lines = append(lines, diffLine{' ', a[i]})
+            i, j = i + 1, j + 1
+         case j == len(b) || (i < len(a) && lcs[i + 1][j] >= lcs[i][j + 1]):
+            lines = append(lines, diffLine{'-', a[i]})
+            i += 1
+         default:
+            lines = append(lines, diffLine{'+', b[j]})
+            j += 1
+      }
+   }
+   return lines
+}
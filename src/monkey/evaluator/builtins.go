@@ -2,28 +2,47 @@ package evaluator
 
 import (
    "fmt"
-   //"unicode/utf8"
+   "unicode/utf8"
    "monkey/object"
 )
 
-var builtins = map[string]*object.Builtin{
-   "len": &object.Builtin{
-      Fn: func(args ...object.Object) object.Object {
+/*
+ * Builtins: bound to an Interpreter by New
+ *    ~ MinArgs and MaxArgs give the accepted argument counts, MaxArgs is -1 for any number,
+ *      so tools can check calls without running them
+ *    ~ Usage is the signature followed by a one-line description, shown by editors
+ */
+type builtin struct {
+   MinArgs int
+   MaxArgs int
+   Usage   string
+   Fn      func(in *Interpreter, args ...object.Object) object.Object
+}
+
+var builtins = map[string]*builtin{
+   "len": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "len(x): number of characters of a string, elements of an array or pairs of a hash",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
          if len(args) != 1 {
             return newError("wrong number of arguments. got=%d, want=1", len(args))
          }
          switch arg := args[0].(type) {
             case *object.String:
-               return &object.Integer{Value: int64(len(arg.Value))}
+               return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
             case *object.Array:
-               return &object.Integer{Value: int64(len(arg.Elements))}
+               return &object.Integer{Value: int64(arg.Len())}
+            case *object.Hash:
+               return &object.Integer{Value: int64(arg.Len())}
             default:
                return newError("argument type to `len` not supported, got=%s", arg.Type())
          }
       },
    },
-   "first": &object.Builtin{
-      Fn: func(args ...object.Object) object.Object {
+   "first": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "first(arr): first element of arr, null if empty",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
          if len(args) != 1 {
             return newError("wrong number of arguments. got=%d, want=1", len(args))
          }
@@ -31,14 +50,16 @@ var builtins = map[string]*object.Builtin{
             return newError("argument type to `first` not supported, got=%s, want=ARRAY", args[0].Type())
          }
          arr := args[0].(*object.Array)
-         if len(arr.Elements) > 0 {
-            return arr.Elements[0]
+         if arr.Len() > 0 {
+            return arr.Get(0)
          }
          return NULL
       },
    },
-   "last": &object.Builtin{
-      Fn: func(args ...object.Object) object.Object {
+   "last": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "last(arr): last element of arr, null if empty",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
          if len(args) != 1 {
             return newError("wrong number of arguments. got=%d, want=1", len(args))
          }
@@ -46,14 +67,16 @@ var builtins = map[string]*object.Builtin{
             return newError("argument type to `last` not supported, got=%s, want=ARRAY", args[0].Type())
          }
          arr := args[0].(*object.Array)
-         if len(arr.Elements) > 0 {
-            return arr.Elements[len(arr.Elements) - 1]
+         if arr.Len() > 0 {
+            return arr.Get(arr.Len() - 1)
          }
          return NULL
       },
    },
-   "rest": &object.Builtin{
-      Fn: func(args ...object.Object) object.Object {
+   "rest": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "rest(arr): arr without its first element, null if empty",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
          if len(args) != 1 {
             return newError("wrong number of arguments. got=%d, want=1", len(args))
          }
@@ -61,17 +84,16 @@ var builtins = map[string]*object.Builtin{
             return newError("argument type to `last` not supported, got=%s, want=ARRAY", args[0].Type())
          }
          arr := args[0].(*object.Array)
-         length := len(arr.Elements)
-         if length > 0 {
-            newElements := make([]object.Object, length - 1, length - 1)
-            copy(newElements, arr.Elements[1:])
-            return &object.Array{Elements: newElements}
+         if arr.Len() > 0 {
+            return arr.Rest() // shares structure with arr
          }
          return NULL
       },
    },
-   "push": &object.Builtin{
-      Fn: func(args ...object.Object) object.Object {
+   "push": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "push(arr, value): arr with value appended",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
          if len(args) != 2 {
             return newError("wrong number of arguments. got=%d, want=2", len(args))
          }
@@ -79,20 +101,75 @@ var builtins = map[string]*object.Builtin{
             return newError("argument type to `push` not supported, got=%s, want=ARRAY", args[0].Type())
          }
          arr := args[0].(*object.Array)
-         length := len(arr.Elements)
-         newElements := make([]object.Object, length + 1, length + 1)
-         copy(newElements, arr.Elements)
-         newElements[length] = args[1]
-         return &object.Array{Elements: newElements}
+         return arr.Push(args[1]) // shares structure with arr
       },
    },
-   "puts": &object.Builtin{
-      Fn: func(args ...object.Object) object.Object {
+   "puts": &builtin{
+      MinArgs: 0, MaxArgs: -1,
+      Usage: "puts(values...): prints each value on a line of its own",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
          for _, arg := range args {
-            fmt.Println(arg.Inspect())
+            fmt.Fprintln(in.out, arg.Inspect())
          }
          return NULL
       },
    },
 }
 
+
+// accepted argument counts of a builtin, max is -1 for any number, ok is false if there is no such builtin
+func BuiltinArity(name string) (min, max int, ok bool) {
+   b, ok := builtins[name]
+   if !ok {
+      return 0, 0, false
+   }
+   return b.MinArgs, b.MaxArgs, true
+}
+
+// signature and description of a builtin, "" if there is no such builtin
+func BuiltinUsage(name string) string {
+   if b, ok := builtins[name]; ok {
+      return b.Usage
+   }
+   return ""
+}
+
+// add a group of builtins (see builtins_*.go)
+func registerBuiltins(group map[string]*builtin) {
+   for name, builtin := range group {
+      builtins[name] = builtin
+   }
+}
+
+// checks that min <= len(args) <= max
+func checkArgumentCount(args []object.Object, min, max int) *object.Error {
+   if len(args) >= min && len(args) <= max {
+      return nil
+   }
+   if min == max {
+      return newError("wrong number of arguments. got=%d, want=%d", len(args), min)
+   }
+   return newError("wrong number of arguments. got=%d, want=%d..%d", len(args), min, max)
+}
+
+// checks the type of each given argument (omitted optional arguments are skipped)
+//    ~ FUNCTION accepts builtins as well
+func checkArgumentTypes(name string, args []object.Object, types ...object.ObjectType) *object.Error {
+   for i, arg := range args {
+      if i >= len(types) || arg.Type() == types[i] {
+         continue
+      }
+      if types[i] != object.FUNCTION_OBJ || arg.Type() != object.BUILTIN_OBJ {
+         return newError("argument type to `%s` not supported, got=%s, want=%s", name, arg.Type(), types[i])
+      }
+   }
+   return nil
+}
+
+// checks argument count and types, all arguments required
+func checkArguments(name string, args []object.Object, types ...object.ObjectType) *object.Error {
+   if err := checkArgumentCount(args, len(types), len(types)); err != nil {
+      return err
+   }
+   return checkArgumentTypes(name, args, types...)
+}
@@ -0,0 +1,403 @@
+package evaluator
+
+import (
+   "sort"
+   "monkey/object"
+)
+
+/*
+ * Array builtins
+ *    ~ arrays are persistent, every builtin returns a new array
+ *    ~ callbacks are Monkey functions (or builtins) applied through the interpreter,
+ *      an error returned by a callback aborts the builtin
+ */
+var arrayBuiltins = map[string]*builtin{
+   "map": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "map(arr, fn): results of fn(el) for each element",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("map", args, object.ARRAY_OBJ, object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         result := object.NewArray(nil)
+         for _, el := range args[0].(*object.Array).Elements() {
+            mapped := in.Apply(args[1], el)
+            if isError(mapped) {
+               return mapped
+            }
+            result = result.Push(mapped)
+         }
+         return result
+      },
+   },
+   "filter": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "filter(arr, pred): elements for which pred(el) is truthy",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("filter", args, object.ARRAY_OBJ, object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         result := object.NewArray(nil)
+         for _, el := range args[0].(*object.Array).Elements() {
+            keep := in.Apply(args[1], el)
+            if isError(keep) {
+               return keep
+            }
+            if isTruthy(keep) {
+               result = result.Push(el)
+            }
+         }
+         return result
+      },
+   },
+   "reduce": &builtin{
+      MinArgs: 3, MaxArgs: 3,
+      Usage: "reduce(arr, initial, fn): folds the elements from the left with fn(acc, el)",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 3, 3); err != nil {
+            return err
+         }
+         initial := args[1] // any type
+         if err := checkArgumentTypes("reduce", args, object.ARRAY_OBJ, initial.Type(), object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         acc := initial
+         for _, el := range args[0].(*object.Array).Elements() {
+            acc = in.Apply(args[2], acc, el)
+            if isError(acc) {
+               return acc
+            }
+         }
+         return acc
+      },
+   },
+   "each": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "each(arr, fn): calls fn(el) for each element, returns null",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("each", args, object.ARRAY_OBJ, object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         for _, el := range args[0].(*object.Array).Elements() {
+            if result := in.Apply(args[1], el); isError(result) {
+               return result
+            }
+         }
+         return NULL
+      },
+   },
+   "find": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "find(arr, pred): first element for which pred(el) is truthy, null if none",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("find", args, object.ARRAY_OBJ, object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         for _, el := range args[0].(*object.Array).Elements() {
+            found := in.Apply(args[1], el)
+            if isError(found) {
+               return found
+            }
+            if isTruthy(found) {
+               return el
+            }
+         }
+         return NULL
+      },
+   },
+   "any": newQuantifierBuiltin("any", "any(arr, pred): whether pred(el) is truthy for some element", true),
+   "all": newQuantifierBuiltin("all", "all(arr, pred): whether pred(el) is truthy for every element", false),
+   "sort": &builtin{
+      MinArgs: 1, MaxArgs: 2,
+      Usage: "sort(arr[, less]): sorted copy of arr, in natural order or by less(a, b)",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 2); err != nil {
+            return err
+         }
+         if err := checkArgumentTypes("sort", args, object.ARRAY_OBJ, object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         elements := args[0].(*object.Array).Elements()
+         var err object.Object
+         less := func(a, b object.Object) bool {
+            if err != nil {
+               return false
+            }
+            if len(args) == 1 {
+               var result bool
+               result, err = compareObjects(a, b)
+               return result
+            }
+            result := in.Apply(args[1], a, b)
+            switch result := result.(type) {
+               case *object.Error:
+                  err = result
+               case *object.Boolean:
+                  return result.Value
+               case *object.Integer:
+                  return result.Value < 0
+               default:
+                  err = newError("comparator to `sort` must return BOOLEAN or INTEGER, got=%s", result.Type())
+            }
+            return false
+         }
+         sort.SliceStable(elements, func(i, j int) bool { return less(elements[i], elements[j]) })
+         if err != nil {
+            return err
+         }
+         return object.NewArray(elements)
+      },
+   },
+   "reverse": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "reverse(arr): elements in reverse order",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("reverse", args, object.ARRAY_OBJ); err != nil {
+            return err
+         }
+         elements := args[0].(*object.Array).Elements()
+         for i, j := 0, len(elements) - 1; i < j; i, j = i + 1, j - 1 {
+            elements[i], elements[j] = elements[j], elements[i]
+         }
+         return object.NewArray(elements)
+      },
+   },
+   "zip": &builtin{
+      MinArgs: 1, MaxArgs: -1,
+      Usage: "zip(arrs...): arrays of the elements at the same index, as long as the shortest array",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if len(args) == 0 {
+            return newError("wrong number of arguments. got=0, want=1..")
+         }
+         arrays := make([]*object.Array, len(args))
+         length := -1
+         for i, arg := range args {
+            array, ok := arg.(*object.Array)
+            if !ok {
+               return newError("argument type to `zip` not supported, got=%s, want=ARRAY", arg.Type())
+            }
+            arrays[i] = array
+            if length < 0 || array.Len() < length {
+               length = array.Len() // shortest array
+            }
+         }
+         result := object.NewArray(nil)
+         for i := 0; i < length; i++ {
+            tuple := make([]object.Object, len(arrays))
+            for j, array := range arrays {
+               tuple[j] = array.Get(i)
+            }
+            result = result.Push(object.NewArray(tuple))
+         }
+         return result
+      },
+   },
+   "flatten": &builtin{
+      MinArgs: 1, MaxArgs: 2,
+      Usage: "flatten(arr[, depth]): nested arrays spliced into arr, completely or depth levels deep",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 2); err != nil {
+            return err
+         }
+         if err := checkArgumentTypes("flatten", args, object.ARRAY_OBJ, object.INTEGER_OBJ); err != nil {
+            return err
+         }
+         depth := int64(-1) // flatten completely
+         if len(args) == 2 {
+            depth = args[1].(*object.Integer).Value
+         }
+         return flatten(object.NewArray(nil), args[0].(*object.Array), depth)
+      },
+   },
+   "range": &builtin{
+      MinArgs: 1, MaxArgs: 3,
+      Usage: "range([start, ]end[, step]): integers from start (0) up to end, exclusive",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 3); err != nil {
+            return err
+         }
+         if err := checkArgumentTypes("range", args, object.INTEGER_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ); err != nil {
+            return err
+         }
+         var start, end, step int64 = 0, args[0].(*object.Integer).Value, 1 // range(end)
+         if len(args) >= 2 { // range(start, end[, step])
+            start, end = end, args[1].(*object.Integer).Value
+         }
+         if len(args) == 3 {
+            step = args[2].(*object.Integer).Value
+         }
+         if step == 0 {
+            return newError("zero step to `range`")
+         }
+         count := rangeLength(start, end, step)
+         if count > maxRangeLength {
+            return newError("too many elements for `range`, got=%d", count)
+         }
+         result := object.NewArray(nil)
+         for i := uint64(0); i < count; i++ {
+            // wraps around in between, the element itself lies between start and end
+            result = result.Push(&object.Integer{Value: int64(uint64(start) + i * uint64(step))})
+         }
+         return result
+      },
+   },
+   "concat": &builtin{
+      MinArgs: 0, MaxArgs: -1,
+      Usage: "concat(arrs...): the elements of all arrays",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         result := object.NewArray(nil)
+         for _, arg := range args {
+            array, ok := arg.(*object.Array)
+            if !ok {
+               return newError("argument type to `concat` not supported, got=%s, want=ARRAY", arg.Type())
+            }
+            for _, el := range array.Elements() {
+               result = result.Push(el)
+            }
+         }
+         return result
+      },
+   },
+   "slice": &builtin{
+      MinArgs: 2, MaxArgs: 3,
+      Usage: "slice(arr, start[, end]): elements from start up to end, exclusive",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 2, 3); err != nil {
+            return err
+         }
+         if err := checkArgumentTypes("slice", args, object.ARRAY_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ); err != nil {
+            return err
+         }
+         array := args[0].(*object.Array)
+         start := clamp(args[1].(*object.Integer).Value, 0, int64(array.Len()))
+         end := int64(array.Len())
+         if len(args) == 3 {
+            end = clamp(args[2].(*object.Integer).Value, start, end)
+         }
+         result := object.NewArray(nil)
+         for i := start; i < end; i++ {
+            result = result.Push(array.Get(int(i)))
+         }
+         return result
+      },
+   },
+   "unique": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "unique(arr): elements without repetitions, first occurrences kept",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("unique", args, object.ARRAY_OBJ); err != nil {
+            return err
+         }
+         seen := make(map[object.HashKey]bool)
+         result := object.NewArray(nil)
+         for _, el := range args[0].(*object.Array).Elements() {
+            key, ok := el.(object.Hashable)
+            if !ok {
+               return newError("unusable as hash key: %s", el.Type())
+            }
+            if !seen[key.HashKey()] {
+               seen[key.HashKey()] = true
+               result = result.Push(el)
+            }
+         }
+         return result
+      },
+   },
+   "group_by": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "group_by(arr, fn): hash from fn(el) to the array of elements with that key",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("group_by", args, object.ARRAY_OBJ, object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         groups := object.NewHash()
+         for _, el := range args[0].(*object.Array).Elements() {
+            key := in.Apply(args[1], el)
+            if isError(key) {
+               return key
+            }
+            hashKey, ok := key.(object.Hashable)
+            if !ok {
+               return newError("unusable as hash key: %s", key.Type())
+            }
+            group := object.NewArray(nil)
+            if pair, ok := groups.Get(hashKey.HashKey()); ok {
+               group = pair.Value.(*object.Array)
+            }
+            groups = groups.Set(object.HashPair{Key: key, Value: group.Push(el)})
+         }
+         return groups
+      },
+   },
+}
+
+func init() {
+   registerBuiltins(arrayBuiltins)
+}
+
+// any(arr, pred) stops at the first truthy result, all(arr, pred) at the first falsy one
+func newQuantifierBuiltin(name, usage string, stopWhen bool) *builtin {
+   return &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: usage,
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments(name, args, object.ARRAY_OBJ, object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         for _, el := range args[0].(*object.Array).Elements() {
+            result := in.Apply(args[1], el)
+            if isError(result) {
+               return result
+            }
+            if isTruthy(result) == stopWhen {
+               return nativeBoolToBoolObject(stopWhen)
+            }
+         }
+         return nativeBoolToBoolObject(!stopWhen)
+      },
+   }
+}
+
+// natural order: integers and strings, each compared with their own kind
+func compareObjects(a, b object.Object) (bool, object.Object) {
+   switch {
+      case a.Type() == object.INTEGER_OBJ && b.Type() == object.INTEGER_OBJ:
+         return a.(*object.Integer).Value < b.(*object.Integer).Value, nil
+      case a.Type() == object.STRING_OBJ && b.Type() == object.STRING_OBJ:
+         return a.(*object.String).Value < b.(*object.String).Value, nil
+      default:
+         return false, newError("cannot compare %s and %s, pass a comparator to `sort`", a.Type(), b.Type())
+   }
+}
+
+func flatten(result, array *object.Array, depth int64) *object.Array {
+   for _, el := range array.Elements() {
+      if nested, ok := el.(*object.Array); ok && depth != 0 {
+         result = flatten(result, nested, depth - 1)
+      } else {
+         result = result.Push(el)
+      }
+   }
+   return result
+}
+
+// elements in a range, larger ranges are rejected instead of allocated
+const maxRangeLength = 50000000
+
+// number of elements of range(start, end, step), computed without overflow
+func rangeLength(start, end, step int64) uint64 {
+   var span, stride uint64
+   switch {
+      case step > 0 && start < end:
+         span, stride = uint64(end) - uint64(start), uint64(step)
+      case step < 0 && start > end:
+         span, stride = uint64(start) - uint64(end), -uint64(step)
+      default:
+         return 0
+   }
+   count := span / stride
+   if span % stride != 0 {
+      count++
+   }
+   return count
+}
@@ -0,0 +1,194 @@
+package evaluator
+
+import (
+   "bufio"
+   "errors"
+   "io/fs"
+   "monkey/object"
+)
+
+/*
+ * File builtins: read and write files of the interpreter's FileSystem
+ *    ~ paths are slash-separated and relative to the file system root, ".." cannot escape it
+ *    ~ read_lines and each_line split on "\n" (and "\r\n"), line endings are dropped
+ *    ~ every builtin fails when the interpreter has no FileSystem
+ */
+var fsBuiltins = map[string]*builtin{
+   "read_file": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "read_file(path): contents of a file",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkFileArguments(in, "read_file", args, object.STRING_OBJ); err != nil {
+            return err
+         }
+         data, err := fs.ReadFile(in.fs, args[0].(*object.String).Value)
+         if err != nil {
+            return newFileError("read_file", err)
+         }
+         return &object.String{Value: string(data)}
+      },
+   },
+   "write_file": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "write_file(path, str): writes str to a file, replacing its contents",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkFileArguments(in, "write_file", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+            return err
+         }
+         if err := in.fs.WriteFile(args[0].(*object.String).Value, []byte(args[1].(*object.String).Value)); err != nil {
+            return newFileError("write_file", err)
+         }
+         return NULL
+      },
+   },
+   "append_file": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "append_file(path, str): appends str to a file",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkFileArguments(in, "append_file", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+            return err
+         }
+         if err := in.fs.AppendFile(args[0].(*object.String).Value, []byte(args[1].(*object.String).Value)); err != nil {
+            return newFileError("append_file", err)
+         }
+         return NULL
+      },
+   },
+   "list_dir": &builtin{
+      MinArgs: 0, MaxArgs: 1,
+      Usage: "list_dir([dir]): sorted names in a directory, directories end in \"/\"",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 0, 1); err != nil {
+            return err
+         }
+         dir := "."
+         if len(args) == 1 {
+            if err := checkFileArguments(in, "list_dir", args, object.STRING_OBJ); err != nil {
+               return err
+            }
+            dir = args[0].(*object.String).Value
+         } else if in.fs == nil {
+            return newError("file system access disabled")
+         }
+         entries, err := fs.ReadDir(in.fs, dir)
+         if err != nil {
+            return newFileError("list_dir", err)
+         }
+         result := object.NewArray(nil)
+         for _, entry := range entries { // sorted by name, directories end in "/"
+            name := entry.Name()
+            if entry.IsDir() {
+               name += "/"
+            }
+            result = result.Push(&object.String{Value: name})
+         }
+         return result
+      },
+   },
+   "exists": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "exists(path): whether a file or directory exists",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkFileArguments(in, "exists", args, object.STRING_OBJ); err != nil {
+            return err
+         }
+         _, err := fs.Stat(in.fs, args[0].(*object.String).Value)
+         if errors.Is(err, fs.ErrNotExist) {
+            return FALSE
+         }
+         if err != nil {
+            return newFileError("exists", err)
+         }
+         return TRUE
+      },
+   },
+   "remove": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "remove(path): removes a file or an empty directory",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkFileArguments(in, "remove", args, object.STRING_OBJ); err != nil {
+            return err
+         }
+         if err := in.fs.Remove(args[0].(*object.String).Value); err != nil {
+            return newFileError("remove", err)
+         }
+         return NULL
+      },
+   },
+   "read_lines": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "read_lines(path): lines of a file",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkFileArguments(in, "read_lines", args, object.STRING_OBJ); err != nil {
+            return err
+         }
+         result := object.NewArray(nil)
+         err := scanLines(in.fs, "read_lines", args[0].(*object.String).Value, func(line string) object.Object {
+            result = result.Push(&object.String{Value: line})
+            return nil
+         })
+         if err != nil {
+            return err
+         }
+         return result
+      },
+   },
+   "each_line": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "each_line(path, fn): calls fn(line) for each line of a file",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkFileArguments(in, "each_line", args, object.STRING_OBJ, object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         err := scanLines(in.fs, "each_line", args[0].(*object.String).Value, func(line string) object.Object {
+            if result := in.Apply(args[1], &object.String{Value: line}); isError(result) {
+               return result
+            }
+            return nil
+         })
+         if err != nil {
+            return err
+         }
+         return NULL
+      },
+   },
+}
+
+func init() {
+   registerBuiltins(fsBuiltins)
+}
+
+func checkFileArguments(in *Interpreter, name string, args []object.Object, types ...object.ObjectType) *object.Error {
+   if err := checkArguments(name, args, types...); err != nil {
+      return err
+   }
+   if in.fs == nil {
+      return newError("file system access disabled")
+   }
+   return nil
+}
+
+func newFileError(name string, err error) *object.Error {
+   return newError("%s: %s", name, err)
+}
+
+// streams the lines of a file to fn, without reading the whole file, stops at the first error
+func scanLines(fsys FileSystem, caller, name string, fn func(line string) object.Object) object.Object {
+   f, err := fsys.Open(name)
+   if err != nil {
+      return newFileError(caller, err)
+   }
+   defer f.Close()
+
+   scanner := bufio.NewScanner(f)
+   scanner.Buffer(nil, 1 << 20)
+   for scanner.Scan() {
+      if result := fn(scanner.Text()); result != nil {
+         return result
+      }
+   }
+   if err := scanner.Err(); err != nil {
+      return newFileError(caller, err)
+   }
+   return nil
+}
@@ -0,0 +1,208 @@
+package evaluator
+
+import (
+   "monkey/object"
+)
+
+/*
+ * Hash builtins
+ *    ~ hashes are persistent, every builtin returns a new hash
+ *    ~ pairs are visited in insertion order
+ */
+var hashBuiltins = map[string]*builtin{
+   "keys": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "keys(hash): keys in insertion order",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("keys", args, object.HASH_OBJ); err != nil {
+            return err
+         }
+         result := object.NewArray(nil)
+         for _, pair := range args[0].(*object.Hash).Pairs() {
+            result = result.Push(pair.Key)
+         }
+         return result
+      },
+   },
+   "values": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "values(hash): values in insertion order",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("values", args, object.HASH_OBJ); err != nil {
+            return err
+         }
+         result := object.NewArray(nil)
+         for _, pair := range args[0].(*object.Hash).Pairs() {
+            result = result.Push(pair.Value)
+         }
+         return result
+      },
+   },
+   "entries": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "entries(hash): [key, value] pairs in insertion order",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("entries", args, object.HASH_OBJ); err != nil {
+            return err
+         }
+         result := object.NewArray(nil)
+         for _, pair := range args[0].(*object.Hash).Pairs() {
+            result = result.Push(object.NewArray([]object.Object{pair.Key, pair.Value}))
+         }
+         return result
+      },
+   },
+   "from_entries": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "from_entries(arr): hash of [key, value] pairs",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("from_entries", args, object.ARRAY_OBJ); err != nil {
+            return err
+         }
+         result := object.NewHash()
+         for _, el := range args[0].(*object.Array).Elements() {
+            entry, ok := el.(*object.Array)
+            if !ok || entry.Len() != 2 {
+               return newError("argument to `from_entries` must be an ARRAY of [key, value] pairs, got=%s", el.Inspect())
+            }
+            if _, ok := entry.Get(0).(object.Hashable); !ok {
+               return newError("unusable as hash key: %s", entry.Get(0).Type())
+            }
+            result = result.Set(object.HashPair{Key: entry.Get(0), Value: entry.Get(1)})
+         }
+         return result
+      },
+   },
+   "has": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "has(hash, key): whether hash contains key",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 2, 2); err != nil {
+            return err
+         }
+         if err := checkArgumentTypes("has", args, object.HASH_OBJ); err != nil {
+            return err
+         }
+         key, ok := args[1].(object.Hashable)
+         if !ok {
+            return newError("unusable as hash key: %s", args[1].Type())
+         }
+         _, found := args[0].(*object.Hash).Get(key.HashKey())
+         return nativeBoolToBoolObject(found)
+      },
+   },
+   "get": &builtin{
+      MinArgs: 2, MaxArgs: 3,
+      Usage: "get(hash, key[, default]): value of key, default (null) if missing",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 2, 3); err != nil {
+            return err
+         }
+         if err := checkArgumentTypes("get", args, object.HASH_OBJ); err != nil {
+            return err
+         }
+         key, ok := args[1].(object.Hashable)
+         if !ok {
+            return newError("unusable as hash key: %s", args[1].Type())
+         }
+         if pair, found := args[0].(*object.Hash).Get(key.HashKey()); found {
+            return pair.Value
+         }
+         if len(args) == 3 {
+            return args[2] // default
+         }
+         return NULL
+      },
+   },
+   "delete": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "delete(hash, key): hash without key",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 2, 2); err != nil {
+            return err
+         }
+         if err := checkArgumentTypes("delete", args, object.HASH_OBJ); err != nil {
+            return err
+         }
+         key, ok := args[1].(object.Hashable)
+         if !ok {
+            return newError("unusable as hash key: %s", args[1].Type())
+         }
+         return args[0].(*object.Hash).Delete(key.HashKey())
+      },
+   },
+   "merge": &builtin{
+      MinArgs: 0, MaxArgs: -1,
+      Usage: "merge(hashes...): pairs of all hashes, later hashes win",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         result := object.NewHash()
+         for _, arg := range args {
+            hash, ok := arg.(*object.Hash)
+            if !ok {
+               return newError("argument type to `merge` not supported, got=%s, want=HASH", arg.Type())
+            }
+            for _, pair := range hash.Pairs() { // later hashes win
+               result = result.Set(pair)
+            }
+         }
+         return result
+      },
+   },
+   "each_pair": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "each_pair(hash, fn): calls fn(key, value) for each pair, returns null",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("each_pair", args, object.HASH_OBJ, object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         for _, pair := range args[0].(*object.Hash).Pairs() {
+            if result := in.Apply(args[1], pair.Key, pair.Value); isError(result) {
+               return result
+            }
+         }
+         return NULL
+      },
+   },
+   "map_values": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "map_values(hash, fn): hash with each value replaced by fn(key, value)",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("map_values", args, object.HASH_OBJ, object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         result := object.NewHash()
+         for _, pair := range args[0].(*object.Hash).Pairs() {
+            mapped := in.Apply(args[1], pair.Key, pair.Value)
+            if isError(mapped) {
+               return mapped
+            }
+            result = result.Set(object.HashPair{Key: pair.Key, Value: mapped})
+         }
+         return result
+      },
+   },
+   "filter_pairs": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "filter_pairs(hash, pred): pairs for which pred(key, value) is truthy",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("filter_pairs", args, object.HASH_OBJ, object.FUNCTION_OBJ); err != nil {
+            return err
+         }
+         result := object.NewHash()
+         for _, pair := range args[0].(*object.Hash).Pairs() {
+            keep := in.Apply(args[1], pair.Key, pair.Value)
+            if isError(keep) {
+               return keep
+            }
+            if isTruthy(keep) {
+               result = result.Set(pair)
+            }
+         }
+         return result
+      },
+   },
+}
+
+func init() {
+   registerBuiltins(hashBuiltins)
+}
@@ -0,0 +1,225 @@
+package evaluator
+
+import (
+   "bytes"
+   "encoding/json"
+   "fmt"
+   "io"
+   "sort"
+   "strconv"
+   "strings"
+   "monkey/object"
+)
+
+/*
+ * JSON builtins
+ *    ~ json_parse(str): objects become hashes (in document order), arrays become arrays,
+ *      null becomes null; numbers must be integers (Monkey has no floats)
+ *    ~ json_stringify(value[, indent[, sort_keys]]): hashes need string keys,
+ *      functions and builtins cannot be encoded
+ *    ~ indent is a number of spaces or an indentation string
+ */
+var jsonBuiltins = map[string]*builtin{
+   "json_parse": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "json_parse(str): value of a JSON document",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("json_parse", args, object.STRING_OBJ); err != nil {
+            return err
+         }
+         input := args[0].(*object.String).Value
+         dec := json.NewDecoder(strings.NewReader(input))
+         dec.UseNumber()
+         value, err := decodeJSON(dec, input)
+         if err == nil {
+            offset := dec.InputOffset()
+            if _, trailing := dec.Token(); trailing != io.EOF {
+               err = &jsonError{msg: "unexpected data after top-level value", offset: skipJSONSpace(input, offset)}
+            }
+         }
+         if err != nil {
+            return newError("json_parse: %s", jsonErrorMessage(err, len(input)))
+         }
+         return value
+      },
+   },
+   "json_stringify": &builtin{
+      MinArgs: 1, MaxArgs: 3,
+      Usage: "json_stringify(value[, indent[, sort_keys]]): JSON encoding of value",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 3); err != nil {
+            return err
+         }
+         indent := ""
+         if len(args) >= 2 {
+            switch arg := args[1].(type) {
+               case *object.Integer:
+                  indent = strings.Repeat(" ", int(clamp(arg.Value, 0, 16)))
+               case *object.String:
+                  indent = arg.Value
+               default:
+                  return newError("argument type to `json_stringify` not supported, got=%s, want=INTEGER or STRING", arg.Type())
+            }
+         }
+         sortKeys := false
+         if len(args) == 3 {
+            sortKeys = isTruthy(args[2])
+         }
+
+         var out bytes.Buffer
+         if err := encodeJSON(&out, args[0], sortKeys); err != nil {
+            return err
+         }
+         if indent == "" {
+            return &object.String{Value: out.String()}
+         }
+         var indented bytes.Buffer
+         json.Indent(&indented, out.Bytes(), "", indent)
+         return &object.String{Value: indented.String()}
+      },
+   },
+}
+
+func init() {
+   registerBuiltins(jsonBuiltins)
+}
+
+type jsonError struct {
+   msg    string
+   offset int64
+}
+
+func (e *jsonError) Error() string { return e.msg }
+
+func jsonErrorMessage(err error, length int) string {
+   switch err := err.(type) {
+      case *jsonError:
+         return fmt.Sprintf("%s at offset %d", err.msg, err.offset)
+      case *json.SyntaxError: // Offset counts the offending byte
+         if err.Offset >= int64(length) {
+            return fmt.Sprintf("unexpected end of input at offset %d", length)
+         }
+         return fmt.Sprintf("%s at offset %d", err.Error(), err.Offset - 1)
+      default:
+         if err == io.EOF || err == io.ErrUnexpectedEOF {
+            return fmt.Sprintf("unexpected end of input at offset %d", length)
+         }
+         return err.Error()
+   }
+}
+
+func decodeJSON(dec *json.Decoder, input string) (object.Object, error) {
+   offset := dec.InputOffset()
+   tok, err := dec.Token()
+   if err != nil {
+      return nil, err
+   }
+
+   switch tok := tok.(type) {
+      case json.Delim:
+         if tok == '[' {
+            array := object.NewArray(nil)
+            for dec.More() {
+               el, err := decodeJSON(dec, input)
+               if err != nil {
+                  return nil, err
+               }
+               array = array.Push(el)
+            }
+            _, err := dec.Token() // ']'
+            return array, err
+         }
+         hash := object.NewHash() // '{'
+         for dec.More() {
+            key, err := dec.Token()
+            if err != nil {
+               return nil, err
+            }
+            value, err := decodeJSON(dec, input)
+            if err != nil {
+               return nil, err
+            }
+            hash = hash.Set(object.HashPair{Key: &object.String{Value: key.(string)}, Value: value})
+         }
+         _, err := dec.Token() // '}'
+         return hash, err
+      case json.Number:
+         value, err := strconv.ParseInt(string(tok), 10, 64)
+         if err != nil {
+            return nil, &jsonError{msg: fmt.Sprintf("number %s is not a 64-bit integer", tok), offset: skipJSONSpace(input, offset)}
+         }
+         return &object.Integer{Value: value}, nil
+      case string:
+         return &object.String{Value: tok}, nil
+      case bool:
+         return nativeBoolToBoolObject(tok), nil
+      default: // nil
+         return NULL, nil
+   }
+}
+
+// start of the token following offset (InputOffset points before separators)
+func skipJSONSpace(input string, offset int64) int64 {
+   for offset < int64(len(input)) && strings.IndexByte(" \t\r\n,:", input[offset]) >= 0 {
+      offset += 1
+   }
+   return offset
+}
+
+func encodeJSON(out *bytes.Buffer, obj object.Object, sortKeys bool) *object.Error {
+   switch obj := obj.(type) {
+      case *object.Integer:
+         out.WriteString(strconv.FormatInt(obj.Value, 10))
+      case *object.String:
+         encodeJSONString(out, obj.Value)
+      case *object.Boolean:
+         out.WriteString(strconv.FormatBool(obj.Value))
+      case *object.Null:
+         out.WriteString("null")
+      case *object.Array:
+         out.WriteString("[")
+         for i, el := range obj.Elements() {
+            if i > 0 {
+               out.WriteString(",")
+            }
+            if err := encodeJSON(out, el, sortKeys); err != nil {
+               return err
+            }
+         }
+         out.WriteString("]")
+      case *object.Hash:
+         pairs := obj.Pairs()
+         for _, pair := range pairs {
+            if pair.Key.Type() != object.STRING_OBJ {
+               return newError("json_stringify: hash key must be STRING, got=%s", pair.Key.Type())
+            }
+         }
+         if sortKeys {
+            sort.Slice(pairs, func(i, j int) bool {
+               return pairs[i].Key.(*object.String).Value < pairs[j].Key.(*object.String).Value
+            })
+         }
+         out.WriteString("{")
+         for i, pair := range pairs {
+            if i > 0 {
+               out.WriteString(",")
+            }
+            encodeJSONString(out, pair.Key.(*object.String).Value)
+            out.WriteString(":")
+            if err := encodeJSON(out, pair.Value, sortKeys); err != nil {
+               return err
+            }
+         }
+         out.WriteString("}")
+      default:
+         return newError("json_stringify: unsupported value type %s", obj.Type())
+   }
+   return nil
+}
+
+func encodeJSONString(out *bytes.Buffer, str string) {
+   enc := json.NewEncoder(out)
+   enc.SetEscapeHTML(false)
+   enc.Encode(str)
+   out.Truncate(out.Len() - 1) // Encode appends a newline
+}
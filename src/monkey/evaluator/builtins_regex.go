@@ -0,0 +1,233 @@
+package evaluator
+
+import (
+   "container/list"
+   "regexp"
+   "strings"
+   "sync"
+   "monkey/object"
+)
+
+/*
+ * Regex builtins: RE2 syntax (https://golang.org/s/re2syntax), matching is linear in the input
+ *    ~ patterns are regex literals (/a+b/i) or strings compiled by regex(str),
+ *      builtins taking a regex accept a pattern string as well
+ *    ~ captures are arrays [match, group 1, ..], unmatched groups are null
+ *    ~ replace(str, regex, replacement[, n]) expands $1 and ${name} in a replacement string,
+ *      a replacement function is called with the captures and returns the replacement string
+ *    ~ split(str, regex) splits around the matches
+ */
+var regexBuiltins = map[string]*builtin{
+   "regex": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "regex(str): compiled regex",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 1); err != nil {
+            return err
+         }
+         re, err := regexArgument("regex", args[0])
+         if err != nil {
+            return err
+         }
+         return re
+      },
+   },
+   "matches": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "matches(regex, str): whether regex matches somewhere in str",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         re, str, err := checkRegexArguments("matches", args)
+         if err != nil {
+            return err
+         }
+         return nativeBoolToBoolObject(re.Value.MatchString(str))
+      },
+   },
+   "match": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "match(regex, str): captures of the first match, null if none",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         re, str, err := checkRegexArguments("match", args)
+         if err != nil {
+            return err
+         }
+         loc := re.Value.FindStringSubmatchIndex(str)
+         if loc == nil {
+            return NULL
+         }
+         return newCaptures(str, loc)
+      },
+   },
+   "match_named": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "match_named(regex, str): hash of the named groups of the first match, null if none",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         re, str, err := checkRegexArguments("match_named", args)
+         if err != nil {
+            return err
+         }
+         loc := re.Value.FindStringSubmatchIndex(str)
+         if loc == nil {
+            return NULL
+         }
+         captures := newCaptures(str, loc)
+         result := object.NewHash()
+         for i, name := range re.Value.SubexpNames() {
+            if name != "" {
+               key := &object.String{Value: name}
+               result = result.Set(object.HashPair{Key: key, Value: captures.Get(i)})
+            }
+         }
+         return result
+      },
+   },
+   "find_all": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "find_all(regex, str): all matches",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         re, str, err := checkRegexArguments("find_all", args)
+         if err != nil {
+            return err
+         }
+         return newStringArray(re.Value.FindAllString(str, -1))
+      },
+   },
+   "scan": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "scan(regex, str): captures of all matches",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         re, str, err := checkRegexArguments("scan", args)
+         if err != nil {
+            return err
+         }
+         result := object.NewArray(nil)
+         for _, loc := range re.Value.FindAllStringSubmatchIndex(str, -1) {
+            result = result.Push(newCaptures(str, loc))
+         }
+         return result
+      },
+   },
+}
+
+func init() {
+   registerBuiltins(regexBuiltins)
+}
+
+// compiled regex of a REGEX or STRING argument
+func regexArgument(name string, arg object.Object) (*object.Regex, *object.Error) {
+   switch arg := arg.(type) {
+      case *object.Regex:
+         return arg, nil
+      case *object.String:
+         re, err := compileRegex(arg.Value)
+         if err != nil {
+            return nil, newError("%s: %s", name, err)
+         }
+         return re, nil
+      default:
+         return nil, newError("argument type to `%s` not supported, got=%s, want=REGEX or STRING", name, arg.Type())
+   }
+}
+
+// (regex, str) arguments
+func checkRegexArguments(name string, args []object.Object) (*object.Regex, string, *object.Error) {
+   if err := checkArgumentCount(args, 2, 2); err != nil {
+      return nil, "", err
+   }
+   re, err := regexArgument(name, args[0])
+   if err != nil {
+      return nil, "", err
+   }
+   if err := checkArgumentTypes(name, args[1:], object.STRING_OBJ); err != nil {
+      return nil, "", err
+   }
+   return re, args[1].(*object.String).Value, nil
+}
+
+// captures of a match given by submatch index pairs
+func newCaptures(str string, loc []int) *object.Array {
+   captures := make([]object.Object, len(loc) / 2)
+   for i := range captures {
+      if loc[2 * i] < 0 {
+         captures[i] = NULL
+      } else {
+         captures[i] = &object.String{Value: str[loc[2 * i]:loc[2 * i + 1]]}
+      }
+   }
+   return object.NewArray(captures)
+}
+
+// replace(str, regex, replacement[, n]), see the string builtin `replace`
+func regexReplace(in *Interpreter, args []object.Object) object.Object {
+   if err := checkArgumentTypes("replace", args, object.STRING_OBJ, object.REGEX_OBJ); err != nil {
+      return err
+   }
+   if len(args) == 4 {
+      if err := checkArgumentTypes("replace", args[3:], object.INTEGER_OBJ); err != nil {
+         return err
+      }
+   }
+   str := args[0].(*object.String).Value
+   re := args[1].(*object.Regex).Value
+   n := -1 // replace all
+   if len(args) == 4 {
+      n = int(args[3].(*object.Integer).Value)
+   }
+
+   var out strings.Builder
+   last := 0
+   for _, loc := range re.FindAllStringSubmatchIndex(str, n) {
+      out.WriteString(str[last:loc[0]])
+      switch replacement := args[2].(type) {
+         case *object.String:
+            out.Write(re.ExpandString(nil, replacement.Value, str, loc))
+         case *object.Function, *object.Builtin:
+            result := in.Apply(replacement, newCaptures(str, loc))
+            if isError(result) {
+               return result
+            }
+            if result.Type() != object.STRING_OBJ {
+               return newError("replacement function to `replace` must return STRING, got=%s", result.Type())
+            }
+            out.WriteString(result.(*object.String).Value)
+         default:
+            return newError("argument type to `replace` not supported, got=%s, want=STRING or FUNCTION", replacement.Type())
+      }
+      last = loc[1]
+   }
+   out.WriteString(str[last:])
+   return &object.String{Value: out.String()}
+}
+
+/*
+ * Regex cache: compiled patterns by source, shared by all interpreters
+ *    ~ least recently used patterns are evicted beyond regexCacheSize entries
+ */
+const regexCacheSize = 256
+
+var regexCache = struct {
+   sync.Mutex
+   entries map[string]*list.Element // of *object.Regex
+   lru     *list.List               // most recently used first
+}{entries: make(map[string]*list.Element), lru: list.New()}
+
+func compileRegex(pattern string) (*object.Regex, error) {
+   regexCache.Lock()
+   defer regexCache.Unlock()
+   if el, ok := regexCache.entries[pattern]; ok {
+      regexCache.lru.MoveToFront(el)
+      return el.Value.(*object.Regex), nil
+   }
+
+   compiled, err := regexp.Compile(pattern)
+   if err != nil {
+      return nil, err
+   }
+   re := &object.Regex{Value: compiled}
+   regexCache.entries[pattern] = regexCache.lru.PushFront(re)
+   if regexCache.lru.Len() > regexCacheSize {
+      oldest := regexCache.lru.Remove(regexCache.lru.Back()).(*object.Regex)
+      delete(regexCache.entries, oldest.Value.String())
+   }
+   return re, nil
+}
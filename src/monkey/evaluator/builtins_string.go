@@ -0,0 +1,278 @@
+package evaluator
+
+import (
+   "strings"
+   "unicode"
+   "unicode/utf8"
+   "monkey/object"
+)
+
+/*
+ * String builtins
+ *    ~ indices and lengths count characters (runes), not bytes
+ *    ~ strings are immutable, every builtin returns a new string
+ */
+// bytes in a string built by repeat or pad_left/pad_right (1 GiB)
+const maxStringLength = 1 << 30
+
+var stringBuiltins = map[string]*builtin{
+   "split": &builtin{
+      MinArgs: 1, MaxArgs: 2,
+      Usage: "split(str[, sep]): parts of str around sep (string or regex), around whitespace by default",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 2); err != nil {
+            return err
+         }
+         if len(args) == 2 && args[1].Type() == object.REGEX_OBJ {
+            if err := checkArgumentTypes("split", args, object.STRING_OBJ); err != nil {
+               return err
+            }
+            return newStringArray(args[1].(*object.Regex).Value.Split(args[0].(*object.String).Value, -1))
+         }
+         if err := checkArgumentTypes("split", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+            return err
+         }
+         str := args[0].(*object.String).Value
+         if len(args) == 1 {
+            return newStringArray(strings.Fields(str)) // split on whitespace
+         }
+         return newStringArray(strings.Split(str, args[1].(*object.String).Value))
+      },
+   },
+   "join": &builtin{
+      MinArgs: 1, MaxArgs: 2,
+      Usage: "join(arr[, sep]): elements joined by sep (\"\" by default)",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 2); err != nil {
+            return err
+         }
+         if err := checkArgumentTypes("join", args, object.ARRAY_OBJ, object.STRING_OBJ); err != nil {
+            return err
+         }
+         sep := ""
+         if len(args) == 2 {
+            sep = args[1].(*object.String).Value
+         }
+         elements := args[0].(*object.Array).Elements()
+         strs := make([]string, len(elements))
+         for i, el := range elements {
+            str, ok := el.(*object.String)
+            if !ok {
+               return newError("argument type to `join` not supported, got=ARRAY of %s, want=ARRAY of STRING", el.Type())
+            }
+            strs[i] = str.Value
+         }
+         return &object.String{Value: strings.Join(strs, sep)}
+      },
+   },
+   "trim": newTrimBuiltin("trim", "trim(str[, cutset]): str without surrounding whitespace, or characters of cutset", strings.TrimFunc, strings.Trim),
+   "trim_left": newTrimBuiltin("trim_left", "trim_left(str[, cutset]): str without leading whitespace, or characters of cutset", strings.TrimLeftFunc, strings.TrimLeft),
+   "trim_right": newTrimBuiltin("trim_right", "trim_right(str[, cutset]): str without trailing whitespace, or characters of cutset", strings.TrimRightFunc, strings.TrimRight),
+   "upper": newStringMapBuiltin("upper", "upper(str): str in upper case", strings.ToUpper),
+   "lower": newStringMapBuiltin("lower", "lower(str): str in lower case", strings.ToLower),
+   "replace": &builtin{
+      MinArgs: 3, MaxArgs: 4,
+      Usage: "replace(str, old, new[, n]): str with old (string or regex) replaced by new (string or function)",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 3, 4); err != nil {
+            return err
+         }
+         if args[1].Type() == object.REGEX_OBJ {
+            return regexReplace(in, args)
+         }
+         if err := checkArgumentTypes("replace", args, object.STRING_OBJ, object.STRING_OBJ, object.STRING_OBJ, object.INTEGER_OBJ); err != nil {
+            return err
+         }
+         n := -1 // replace all
+         if len(args) == 4 {
+            n = int(args[3].(*object.Integer).Value)
+         }
+         str := args[0].(*object.String).Value
+         old := args[1].(*object.String).Value
+         new := args[2].(*object.String).Value
+         return &object.String{Value: strings.Replace(str, old, new, n)}
+      },
+   },
+   "contains": newStringPredicateBuiltin("contains", "contains(str, substr): whether substr occurs in str", strings.Contains),
+   "starts_with": newStringPredicateBuiltin("starts_with", "starts_with(str, prefix): whether str begins with prefix", strings.HasPrefix),
+   "ends_with": newStringPredicateBuiltin("ends_with", "ends_with(str, suffix): whether str ends with suffix", strings.HasSuffix),
+   "index_of": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "index_of(str, substr): index of the first occurrence of substr, -1 if none",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("index_of", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+            return err
+         }
+         str := args[0].(*object.String).Value
+         idx := strings.Index(str, args[1].(*object.String).Value)
+         if idx < 0 {
+            return &object.Integer{Value: -1}
+         }
+         return &object.Integer{Value: int64(utf8.RuneCountInString(str[:idx]))}
+      },
+   },
+   "repeat": &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: "repeat(str, n): str repeated n times",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("repeat", args, object.STRING_OBJ, object.INTEGER_OBJ); err != nil {
+            return err
+         }
+         str := args[0].(*object.String).Value
+         count := args[1].(*object.Integer).Value
+         if count < 0 {
+            return newError("negative count to `repeat`, got=%d", count)
+         }
+         if len(str) > 0 && count > maxStringLength / int64(len(str)) {
+            return newError("count too large to `repeat`, got=%d", count)
+         }
+         return &object.String{Value: strings.Repeat(str, int(count))}
+      },
+   },
+   "substr": &builtin{
+      MinArgs: 2, MaxArgs: 3,
+      Usage: "substr(str, start[, length]): characters from start, up to length of them",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 2, 3); err != nil {
+            return err
+         }
+         if err := checkArgumentTypes("substr", args, object.STRING_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ); err != nil {
+            return err
+         }
+         runes := []rune(args[0].(*object.String).Value)
+         start := clamp(args[1].(*object.Integer).Value, 0, int64(len(runes)))
+         end := int64(len(runes))
+         if len(args) == 3 {
+            length := args[2].(*object.Integer).Value
+            if length > end - start { // start + length might overflow
+               length = end - start
+            }
+            end = clamp(start + length, start, end)
+         }
+         return &object.String{Value: string(runes[start:end])}
+      },
+   },
+   "chars": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "chars(str): characters of str",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments("chars", args, object.STRING_OBJ); err != nil {
+            return err
+         }
+         chars := []string{}
+         for _, r := range args[0].(*object.String).Value {
+            chars = append(chars, string(r))
+         }
+         return newStringArray(chars)
+      },
+   },
+   "pad_left": newPadBuiltin("pad_left", "pad_left(str, width[, padding]): str padded at the front up to width characters", func(str, padding string) string { return padding + str }),
+   "pad_right": newPadBuiltin("pad_right", "pad_right(str, width[, padding]): str padded at the end up to width characters", func(str, padding string) string { return str + padding }),
+}
+
+func init() {
+   registerBuiltins(stringBuiltins)
+}
+
+func newStringArray(strs []string) *object.Array {
+   elements := make([]object.Object, len(strs))
+   for i, str := range strs {
+      elements[i] = &object.String{Value: str}
+   }
+   return object.NewArray(elements)
+}
+
+func clamp(value, min, max int64) int64 {
+   if value < min {
+      return min
+   }
+   if value > max {
+      return max
+   }
+   return value
+}
+
+// trim(str) removes surrounding whitespace, trim(str, cutset) the given characters
+func newTrimBuiltin(name, usage string, trimSpace func(string, func(rune) bool) string, trimCutset func(string, string) string) *builtin {
+   return &builtin{
+      MinArgs: 1, MaxArgs: 2,
+      Usage: usage,
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 2); err != nil {
+            return err
+         }
+         if err := checkArgumentTypes(name, args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+            return err
+         }
+         str := args[0].(*object.String).Value
+         if len(args) == 1 {
+            return &object.String{Value: trimSpace(str, unicode.IsSpace)}
+         }
+         return &object.String{Value: trimCutset(str, args[1].(*object.String).Value)}
+      },
+   }
+}
+
+func newStringMapBuiltin(name, usage string, fn func(string) string) *builtin {
+   return &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: usage,
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments(name, args, object.STRING_OBJ); err != nil {
+            return err
+         }
+         return &object.String{Value: fn(args[0].(*object.String).Value)}
+      },
+   }
+}
+
+func newStringPredicateBuiltin(name, usage string, pred func(string, string) bool) *builtin {
+   return &builtin{
+      MinArgs: 2, MaxArgs: 2,
+      Usage: usage,
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArguments(name, args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+            return err
+         }
+         return nativeBoolToBoolObject(pred(args[0].(*object.String).Value, args[1].(*object.String).Value))
+      },
+   }
+}
+
+// pad_left(str, width[, padding]) pads str up to width characters (padding defaults to " ")
+func newPadBuiltin(name, usage string, pad func(str, padding string) string) *builtin {
+   return &builtin{
+      MinArgs: 2, MaxArgs: 3,
+      Usage: usage,
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 2, 3); err != nil {
+            return err
+         }
+         if err := checkArgumentTypes(name, args, object.STRING_OBJ, object.INTEGER_OBJ, object.STRING_OBJ); err != nil {
+            return err
+         }
+         str := args[0].(*object.String).Value
+         width := args[1].(*object.Integer).Value
+         padding := []rune(" ")
+         if len(args) == 3 {
+            padding = []rune(args[2].(*object.String).Value)
+         }
+         if len(padding) == 0 {
+            return newError("empty padding to `%s`", name)
+         }
+         length := int64(utf8.RuneCountInString(str))
+         if width <= length {
+            return args[0]
+         }
+         missing := width - length
+         if missing > maxStringLength / utf8.UTFMax {
+            return newError("width too large to `%s`, got=%d", name, width)
+         }
+         fill := make([]rune, missing)
+         for i := range fill {
+            fill[i] = padding[i % len(padding)]
+         }
+         return &object.String{Value: pad(str, string(fill))}
+      },
+   }
+}
@@ -0,0 +1,124 @@
+package evaluator
+
+import (
+   "strconv"
+   "strings"
+   "monkey/object"
+)
+
+/*
+ * Type builtins: introspection and conversion
+ *    ~ type(x) is the ObjectType name, as used in error messages
+ *    ~ is_function holds for Monkey functions and builtins alike
+ */
+var typeBuiltins = map[string]*builtin{
+   "type": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "type(x): type name of x, e.g. \"INTEGER\"",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 1); err != nil {
+            return err
+         }
+         return &object.String{Value: string(args[0].Type())}
+      },
+   },
+   "is_int": newTypePredicateBuiltin("is_int(x): whether x is an integer", object.INTEGER_OBJ),
+   "is_string": newTypePredicateBuiltin("is_string(x): whether x is a string", object.STRING_OBJ),
+   "is_bool": newTypePredicateBuiltin("is_bool(x): whether x is a boolean", object.BOOLEAN_OBJ),
+   "is_null": newTypePredicateBuiltin("is_null(x): whether x is null", object.NULL_OBJ),
+   "is_array": newTypePredicateBuiltin("is_array(x): whether x is an array", object.ARRAY_OBJ),
+   "is_hash": newTypePredicateBuiltin("is_hash(x): whether x is a hash", object.HASH_OBJ),
+   "is_function": newTypePredicateBuiltin("is_function(x): whether x is a function or builtin", object.FUNCTION_OBJ, object.BUILTIN_OBJ),
+   "is_builtin": newTypePredicateBuiltin("is_builtin(x): whether x is a builtin", object.BUILTIN_OBJ),
+   "is_regex": newTypePredicateBuiltin("is_regex(x): whether x is a regex", object.REGEX_OBJ),
+   "str": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "str(x): string representation of x",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 1); err != nil {
+            return err
+         }
+         if str, ok := args[0].(*object.String); ok {
+            return str
+         }
+         return &object.String{Value: args[0].Inspect()}
+      },
+   },
+   "int": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "int(x): x converted to an integer",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 1); err != nil {
+            return err
+         }
+         switch arg := args[0].(type) {
+            case *object.Integer:
+               return arg
+            case *object.String:
+               value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+               if err != nil {
+                  return newError("could not parse %q as integer", arg.Value)
+               }
+               return &object.Integer{Value: value}
+            case *object.Boolean:
+               if arg.Value {
+                  return &object.Integer{Value: 1}
+               }
+               return &object.Integer{Value: 0}
+            default:
+               return newError("argument type to `int` not supported, got=%s", arg.Type())
+         }
+      },
+   },
+   "bool": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "bool(x): whether x is truthy",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 1); err != nil {
+            return err
+         }
+         return nativeBoolToBoolObject(isTruthy(args[0]))
+      },
+   },
+   "array": &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: "array(x): characters of a string, [key, value] pairs of a hash",
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 1); err != nil {
+            return err
+         }
+         switch arg := args[0].(type) {
+            case *object.Array:
+               return arg
+            case *object.String: // characters
+               return in.Apply(in.builtins["chars"], arg)
+            case *object.Hash: // [key, value] pairs
+               return in.Apply(in.builtins["entries"], arg)
+            default:
+               return newError("argument type to `array` not supported, got=%s", arg.Type())
+         }
+      },
+   },
+}
+
+func init() {
+   registerBuiltins(typeBuiltins)
+}
+
+func newTypePredicateBuiltin(usage string, types ...object.ObjectType) *builtin {
+   return &builtin{
+      MinArgs: 1, MaxArgs: 1,
+      Usage: usage,
+      Fn: func(in *Interpreter, args ...object.Object) object.Object {
+         if err := checkArgumentCount(args, 1, 1); err != nil {
+            return err
+         }
+         for _, tt := range types {
+            if args[0].Type() == tt {
+               return TRUE
+            }
+         }
+         return FALSE
+      },
+   }
+}
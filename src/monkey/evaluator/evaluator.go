@@ -2,6 +2,9 @@ package evaluator
 
 import (
    "fmt"
+   "io"
+   "os"
+   "sort"
    "monkey/ast"
    "monkey/object"
 )
@@ -13,97 +16,190 @@ var (
 )
 
 /*
- * Tree-Walking Interpreter
- *    ~ recursively interpret AST "on the fly", without any preprocessing or compilation step.
+ * Interpreter: evaluation state shared by builtins
+ *    ~ builtins are bound to the interpreter, so they can call back into Monkey functions
+ *    ~ configured through options, e.g. New(WithFileSystem(fsys))
  */
+type Interpreter struct {
+   builtins map[string]*object.Builtin
+   fs        FileSystem    // nil: file access disabled
+   out       io.Writer     // of puts, os.Stdout by default
+   hooks     []Hooks       // see hooks.go
+   tracer    *Tracer       // set by SetTracer, one of hooks
+   lastError *object.Error // last error passed to hooks
+}
+
+type Option func(in *Interpreter)
+
+// files visible to the file builtins
+func WithFileSystem(fsys FileSystem) Option {
+   return func(in *Interpreter) {
+      in.fs = fsys
+   }
+}
+
+// output of puts
+func WithOutput(w io.Writer) Option {
+   return func(in *Interpreter) {
+      in.out = w
+   }
+}
+
+// trace calls and their results to w (see Tracer)
+func WithTracer(w io.Writer) Option {
+   return func(in *Interpreter) {
+      in.SetTracer(w)
+   }
+}
+
+func New(options ...Option) *Interpreter {
+   in := &Interpreter{builtins: make(map[string]*object.Builtin), out: os.Stdout}
+   for _, option := range options {
+      option(in)
+   }
+   for name, b := range builtins {
+      fn := b.Fn
+      in.builtins[name] = &object.Builtin{
+         Name: name,
+         Fn: func(args ...object.Object) object.Object { return fn(in, args...) },
+      }
+   }
+   return in
+}
+
+// w == nil disables tracing
+func (in *Interpreter) SetTracer(w io.Writer) {
+   if in.tracer != nil {
+      in.RemoveHooks(in.tracer)
+      in.tracer = nil
+   }
+   if w != nil {
+      in.tracer = NewTracer(w)
+      in.AddHooks(in.tracer)
+   }
+}
+
+// names of the interpreter's builtins in alphabetical order
+func (in *Interpreter) BuiltinNames() []string {
+   names := make([]string, 0, len(in.builtins))
+   for name := range in.builtins {
+      names = append(names, name)
+   }
+   sort.Strings(names)
+   return names
+}
+
+// evaluate node with a fresh interpreter
 func Eval(node ast.Node, env *object.Environment) object.Object {
+   return New().Eval(node, env)
+}
+
+/*
+ * Tree-Walking Interpreter
+ *    ~ recursively interpret AST "on the fly", without any compilation step.
+ *    ~ identifiers must be annotated with lexical addresses by a Resolver first.
+ */
+func (in *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
+   if len(in.hooks) == 0 {
+      return in.eval(node, env)
+   }
+   return in.evalHooked(node, env)
+}
+
+func (in *Interpreter) eval(node ast.Node, env *object.Environment) object.Object {
    switch node := node.(type) {
       // Statements
       case *ast.Program:
-         return evalProgram(node, env)
+         return in.evalProgram(node, env)
       case *ast.LetStatement:
-         value := Eval(node.Value, env) // note: lexical scope
+         value := in.Eval(node.Value, env) // note: lexical scope
          if isError(value) {
             return value
          }
-         env.Set(node.Name.Value, value) // note: identifier added to function's environment
+         env.Set(node.Name.Address.Slot, node.Name.Value, value) // note: identifier added to function's environment
       case *ast.ReturnStatement:
-         value := Eval(node.ReturnValue, env)
+         value := in.Eval(node.ReturnValue, env)
          if isError(value) {
             return value
          }
          return &object.ReturnValue{Value: value}
       case *ast.ExpressionStatement:
-         return Eval(node.Expression, env)
+         return in.Eval(node.Expression, env)
       case *ast.BlockStatement:
-         return evalBlockStatement(node, env)
+         return in.evalBlockStatement(node, env)
       // Expressions
       case *ast.PrefixExpression:
-         right := Eval(node.Right, env)
+         right := in.Eval(node.Right, env)
          if isError(right) {
             return right
          }
          return evalPrefixExpression(node.Operator, right)
       case *ast.InfixExpression:
-         left := Eval(node.Left, env)
+         left := in.Eval(node.Left, env)
          if isError(left) {
             return left
          }
-         right := Eval(node.Right, env)
+         right := in.Eval(node.Right, env)
          if isError(right) {
             return right
          }
          return evalInfixExpression(node.Operator, left, right)
       case *ast.IfExpression:
-         return evalIfExpression(node, env)
+         return in.evalIfExpression(node, env)
       case *ast.FunctionLiteral:
          params := node.Parameters
          body := node.Body
-         return &object.Function{Parameters: params, Body: body, Env: env}
+         return &object.Function{Parameters: params, Body: body, Locals: node.Locals, Env: env}
       case *ast.CallExpression:
-         function := Eval(node.Function, env)
+         function := in.Eval(node.Function, env)
          if isError(function) {
             return function
          }
-         args := evalExpressions(node.Arguments, env)
+         args := in.evalExpressions(node.Arguments, env)
          if len(args) == 1 && isError(args[0]) {
             return args[0]
          }
-         return applyFunction(function, args) 
+         return in.call(node, function, args)
       case *ast.Identifier:
-         return evalIdentifier(node, env)
+         return in.evalIdentifier(node, env)
       case *ast.IntegerLiteral:
          return &object.Integer{Value: node.Value} // self-evaluating expression
       case *ast.StringLiteral:
          return &object.String{Value: node.Value}  // self-evaluating expression
       case *ast.Boolean:
          return nativeBoolToBoolObject(node.Value) // self-evaluating expression
+      case *ast.RegexLiteral:
+         re, err := compileRegex(node.Value) // validated by the parser
+         if err != nil {
+            return newError("%s", err)
+         }
+         return re
       case *ast.ArrayLiteral:
-         elements := evalExpressions(node.Elements, env)
+         elements := in.evalExpressions(node.Elements, env)
          if len(elements) == 1 && isError(elements[0]) {
             return elements[0]
          }
-         return &object.Array{Elements: elements}
+         return object.NewArray(elements)
       case *ast.IndexExpression:
-         left := Eval(node.Left, env)
+         left := in.Eval(node.Left, env)
          if isError(left) {
             return left
          }
-         index := Eval(node.Index, env)
+         index := in.Eval(node.Index, env)
          if isError(index) {
             return index
          }
          return evalIndexExpression(left, index)
       case *ast.HashLiteral:
-         return evalHashLiteral(node, env)
+         return in.evalHashLiteral(node, env)
    }
    return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (in *Interpreter) evalProgram(program *ast.Program, env *object.Environment) object.Object {
    var result object.Object
    for _, stmt := range program.Statements {
-      result = Eval(stmt, env)
+      result = in.Eval(stmt, env)
       switch result := result.(type) {
          case *object.ReturnValue:
             return result.Value
@@ -114,11 +210,11 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
    return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (in *Interpreter) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
    var result object.Object
 
    for _, stmt := range block.Statements {
-      result = Eval(stmt, env)
+      result = in.Eval(stmt, env)
 
       switch result := result.(type) {
          case *object.ReturnValue:
@@ -131,11 +227,11 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
    return result
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (in *Interpreter) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
    var result []object.Object
 
    for _, exp := range exps {
-      evaluated := Eval(exp, env)
+      evaluated := in.Eval(exp, env)
       if isError(evaluated) {
          return []object.Object{evaluated}
       }
@@ -204,6 +300,10 @@ func evalInfixStringExpression(op string, left, right object.Object) object.Obje
    switch op {
       case "+":
          return &object.String{Value: leftVal + rightVal}
+      case "==":
+         return nativeBoolToBoolObject(leftVal == rightVal)
+      case "!=":
+         return nativeBoolToBoolObject(leftVal != rightVal)
       default:
          return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
    }
@@ -227,15 +327,15 @@ func evalInfixBooleanExpression(op string, left, right object.Object) object.Obj
    }
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-   condition := Eval(ie.Condition, env)
+func (in *Interpreter) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+   condition := in.Eval(ie.Condition, env)
    if isError(condition) {
       return condition
    }
    if isTruthy(condition) {
-      return Eval(ie.Consequence, env)
+      return in.Eval(ie.Consequence, env)
    } else if ie.Alternative != nil {
-      return Eval(ie.Alternative, env)
+      return in.Eval(ie.Alternative, env)
    } else {
       return NULL
    }
@@ -277,11 +377,19 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
    return &object.Integer{Value: -value}
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// Apply calls a Monkey function or builtin (e.g. on behalf of a builtin taking a callback)
+func (in *Interpreter) Apply(fn object.Object, args ...object.Object) object.Object {
+   return in.call(nil, fn, args)
+}
+
+func (in *Interpreter) applyFunction(fn object.Object, args []object.Object) object.Object {
    switch fn := fn.(type) {
    case *object.Function:
+      if len(args) != len(fn.Parameters) {
+         return newError("wrong number of arguments. got=%d, want=%d", len(args), len(fn.Parameters))
+      }
       extendedEnv := extendFunctionEnv(fn, args)
-      evaluated := Eval(fn.Body, extendedEnv)
+      evaluated := in.Eval(fn.Body, extendedEnv)
       return unwrapReturnValue(evaluated) // implicit return (last statement)
    case *object.Builtin:
       return fn.Fn(args...)
@@ -291,9 +399,9 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 }
 
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-   env := object.NewExtendedEnvironment(fn.Env)
+   env := object.NewExtendedEnvironment(fn.Env, fn.Locals)
    for paramIdx, param := range fn.Parameters {
-      env.Set(param.Value, args[paramIdx])
+      env.Set(param.Address.Slot, param.Value, args[paramIdx])
    }
    return env
 }
@@ -309,6 +417,8 @@ func evalIndexExpression(left, index object.Object) object.Object {
    switch {
       case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
          return evalArrayIndexExpression(left, index)
+      case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+         return evalStringIndexExpression(left, index)
       case left.Type() == object.HASH_OBJ:
          return evalHashIndexExpression(left, index)
       default:
@@ -319,11 +429,27 @@ func evalIndexExpression(left, index object.Object) object.Object {
 func evalArrayIndexExpression(left, index object.Object) object.Object {
    array := left.(*object.Array)
    idx := index.(*object.Integer).Value
-   max := int64(len(array.Elements) - 1)
+   max := int64(array.Len() - 1)
    if idx < 0 || idx > max {
       return NULL
    }
-   return array.Elements[idx]
+   return array.Get(int(idx))
+}
+
+// indexes characters (runes), not bytes
+func evalStringIndexExpression(left, index object.Object) object.Object {
+   str := left.(*object.String).Value
+   idx := index.(*object.Integer).Value
+   if idx < 0 {
+      return NULL
+   }
+   for _, r := range str {
+      if idx == 0 {
+         return &object.String{Value: string(r)}
+      }
+      idx -= 1
+   }
+   return NULL
 }
 
 func evalHashIndexExpression(left, index object.Object) object.Object {
@@ -332,42 +458,42 @@ func evalHashIndexExpression(left, index object.Object) object.Object {
    if !ok {
       return newError("unusable as hash key: %s", index.Type())
    }
-   pair, ok := hash.Pairs[key.HashKey()]
+   pair, ok := hash.Get(key.HashKey())
    if !ok {
       return NULL
    }
    return pair.Value
 }
 
-func evalIdentifier(id *ast.Identifier, env *object.Environment) object.Object {
-   if value, ok := env.Get(id.Value); ok {
-      return value
+func (in *Interpreter) evalIdentifier(id *ast.Identifier, env *object.Environment) object.Object {
+   for addr := id.Address; addr != nil; addr = addr.Outer {
+      if value, ok := env.Get(addr.Depth, addr.Slot); ok {
+         return value
+      }
    }
-   if builtin, ok := builtins[id.Value]; ok {
+   if builtin, ok := in.builtins[id.Value]; ok {
       return builtin
    }
-   return newError("identifier not found: " + id.Value)
+   return newError("identifier not found: %s", id.Value)
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-   pairs := make(map[object.HashKey]object.HashPair)
-   for nodeKey, nodeValue := range node.Pairs {
-      key := Eval(nodeKey, env)
+func (in *Interpreter) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+   hash := object.NewHash()
+   for _, nodeKey := range node.Keys {
+      key := in.Eval(nodeKey, env)
       if isError(key) {
          return key
       }
-      hashKey, ok := key.(object.Hashable) // cast to interface
-      if !ok {
+      if _, ok := key.(object.Hashable); !ok { // cast to interface
          return newError("unusable as hash key: %s", key.Type())
       }
-      value := Eval(nodeValue, env)
+      value := in.Eval(node.Pairs[nodeKey], env)
       if isError(value) {
          return value
       }
-      hashed := hashKey.HashKey()
-      pairs[hashed] = object.HashPair{Key: key, Value: value}
+      hash = hash.Set(object.HashPair{Key: key, Value: value})
    }
-   return &object.Hash{Pairs: pairs}
+   return hash
 }
 
 func nativeBoolToBoolObject(input bool) *object.Boolean {
@@ -1,6 +1,13 @@
 package evaluator
 
 import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
@@ -59,12 +66,12 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
-      {"true || false", true},
-      {"true || true", true},
-      {"false || false", false},
-      {"true && false", false},
-      {"true && true", true},
-      {"false && false", false},
+		{"true || false", true},
+		{"true || true", true},
+		{"false || false", false},
+		{"true && false", false},
+		{"true && true", true},
+		{"false && false", false},
 	}
 
 	for _, tt := range tests {
@@ -215,14 +222,14 @@ if (10 > 1) {
 			"foobar",
 			"identifier not found: foobar",
 		},
-      {
+		{
 			`999[1]`,
 			"index operator not supported: INTEGER",
 		},
-      {
-         `{"name": "Monkey"}[fn(x) { x }];`,
-         "unusable as hash key: FUNCTION",
-      },
+		{
+			`{"name": "Monkey"}[fn(x) { x }];`,
+			"unusable as hash key: FUNCTION",
+		},
 	}
 
 	for _, tt := range tests {
@@ -301,13 +308,13 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
-func TestClosures(t *testing.T) { 
-   input := `
+func TestClosures(t *testing.T) {
+	input := `
 let newAdder = fn(x) {
    fn(y) { x + y };
 };
 let addTwo = newAdder(2); addTwo(2);`
-   testIntegerObject(t, testEval(input), 4)
+	testIntegerObject(t, testEval(input), 4)
 }
 
 func TestStringLiteral(t *testing.T) {
@@ -387,14 +394,14 @@ func TestBuiltinFunctions(t *testing.T) {
 				continue
 			}
 
-			if len(array.Elements) != len(expected) {
+			if array.Len() != len(expected) {
 				t.Errorf("wrong num of elements. want=%d, got=%d",
-					len(expected), len(array.Elements))
+					len(expected), array.Len())
 				continue
 			}
 
 			for i, expectedElem := range expected {
-				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+				testIntegerObject(t, array.Get(i), int64(expectedElem))
 			}
 		}
 	}
@@ -463,13 +470,13 @@ func TestArrayLiterals(t *testing.T) {
 		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	if len(result.Elements) != 3 {
-		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	if result.Len() != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", result.Len())
 	}
 
-	testIntegerObject(t, result.Elements[0], 1)
-	testIntegerObject(t, result.Elements[1], 4)
-	testIntegerObject(t, result.Elements[2], 6)
+	testIntegerObject(t, result.Get(0), 1)
+	testIntegerObject(t, result.Get(1), 4)
+	testIntegerObject(t, result.Get(2), 6)
 }
 
 func TestArrayIndexExpressions(t *testing.T) {
@@ -556,12 +563,12 @@ func TestHashLiterals(t *testing.T) {
 		FALSE.HashKey():                            6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
 	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+		pair, ok := result.Get(expectedKey)
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
@@ -616,11 +623,705 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"monkey"[0]`, "m"},
+		{`"monkey"[5]`, "y"},
+		{`let s = "monkey"; s[1 + 1]`, "n"},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[2]`, "語"},
+		{`"monkey"[6]`, nil},
+		{`"monkey"[-1]`, nil},
+		{`""[0]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if str, ok := tt.expected.(string); ok {
+			testStringObject(t, evaluated, str)
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("héllo")`, 5},
+		{`split("a,b,,c", ",")`, []string{"a", "b", "", "c"}},
+		{`split("  one two	three ")`, []string{"one", "two", "three"}},
+		{`split("été", "")`, []string{"é", "t", "é"}},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`join(["a", "b"])`, "ab"},
+		{`join([], "-")`, ""},
+		{"trim(\"  monkey \t\n\")", "monkey"},
+		{`trim("x!monkey!x", "x!")`, "monkey"},
+		{`trim_left("  monkey  ")`, "monkey  "},
+		{`trim_right("  monkey  ")`, "  monkey"},
+		{`trim_right("monkey!!", "!")`, "monkey"},
+		{`upper("héllo")`, "HÉLLO"},
+		{`lower("MONKEY É")`, "monkey é"},
+		{`replace("banana", "a", "o")`, "bonono"},
+		{`replace("banana", "a", "o", 2)`, "bonona"},
+		{`contains("monkey", "key")`, true},
+		{`contains("monkey", "donkey")`, false},
+		{`starts_with("monkey", "mon")`, true},
+		{`starts_with("monkey", "key")`, false},
+		{`ends_with("monkey", "key")`, true},
+		{`index_of("héllo", "llo")`, 2},
+		{`index_of("monkey", "z")`, -1},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", 0)`, ""},
+		{`substr("héllo", 1, 3)`, "éll"},
+		{`substr("monkey", 3)`, "key"},
+		{`substr("monkey", 4, 10)`, "ey"},
+		{`substr("monkey", 10)`, ""},
+		{`substr("hello", 1, 9223372036854775807)`, "ello"},
+		{`substr("hello", 1, -9223372036854775807)`, ""},
+		{`chars("aé日")`, []string{"a", "é", "日"}},
+		{`chars("")`, []string{}},
+		{`pad_left("7", 3, "0")`, "007"},
+		{`pad_left("é", 3)`, "  é"},
+		{`pad_right("ab", 6, "xy")`, "abxyxy"},
+		{`pad_right("monkey", 3)`, "monkey"},
+		{`pad_right("monkey", -9223372036854775807 - 1)`, "monkey"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		case []string:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if array.Len() != len(expected) {
+				t.Errorf("wrong num of elements for %s. want=%d, got=%d", tt.input, len(expected), array.Len())
+				continue
+			}
+			for i, expectedElem := range expected {
+				testStringObject(t, array.Get(i), expectedElem)
+			}
+		}
+	}
+}
+
+func TestStringBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`split(1, ",")`, "argument type to `split` not supported, got=INTEGER, want=STRING"},
+		{`split("a", ",", "b")`, "wrong number of arguments. got=3, want=1..2"},
+		{`join(["a", 1])`, "argument type to `join` not supported, got=ARRAY of INTEGER, want=ARRAY of STRING"},
+		{`upper()`, "wrong number of arguments. got=0, want=1"},
+		{`contains("a", 1)`, "argument type to `contains` not supported, got=INTEGER, want=STRING"},
+		{`repeat("a", -1)`, "negative count to `repeat`, got=-1"},
+		{`pad_left("a", 3, "")`, "empty padding to `pad_left`"},
+		{`repeat("ab", 9223372036854775807)`, "count too large to `repeat`, got=9223372036854775807"},
+		{`pad_left("a", 9223372036854775807)`, "width too large to `pad_left`, got=9223372036854775807"},
+		{`"monkey"["m"]`, "index operator not supported: STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %s. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestArrayBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * x })`, "[1, 4, 9]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`map(["a", "bb"], len)`, "[1, 2]"},
+		{`let k = 10; map([1, 2], fn(x) { x + k })`, "[11, 12]"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`reduce([1, 2, 3, 4, 5], 0, fn(acc, x) { acc + x })`, "15"},
+		{`reduce([], "init", fn(acc, x) { acc + x })`, "init"},
+		{`each([1, 2], fn(x) { x })`, "null"},
+		{`find([1, 2, 3, 4], fn(x) { x > 2 })`, "3"},
+		{`find([1, 2], fn(x) { x > 2 })`, "null"},
+		{`any([1, 2, 3], fn(x) { x == 2 })`, "true"},
+		{`any([], fn(x) { true })`, "false"},
+		{`all([1, 2, 3], fn(x) { x > 0 })`, "true"},
+		{`all([1, 2, 3], fn(x) { x > 1 })`, "false"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`sort(["bb", "a", "ccc"], fn(a, b) { len(a) - len(b) })`, "[a, bb, ccc]"},
+		{`let a = [3, 1, 2]; sort(a); a`, "[3, 1, 2]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`reverse([])`, "[]"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`flatten([1, [2, [3, [4]]], 5])`, "[1, 2, 3, 4, 5]"},
+		{`flatten([1, [2, [3, [4]]]], 1)`, "[1, 2, [3, [4]]]"},
+		{`range(4)`, "[0, 1, 2, 3]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(10, 0, -3)`, "[10, 7, 4, 1]"},
+		{`range(0)`, "[]"},
+		{`range(0, 9223372036854775807, 4611686018427387904)`, "[0, 4611686018427387904]"},
+		{`range(9223372036854775807, -9223372036854775807 - 1, -9223372036854775807 - 1)`, "[9223372036854775807, -1]"},
+		{`range(5, 0)`, "[]"},
+		{`concat([1], [], [2, 3])`, "[1, 2, 3]"},
+		{`concat()`, "[]"},
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], 2)`, "[3, 4]"},
+		{`slice([1, 2, 3], -5, 10)`, "[1, 2, 3]"},
+		{`unique([1, 2, 1, "a", 2, "a", true])`, "[1, 2, a, true]"},
+		{`group_by([1, 2, 3, 4, 5], fn(x) { x / 2 * 2 == x })`, "{false:[1, 3, 5], true:[2, 4]}"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestArrayBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`map(1, fn(x) { x })`, "argument type to `map` not supported, got=INTEGER, want=ARRAY"},
+		{`map([1], 1)`, "argument type to `map` not supported, got=INTEGER, want=FUNCTION"},
+		{`map([1], fn(x, y) { x })`, "wrong number of arguments. got=1, want=2"},
+		{`map([1, true], fn(x) { -x })`, "unknown operator: -BOOLEAN"},
+		{`filter([1], fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`sort([1, "a"])`, "cannot compare STRING and INTEGER, pass a comparator to `sort`"},
+		{`sort([1, 2], fn(a, b) { "less" })`, "comparator to `sort` must return BOOLEAN or INTEGER, got=STRING"},
+		{`range(1, 2, 0)`, "zero step to `range`"},
+		{`range(-9223372036854775807 - 1, 9223372036854775807)`, "too many elements for `range`, got=18446744073709551615"},
+		{`zip([1], 2)`, "argument type to `zip` not supported, got=INTEGER, want=ARRAY"},
+		{`unique([[1]])`, "unusable as hash key: ARRAY"},
+		{`group_by([1], fn(x) { [x] })`, "unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %s. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len({"a": 1, "b": 2})`, "2"},
+		{`keys({"b": 1, "a": 2, 3: 3})`, "[b, a, 3]"},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`entries({"a": 1, true: [2]})`, "[[a, 1], [true, [2]]]"},
+		{`entries({})`, "[]"},
+		{`from_entries([["a", 1], [2, "b"]])`, "{a:1, 2:b}"},
+		{`from_entries(entries({"x": 1, "y": 2}))`, "{x:1, y:2}"},
+		{`has({"a": 1}, "a")`, "true"},
+		{`has({"a": 1}, "b")`, "false"},
+		{`has({1: first([])}, 1)`, "true"},
+		{`get({"a": 1}, "a")`, "1"},
+		{`get({"a": 1}, "b")`, "null"},
+		{`get({"a": 1}, "b", 42)`, "42"},
+		{`delete({"a": 1, "b": 2, "c": 3}, "b")`, "{a:1, c:3}"},
+		{`delete({"a": 1}, "z")`, "{a:1}"},
+		{`let h = {"a": 1}; delete(h, "a"); h`, "{a:1}"},
+		{`merge({"a": 1, "b": 2}, {"b": 3, "c": 4})`, "{a:1, b:3, c:4}"},
+		{`merge()`, "{}"},
+		{`let h = {"a": 1}; merge(h, {"a": 2}); h`, "{a:1}"},
+		{`each_pair({"a": 1}, fn(k, v) { [k, v] })`, "null"},
+		{`map_values({"a": 1, "b": 2}, fn(k, v) { v * 10 })`, "{a:10, b:20}"},
+		{`map_values({"a": 1, "b": 2}, fn(k, v) { k })`, "{a:a, b:b}"},
+		{`filter_pairs({"a": 1, "b": 2, "c": 3}, fn(k, v) { v != 2 })`, "{a:1, c:3}"},
+		{`let h = {"x": 1}; let g = merge(h, {"y": 2}); [h["y"], g["y"]]`, "[null, 2]"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestEachPair(t *testing.T) {
+	var out bytes.Buffer
+	evaluated := testEvalWith(New(WithOutput(&out)), `each_pair({"a": 1, "b": 2}, fn(k, v) { puts(k, v) })`)
+	if evaluated != NULL {
+		t.Errorf("wrong result. want=null, got=%s", evaluated.Inspect())
+	}
+	if out.String() != "a\n1\nb\n2\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "a\n1\nb\n2\n", out.String())
+	}
+}
+
+func TestHashBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`keys([1])`, "argument type to `keys` not supported, got=ARRAY, want=HASH"},
+		{`has({}, [1])`, "unusable as hash key: ARRAY"},
+		{`get({}, fn() {})`, "unusable as hash key: FUNCTION"},
+		{`get({})`, "wrong number of arguments. got=1, want=2..3"},
+		{`delete({}, {})`, "unusable as hash key: HASH"},
+		{`merge({}, [])`, "argument type to `merge` not supported, got=ARRAY, want=HASH"},
+		{`from_entries([[1, 2, 3]])`, "argument to `from_entries` must be an ARRAY of [key, value] pairs, got=[1, 2, 3]"},
+		{`from_entries([[[1], 2]])`, "unusable as hash key: ARRAY"},
+		{`map_values({"a": 1}, fn(k, v) { v + "s" })`, "type mismatch: INTEGER + STRING"},
+		{`map_values({"a": 1}, fn(v) { v })`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %s. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestTypeBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`type(1)`, "INTEGER"},
+		{`type("a")`, "STRING"},
+		{`type(true)`, "BOOLEAN"},
+		{`type(first([]))`, "NULL"},
+		{`type([])`, "ARRAY"},
+		{`type({})`, "HASH"},
+		{`type(fn(x) { x })`, "FUNCTION"},
+		{`type(len)`, "BUILTIN"},
+		{`type(1) == "INTEGER"`, "true"},
+		{`type("a") != "STRING"`, "false"},
+		{`is_int(1)`, "true"},
+		{`is_int("1")`, "false"},
+		{`is_string("")`, "true"},
+		{`is_bool(false)`, "true"},
+		{`is_null(first([]))`, "true"},
+		{`is_null(0)`, "false"},
+		{`is_array([1])`, "true"},
+		{`is_hash({})`, "true"},
+		{`is_function(fn() { 1 })`, "true"},
+		{`is_function(len)`, "true"},
+		{`is_builtin(fn() { 1 })`, "false"},
+		{`is_builtin(puts)`, "true"},
+		{`str(42)`, "42"},
+		{`str("s")`, "s"},
+		{`str(true)`, "true"},
+		{`str([1, "a"])`, "[1, a]"},
+		{`str(first([]))`, "null"},
+		{`str(len)`, "builtin len"},
+		{`len(str(-12))`, "3"},
+		{`int("42")`, "42"},
+		{`int(" -7 ")`, "-7"},
+		{`int(5)`, "5"},
+		{`int(true)`, "1"},
+		{`int(false)`, "0"},
+		{`bool(0)`, "true"},
+		{`bool("")`, "true"},
+		{`bool(false)`, "false"},
+		{`bool(first([]))`, "false"},
+		{`array("añb")`, "[a, ñ, b]"},
+		{`array({"a": 1})`, "[[a, 1]]"},
+		{`array([1])`, "[1]"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestTypeBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`type()`, "wrong number of arguments. got=0, want=1"},
+		{`is_int(1, 2)`, "wrong number of arguments. got=2, want=1"},
+		{`int("12a")`, "could not parse \"12a\" as integer"},
+		{`int("99999999999999999999")`, "could not parse \"99999999999999999999\" as integer"},
+		{`int([1])`, "argument type to `int` not supported, got=ARRAY"},
+		{`array(1)`, "argument type to `array` not supported, got=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %s. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+// Monkey strings cannot contain quotes, so json_parse is applied from Go
+func TestJSONParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": [1, -2, true, null], "a": {"s": "x\ny"}}`, "{b:[1, -2, true, null], a:{s:x\ny}}"},
+		{`{"a": 1, "a": 2}`, "{a:2}"},
+		{`"\u00e9"`, "é"},
+		{` {} `, "{}"},
+		{`[]`, "[]"},
+		{`null`, "null"},
+		{``, "Error: json_parse: unexpected end of input at offset 0"},
+		{`[1, 2`, "Error: json_parse: unexpected end of input at offset 5"},
+		{`{"a" 1}`, "Error: json_parse: invalid character '1' after object key at offset 5"},
+		{`[1, 2.5]`, "Error: json_parse: number 2.5 is not a 64-bit integer at offset 4"},
+		{`[1, x]`, "Error: json_parse: invalid character 'x' looking for beginning of value at offset 4"},
+		{`[1] [2]`, "Error: json_parse: unexpected data after top-level value at offset 4"},
+	}
+
+	for _, tt := range tests {
+		evaluated := New().Apply(New().builtins["json_parse"], &object.String{Value: tt.input})
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	hash := New().Apply(New().builtins["json_parse"], &object.String{Value: `{"n": 1, "s": "str"}`})
+	stringified := testEval(`json_stringify(json_parse(json_stringify({"n": 1, "s": "str"})))`)
+	if stringified.Inspect() != `{"n":1,"s":"str"}` || hash.Inspect() != "{n:1, s:str}" {
+		t.Errorf("round trip failed. got=%s, %s", hash.Inspect(), stringified.Inspect())
+	}
+}
+
+func TestJSONStringify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_stringify({"b": [1, -2, true, first([])], "a": {"s": "x"}})`, `{"b":[1,-2,true,null],"a":{"s":"x"}}`},
+		{`json_stringify({"b": 1, "a": [2]}, 0, true)`, `{"a":[2],"b":1}`},
+		{`json_stringify({"b": {"d": 1, "c": 2}}, "", true)`, `{"b":{"c":2,"d":1}}`},
+		{`json_stringify({"b": 1, "a": [2]}, 2)`, "{\n  \"b\": 1,\n  \"a\": [\n    2\n  ]\n}"},
+		{`json_stringify([], "\t")`, "[]"},
+		{`json_stringify("<é & é>")`, `"<é & é>"`},
+		{`json_stringify(first([]))`, "null"},
+		{`json_stringify(fn(x) { x })`, "Error: json_stringify: unsupported value type FUNCTION"},
+		{`json_stringify([len])`, "Error: json_stringify: unsupported value type BUILTIN"},
+		{`json_stringify({1: 2})`, "Error: json_stringify: hash key must be STRING, got=INTEGER"},
+		{`json_stringify(1, [])`, "Error: argument type to `json_stringify` not supported, got=ARRAY, want=INTEGER or STRING"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestFileBuiltins(t *testing.T) {
+	fsys := MemFS(map[string]string{ // shared, tests run in order
+		"notes.txt": "one\ntwo\r\nthree",
+		"dir/a.txt": "a",
+	})
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`read_file("notes.txt")`, "one\ntwo\r\nthree"},
+		{`read_file("./dir/../notes.txt") == read_file("notes.txt")`, "true"},
+		{`read_lines("notes.txt")`, "[one, two, three]"},
+		{`list_dir()`, "[dir/, notes.txt]"},
+		{`list_dir("dir")`, "[a.txt]"},
+		{`each_line("notes.txt", fn(line) { append_file("copy.txt", line + "|") }); read_file("copy.txt")`, "one|two|three|"},
+		{`exists("dir/a.txt")`, "true"},
+		{`exists("dir/b.txt")`, "false"},
+		{`write_file("out.txt", "x"); append_file("out.txt", "y"); read_file("out.txt")`, "xy"},
+		{`append_file("dir/new.txt", "z"); read_file("dir/new.txt")`, "z"},
+		{`remove("out.txt"); exists("out.txt")`, "false"},
+		{`read_file("missing.txt")`, "Error: read_file: open missing.txt: file does not exist"},
+		{`read_file("../etc/passwd")`, "Error: read_file: open ../etc/passwd: invalid argument"},
+		{`read_file("/etc/passwd")`, "Error: read_file: open /etc/passwd: invalid argument"},
+		{`each_line("notes.txt", fn(line) { line + 1 })`, "Error: type mismatch: STRING + INTEGER"},
+		{`remove("dir")`, "Error: remove: remove dir: file already exists"},
+		{`write_file("notes.txt", 1)`, "Error: argument type to `write_file` not supported, got=INTEGER, want=STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWith(New(WithFileSystem(fsys)), tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	evaluated := testEval(`read_file("notes.txt")`)
+	if evaluated.Inspect() != "Error: file system access disabled" {
+		t.Errorf("file access not disabled. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	fsys := MemFS(map[string]string{"notes.txt": "one", "dir/a.txt": "a", "dir/sub/b.txt": "b"})
+	var walked []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := fs.Stat(fsys, name)
+		if err != nil || info.IsDir() != d.IsDir() || info.Name() != d.Name() {
+			t.Errorf("wrong Stat for %s. got=%v (%v)", name, info, err)
+		}
+		if !d.IsDir() {
+			if data, err := fs.ReadFile(fsys, name); err != nil || info.Size() != int64(len(data)) {
+				t.Errorf("wrong size of %s. got=%d, want=%d (%v)", name, info.Size(), len(data), err)
+			}
+		}
+		walked = append(walked, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ". dir dir/a.txt dir/sub dir/sub/b.txt notes.txt"
+	if got := strings.Join(walked, " "); got != expected {
+		t.Errorf("wrong walk. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(outside, "outside.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "outside.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := DirFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := New(WithFileSystem(fsys))
+
+	evaluated := testEvalWith(in, `write_file("a.txt", "a"); append_file("a.txt", "b"); read_lines("a.txt")`)
+	if evaluated.Inspect() != "[ab]" {
+		t.Errorf("wrong result. got=%s", evaluated.Inspect())
+	}
+	for _, input := range []string{`read_file("../` + filepath.Base(outside) + `/outside.txt")`, `read_file("link.txt")`} {
+		if evaluated := testEvalWith(in, input); !isError(evaluated) {
+			t.Errorf("%s escaped the root. got=%s", input, evaluated.Inspect())
+		}
+	}
+	if err := fsys.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if evaluated := testEvalWith(in, `read_file("a.txt")`); !isError(evaluated) {
+		t.Errorf("read after Close. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestRegexBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`/a\/b/i`, `/(?i)a\/b/`},
+		{`type(regex("a+"))`, "REGEX"},
+		{`str(regex("a/+"))`, `/a\/+/`},
+		{`is_regex(/x/)`, "true"},
+		{`matches(/^\d+$/, "123")`, "true"},
+		{`matches("^\d+$", "12a")`, "false"},
+		{`match(/(\w+)@(\w+)?x/, "me@x")`, "[me@x, me, null]"},
+		{`match(/z/, "abc")`, "null"},
+		{`match_named(/(?P<user>\w+)@(?P<host>\w+)/, "mail me@example now")`, "{user:me, host:example}"},
+		{`match_named(/(?P<user>\w+)@/, "nobody")`, "null"},
+		{`find_all(/\d+/, "a1b22c333")`, "[1, 22, 333]"},
+		{`scan(/(\w)=(\d)/, "a=1, b=2")`, "[[a=1, a, 1], [b=2, b, 2]]"},
+		{`replace("a1b22", /\d+/, "#")`, "a#b#"},
+		{`replace("a1b22", /\d+/, "#", 1)`, "a#b22"},
+		{`replace("john smith", /(?P<first>\w+) (\w+)/, "$2, ${first}")`, "smith, john"},
+		{`replace("a1b22", /\d+/, fn(m) { str(int(m[0]) * 2) })`, "a2b44"},
+		{`replace("a-b", /(\w)/, fn(m) { upper(m[1]) })`, "A-B"},
+		{`split("a, b;c", /[,;] ?/)`, "[a, b, c]"},
+		{`let r = /o/; len(find_all(r, "foo")) / 1`, "2"},
+		{`regex("a(")`, "Error: regex: error parsing regexp: missing closing ): `a(`"},
+		{`match(1, "a")`, "Error: argument type to `match` not supported, got=INTEGER, want=REGEX or STRING"},
+		{`match(/a/, 1)`, "Error: argument type to `match` not supported, got=INTEGER, want=STRING"},
+		{`replace("a", /a/, fn(m) { 1 })`, "Error: replacement function to `replace` must return STRING, got=INTEGER"},
+		{`replace("a", /a/, 1)`, "Error: argument type to `replace` not supported, got=INTEGER, want=STRING or FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestRegexCache(t *testing.T) {
+	first, _ := compileRegex("cached")
+	for i := 0; i < regexCacheSize; i++ {
+		compileRegex(fmt.Sprintf("p%d", i))
+	}
+	evicted, _ := compileRegex("cached")
+	again, _ := compileRegex("cached")
+	if first == evicted || evicted != again {
+		t.Errorf("wrong cache behaviour. first=%p, evicted=%p, again=%p", first, evicted, again)
+	}
+	if len(regexCache.entries) != regexCacheSize || regexCache.lru.Len() != regexCacheSize {
+		t.Errorf("cache not bounded. got=%d entries", len(regexCache.entries))
+	}
+}
+
+// the declared arity agrees with the argument count checks of each builtin
+func TestBuiltinArity(t *testing.T) {
+	in := New()
+	for name, b := range builtins {
+		counts := []int{}
+		if b.MinArgs > 0 {
+			counts = append(counts, b.MinArgs-1)
+		}
+		if b.MaxArgs >= 0 {
+			counts = append(counts, b.MaxArgs+1)
+		}
+		for _, count := range counts {
+			args := make([]object.Object, count)
+			for i := range args {
+				args[i] = NULL
+			}
+			result, ok := b.Fn(in, args...).(*object.Error)
+			if !ok || !strings.HasPrefix(result.Message, "wrong number of arguments") {
+				t.Errorf("%s accepts %d arguments, declared %d..%d. got=%v", name, count, b.MinArgs, b.MaxArgs, result)
+			}
+		}
+	}
+	for name, b := range builtins {
+		if !strings.HasPrefix(b.Usage, name+"(") {
+			t.Errorf("usage of %s does not start with its signature. got=%q", name, b.Usage)
+		}
+	}
+	if _, _, ok := BuiltinArity("no_such_builtin"); ok {
+		t.Errorf("arity of unknown builtin")
+	}
+}
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+		return false
+	}
+	return true
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
-   env := object.NewEnvironment()
+	NewResolver().Resolve(program)
+	env := object.NewEnvironment()
 
 	return Eval(program, env)
 }
+
+// evaluates input and compares the result's Inspect() with expected
+func testInspect(t *testing.T, input string, expected string) bool {
+	evaluated := testEval(input)
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong result for %s. want=%q, got=%q", input, expected, evaluated.Inspect())
+		return false
+	}
+	return true
+}
+
+func testEvalWith(in *Interpreter, input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	NewResolver().Resolve(program)
+	return in.Eval(program, object.NewEnvironment())
+}
+
+/*
+ * Benchmarks: closure-heavy programs where identifier lookup dominates
+ *    ~ map-backed environments:          Fibonacci 20.1ms, Closures 2.03ms, Examples 36.5us
+ *    ~ resolved, slice-backed frames:    Fibonacci 13.5ms, Closures 1.15ms, Examples 21.9us
+ */
+const fibonacciProgram = `
+let fib = fn(n) {
+   if (n < 2) {
+      n
+   } else {
+      fib(n - 1) + fib(n - 2)
+   }
+};
+fib(20);`
+
+func BenchmarkFibonacci(b *testing.B) {
+	benchmarkProgram(b, fibonacciProgram)
+}
+
+const closuresProgram = `
+let adder = fn(a) { fn(b) { fn(c) { a + b + c } } };
+let loop = fn(n, acc) {
+   if (n == 0) {
+      acc
+   } else {
+      loop(n - 1, acc + adder(1)(2)(n))
+   }
+};
+loop(500, 0);`
+
+func BenchmarkClosures(b *testing.B) {
+	benchmarkProgram(b, closuresProgram)
+}
+
+// copying push/rest: 80ms, persistent arrays: 6ms
+func BenchmarkPushRest(b *testing.B) {
+	benchmarkProgram(b, `
+let build = fn(n, acc) { if (n == 0) { acc } else { build(n - 1, push(acc, n)) } };
+let sum = fn(arr, acc) { if (len(arr) == 0) { acc } else { sum(rest(arr), acc + first(arr)) } };
+sum(build(2000, []), 0);`)
+}
+
+func BenchmarkExamples(b *testing.B) {
+	input, err := ioutil.ReadFile("../examples/examples.mo")
+	if err != nil {
+		b.Fatalf("could not read examples: %s", err)
+	}
+	benchmarkProgram(b, string(input))
+}
+
+func benchmarkProgram(b *testing.B, input string) {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	NewResolver().Resolve(program)
+	in := New()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		in.Eval(program, object.NewEnvironment())
+	}
+}
@@ -0,0 +1,271 @@
+package evaluator
+
+import (
+   "bytes"
+   "io"
+   "io/fs"
+   "os"
+   "path"
+   "sort"
+   "strings"
+   "sync"
+   "time"
+)
+
+/*
+ * FileSystem: files visible to scripts through the file builtins
+ *    ~ an fs.FS (slash-separated, unrooted names) extended with write operations
+ *    ~ DirFS confines scripts to a directory tree, MemFS keeps files in memory
+ *    ~ an interpreter without a FileSystem has file access disabled
+ *    ~ the file system belongs to whoever created it, who closes it once no interpreter uses it
+ *      (DirFS holds the directory open)
+ */
+type FileSystem interface {
+   fs.FS
+   WriteFile(name string, data []byte) error
+   AppendFile(name string, data []byte) error
+   Remove(name string) error
+   Close() error
+}
+
+// normalizes a script path ("./a//b") to an fs.FS name ("a/b")
+func cleanPath(op, name string) (string, error) {
+   cleaned := path.Clean(name)
+   cleaned = strings.TrimPrefix(cleaned, "./")
+   if !fs.ValidPath(cleaned) {
+      return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+   }
+   return cleaned, nil
+}
+
+// file system rooted at a directory, names cannot escape it (not even through symlinks)
+type dirFS struct {
+   root *os.Root
+}
+
+func DirFS(dir string) (FileSystem, error) {
+   root, err := os.OpenRoot(dir)
+   if err != nil {
+      return nil, err
+   }
+   return &dirFS{root: root}, nil
+}
+
+func (d *dirFS) Open(name string) (fs.File, error) {
+   cleaned, err := cleanPath("open", name)
+   if err != nil {
+      return nil, err
+   }
+   return d.root.Open(cleaned)
+}
+
+func (d *dirFS) WriteFile(name string, data []byte) error {
+   cleaned, err := cleanPath("write", name)
+   if err != nil {
+      return err
+   }
+   return d.root.WriteFile(cleaned, data, 0644)
+}
+
+func (d *dirFS) AppendFile(name string, data []byte) error {
+   cleaned, err := cleanPath("append", name)
+   if err != nil {
+      return err
+   }
+   f, err := d.root.OpenFile(cleaned, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0644)
+   if err != nil {
+      return err
+   }
+   if _, err := f.Write(data); err != nil {
+      f.Close()
+      return err
+   }
+   return f.Close()
+}
+
+func (d *dirFS) Close() error {
+   return d.root.Close()
+}
+
+func (d *dirFS) Remove(name string) error {
+   cleaned, err := cleanPath("remove", name)
+   if err != nil {
+      return err
+   }
+   return d.root.Remove(cleaned)
+}
+
+// in-memory file system, directories exist implicitly as prefixes of file names
+type memFS struct {
+   mu    sync.Mutex
+   files map[string]*memFile // by name
+}
+
+// a file, or a directory listed by Open, and its fs.FileInfo and fs.DirEntry
+type memFile struct {
+   name    string // base name
+   data    []byte // never mutated in place, writes replace the file
+   modTime time.Time // zero for directories
+   dir     bool
+}
+
+func MemFS(files map[string]string) FileSystem {
+   m := &memFS{files: make(map[string]*memFile)}
+   for name, content := range files {
+      m.files[name] = &memFile{name: path.Base(name), data: []byte(content), modTime: time.Now()}
+   }
+   return m
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+   cleaned, err := cleanPath("open", name)
+   if err != nil {
+      return nil, err
+   }
+   m.mu.Lock()
+   defer m.mu.Unlock()
+   if file, ok := m.files[cleaned]; ok {
+      return &openFile{path: cleaned, file: file, reader: bytes.NewReader(file.data)}, nil
+   }
+   if cleaned == "." || m.isDir(cleaned) {
+      return &openFile{path: cleaned, file: &memFile{name: path.Base(cleaned), dir: true}, entries: m.entries(cleaned)}, nil
+   }
+   return nil, &fs.PathError{Op: "open", Path: cleaned, Err: fs.ErrNotExist}
+}
+
+// files and directories directly in dir, sorted by name
+func (m *memFS) entries(dir string) []fs.DirEntry {
+   prefix := dir + "/"
+   if dir == "." {
+      prefix = ""
+   }
+   seen := make(map[string]bool)
+   entries := []fs.DirEntry{}
+   for name, file := range m.files {
+      if !strings.HasPrefix(name, prefix) {
+         continue
+      }
+      rest := name[len(prefix):]
+      if i := strings.Index(rest, "/"); i >= 0 { // in a subdirectory
+         if !seen[rest[:i]] {
+            seen[rest[:i]] = true
+            entries = append(entries, &memFile{name: rest[:i], dir: true})
+         }
+         continue
+      }
+      entries = append(entries, file)
+   }
+   sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+   return entries
+}
+
+func (m *memFS) WriteFile(name string, data []byte) error {
+   return m.write("write", name, data, false)
+}
+
+func (m *memFS) AppendFile(name string, data []byte) error {
+   return m.write("append", name, data, true)
+}
+
+func (m *memFS) write(op, name string, data []byte, appending bool) error {
+   cleaned, err := cleanPath(op, name)
+   if err != nil {
+      return err
+   }
+   m.mu.Lock()
+   defer m.mu.Unlock()
+   if cleaned == "." || m.isDir(cleaned) {
+      return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+   }
+   var content []byte
+   if existing, ok := m.files[cleaned]; ok && appending {
+      content = append(content, existing.data...)
+   }
+   content = append(content, data...)
+   m.files[cleaned] = &memFile{name: path.Base(cleaned), data: content, modTime: time.Now()}
+   return nil
+}
+
+func (m *memFS) Remove(name string) error {
+   cleaned, err := cleanPath("remove", name)
+   if err != nil {
+      return err
+   }
+   m.mu.Lock()
+   defer m.mu.Unlock()
+   if _, ok := m.files[cleaned]; ok {
+      delete(m.files, cleaned)
+      return nil
+   }
+   if m.isDir(cleaned) {
+      return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrExist} // directory not empty
+   }
+   return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *memFS) Close() error {
+   return nil
+}
+
+func (m *memFS) isDir(name string) bool {
+   for file := range m.files {
+      if strings.HasPrefix(file, name + "/") {
+         return true
+      }
+   }
+   return false
+}
+
+func (f *memFile) Name() string               { return f.name }
+func (f *memFile) Size() int64                { return int64(len(f.data)) }
+func (f *memFile) ModTime() time.Time         { return f.modTime }
+func (f *memFile) IsDir() bool                { return f.dir }
+func (f *memFile) Sys() interface{}           { return nil }
+func (f *memFile) Type() fs.FileMode          { return f.Mode().Type() }
+func (f *memFile) Info() (fs.FileInfo, error) { return f, nil }
+
+func (f *memFile) Mode() fs.FileMode {
+   if f.dir {
+      return fs.ModeDir | 0755
+   }
+   return 0644
+}
+
+// an open file reads the content it had when opened, an open directory lists its entries
+type openFile struct {
+   path    string
+   file    *memFile
+   reader  *bytes.Reader  // files only
+   entries []fs.DirEntry // directories only, those not yet read
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) {
+   return f.file, nil
+}
+
+func (f *openFile) Read(b []byte) (int, error) {
+   if f.file.dir {
+      return 0, &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrInvalid}
+   }
+   return f.reader.Read(b)
+}
+
+func (f *openFile) ReadDir(n int) ([]fs.DirEntry, error) {
+   if !f.file.dir {
+      return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: fs.ErrInvalid}
+   }
+   if n <= 0 { // all remaining entries
+      n = len(f.entries)
+   } else if len(f.entries) == 0 {
+      return nil, io.EOF
+   } else if n > len(f.entries) {
+      n = len(f.entries)
+   }
+   entries := f.entries[:n]
+   f.entries = f.entries[n:]
+   return entries, nil
+}
+
+func (f *openFile) Close() error {
+   return nil
+}
@@ -0,0 +1,154 @@
+package evaluator
+
+import (
+   "fmt"
+   "io"
+   "strings"
+   "monkey/ast"
+   "monkey/object"
+)
+
+/*
+ * Hooks: callbacks on the evaluation of an interpreter, e.g. for tracers, debuggers, profilers
+ *    ~ EnterNode/ExitNode: before and after each node is evaluated, ExitNode gets its result
+ *    ~ Call/Return: around each function application, with arguments and result, node is the
+ *      call expression (nil for calls from builtins, e.g. the callback of map)
+ *    ~ Error: once per error value, with the innermost node whose evaluation produced it
+ *    ~ called synchronously on the evaluating goroutine, hooks evaluating code themselves (e.g. a
+ *      debugger) get the events of that evaluation too
+ *    ~ interpreters without hooks only pay for a length check per node and call
+ */
+type Hooks interface {
+   EnterNode(node ast.Node, env *object.Environment)
+   ExitNode(node ast.Node, result object.Object)
+   Call(node *ast.CallExpression, fn object.Object, args []object.Object)
+   Return(node *ast.CallExpression, fn object.Object, result object.Object)
+   Error(node ast.Node, err *object.Error)
+}
+
+// no-op Hooks, embed to implement only some of the callbacks
+type BaseHooks struct{}
+
+func (BaseHooks) EnterNode(node ast.Node, env *object.Environment) {}
+func (BaseHooks) ExitNode(node ast.Node, result object.Object) {}
+func (BaseHooks) Call(node *ast.CallExpression, fn object.Object, args []object.Object) {}
+func (BaseHooks) Return(node *ast.CallExpression, fn object.Object, result object.Object) {}
+func (BaseHooks) Error(node ast.Node, err *object.Error) {}
+
+// add hooks to the interpreter, called in the order they were added
+func WithHooks(hooks Hooks) Option {
+   return func(in *Interpreter) {
+      in.AddHooks(hooks)
+   }
+}
+
+func (in *Interpreter) AddHooks(hooks Hooks) {
+   in.hooks = append(in.hooks, hooks)
+}
+
+// hooks is removed if it was added
+func (in *Interpreter) RemoveHooks(hooks Hooks) {
+   kept := []Hooks{}
+   for _, h := range in.hooks {
+      if h != hooks {
+         kept = append(kept, h)
+      }
+   }
+   in.hooks = kept
+}
+
+func (in *Interpreter) evalHooked(node ast.Node, env *object.Environment) object.Object {
+   for _, h := range in.hooks {
+      h.EnterNode(node, env)
+   }
+   result := in.eval(node, env)
+   if err, ok := result.(*object.Error); ok && err != in.lastError { // errors are propagated as is
+      in.lastError = err
+      for _, h := range in.hooks {
+         h.Error(node, err)
+      }
+   }
+   for _, h := range in.hooks {
+      h.ExitNode(node, result)
+   }
+   return result
+}
+
+func (in *Interpreter) call(node *ast.CallExpression, fn object.Object, args []object.Object) object.Object {
+   if len(in.hooks) == 0 {
+      return in.applyFunction(fn, args)
+   }
+   for _, h := range in.hooks {
+      h.Call(node, fn, args)
+   }
+   result := in.applyFunction(fn, args)
+   for _, h := range in.hooks {
+      h.Return(node, fn, result)
+   }
+   return result
+}
+
+/*
+ * Tracer: Hooks printing calls as an indented call tree
+ *    call fib(2) @5:10
+ *       call fib(1) @4:20
+ *       return 1
+ *    return 1
+ *    ~ positions are those of the call expressions, calls from builtins have none
+ *    ~ errors are printed where they occur, e.g. error: identifier not found: x @2:3
+ */
+type Tracer struct {
+   BaseHooks
+   w     io.Writer
+   depth int // of calls
+}
+
+func NewTracer(w io.Writer) *Tracer {
+   return &Tracer{w: w}
+}
+
+func (t *Tracer) Call(node *ast.CallExpression, fn object.Object, args []object.Object) {
+   inspected := make([]string, len(args))
+   for i, arg := range args {
+      inspected[i] = arg.Inspect()
+   }
+   name := calleeName(fn)
+   if node != nil {
+      name = node.Function.String()
+   }
+   t.printf("call %s(%s)%s", name, strings.Join(inspected, ", "), position(node))
+   t.depth += 1
+}
+
+func (t *Tracer) Return(node *ast.CallExpression, fn object.Object, result object.Object) {
+   t.depth -= 1
+   t.printf("return %s", result.Inspect())
+}
+
+func (t *Tracer) Error(node ast.Node, err *object.Error) {
+   t.printf("error: %s%s", err.Message, position(node))
+}
+
+func (t *Tracer) printf(format string, a ...interface{}) {
+   fmt.Fprintf(t.w, strings.Repeat("   ", t.depth) + format + "\n", a...)
+}
+
+// name of a function called without call expression
+func calleeName(fn object.Object) string {
+   if b, ok := fn.(*object.Builtin); ok {
+      return b.Name
+   }
+   return "fn"
+}
+
+// " @line:char" of a node, empty without node
+func position(node ast.Node) string {
+   if node == nil {
+      return ""
+   }
+   if c, ok := node.(*ast.CallExpression); ok && c == nil {
+      return ""
+   }
+   pos := node.Pos()
+   return fmt.Sprintf(" @%d:%d", pos.Line, pos.Char)
+}
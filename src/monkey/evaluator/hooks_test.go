@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+	"monkey/ast"
+	"monkey/object"
+	"testing"
+)
+
+// records the events of an evaluation, one line each
+type recorder struct {
+	BaseHooks
+	events []string
+}
+
+func (r *recorder) Call(node *ast.CallExpression, fn object.Object, args []object.Object) {
+	r.events = append(r.events, fmt.Sprintf("call %s%s", calleeName(fn), position(node)))
+}
+
+func (r *recorder) Return(node *ast.CallExpression, fn object.Object, result object.Object) {
+	r.events = append(r.events, "return "+result.Inspect())
+}
+
+func (r *recorder) Error(node ast.Node, err *object.Error) {
+	r.events = append(r.events, fmt.Sprintf("error %s%s", err.Message, position(node)))
+}
+
+func TestTracer(t *testing.T) {
+	input := `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(2);
+map([1], fn(x) { x * 2 });
+len(1)`
+	var out strings.Builder
+	testEvalWith(New(WithTracer(&out)), input)
+
+	expected := `call fib(2) @2:1
+   call fib(1) @1:43
+   return 1
+   call fib(0) @1:56
+   return 0
+return 1
+call map([1], fn(x) { (x * 2) }) @3:1
+   call fn(1)
+   return 2
+return [2]
+call len(1) @4:1
+return Error: argument type to ` + "`len`" + ` not supported, got=INTEGER
+error: argument type to ` + "`len`" + ` not supported, got=INTEGER @4:1
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace. expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestHooksErrorOnce(t *testing.T) {
+	r := &recorder{}
+	testEvalWith(New(WithHooks(r)), "let f = fn() { -true }; 1 + f()")
+
+	expected := []string{
+		"call fn @1:29",
+		"error unknown operator: -BOOLEAN @1:16",
+		"return Error: unknown operator: -BOOLEAN",
+	}
+	if strings.Join(r.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events. expected=%q, got=%q", expected, r.events)
+	}
+}
+
+type nodeCounter struct {
+	BaseHooks
+	entered, exited int
+}
+
+func (c *nodeCounter) EnterNode(node ast.Node, env *object.Environment) { c.entered += 1 }
+func (c *nodeCounter) ExitNode(node ast.Node, result object.Object) { c.exited += 1 }
+
+func TestHooksNodes(t *testing.T) {
+	c := &nodeCounter{}
+	in := New(WithHooks(c))
+	testEvalWith(in, "let x = 1 + 2; x")
+
+	// Program, LetStatement, InfixExpression, 2 IntegerLiterals, ExpressionStatement, Identifier
+	if c.entered != 7 || c.exited != 7 {
+		t.Errorf("wrong number of nodes. entered=%d, exited=%d, want=7", c.entered, c.exited)
+	}
+
+	in.RemoveHooks(c)
+	testEvalWith(in, "1")
+	if c.entered != 7 {
+		t.Errorf("removed hooks called. entered=%d, want=7", c.entered)
+	}
+}
@@ -0,0 +1,260 @@
+package evaluator
+
+import (
+   "fmt"
+   "monkey/ast"
+   "monkey/object"
+)
+
+/*
+ * Resolver: static pass annotating identifiers with lexical addresses
+ *    ~ scopes are introduced by the program and by function literals (not by blocks)
+ *    ~ a name is visible in its own scope from its let statement onwards
+ *    ~ function bodies are resolved once their enclosing scope is complete, so closures can
+ *      refer to (mutually) recursive bindings declared later
+ *    ~ a closure refers to the innermost slot of a name, and to the slots of enclosing scopes
+ *      that are read while it is not yet bound (see ast.Address): it sees the binding that is
+ *      innermost when it runs, like a lookup by name
+ *    ~ names bound neither by let, parameter, nor builtin are reported as errors
+ *    ~ Analyze also records which binding each identifier refers to (see symbols.go)
+ */
+type Resolver struct {
+   global  *Scope // persists across calls to Resolve (REPL)
+   errors  []string
+   symbols *Symbols // nil unless analyzing
+}
+
+/*
+ * Scope: the bindings of the program or of a function literal
+ *    ~ Bindings are in order of declaration, a name declared twice has two bindings
+ *      sharing one slot
+ */
+type Scope struct {
+   Function *ast.FunctionLiteral // nil for the program
+   Outer    *Scope
+   Bindings []*Binding
+   byName   map[string][]*Binding
+   names    []string // name of each slot
+   visible  int      // bindings of Outer declared before Function
+   pending  []pendingFunction // bodies to resolve once the scope is complete
+}
+
+type pendingFunction struct {
+   literal *ast.FunctionLiteral
+   visible int // bindings of the enclosing scope declared before the literal
+}
+
+// a name declared by a let statement or as a parameter
+type Binding struct {
+   Name      string
+   Decl      *ast.Identifier  // nil for bindings of an environment (NewResolverFor)
+   Value     ast.Expression   // of the let statement, nil for parameters
+   Parameter bool
+   Refs      []*ast.Identifier // identifiers that may refer to it, recorded by Analyze
+   slot      int
+   ordinal   int // index in the Bindings of its scope
+}
+
+func newScope(outer *Scope, fn *ast.FunctionLiteral) *Scope {
+   return &Scope{Function: fn, Outer: outer, Bindings: []*Binding{}, byName: make(map[string][]*Binding), names: []string{}}
+}
+
+func NewResolver() *Resolver {
+   return &Resolver{global: newScope(nil, nil), errors: []string{}}
+}
+
+// resolver for code evaluated in env (e.g. by a debugger), its frames are the scopes
+func NewResolverFor(env *object.Environment) *Resolver {
+   var frames []*object.Environment
+   for ; env != nil; env = env.Outer() {
+      frames = append(frames, env)
+   }
+   var s *Scope
+   for i := len(frames) - 1; i >= 0; i-- { // outermost first
+      s = newScope(s, nil)
+      if s.Outer != nil {
+         s.visible = len(s.Outer.Bindings)
+      }
+      for slot, name := range frames[i].Slots() {
+         if name != "" {
+            s.bind(&Binding{Name: name, slot: slot})
+         }
+         s.names = append(s.names, name)
+      }
+   }
+   if s == nil {
+      s = newScope(nil, nil)
+   }
+   return &Resolver{global: s, errors: []string{}}
+}
+
+func (r *Resolver) Errors() []string {
+   return r.errors
+}
+
+func (r *Resolver) Resolve(program *ast.Program) {
+   r.errors = []string{}
+   r.resolve(program, r.global)
+   r.resolvePending(r.global)
+}
+
+func (r *Resolver) resolve(node ast.Node, s *Scope) {
+   switch node := node.(type) {
+      // Statements
+      case *ast.Program:
+         for _, stmt := range node.Statements {
+            r.resolve(stmt, s)
+         }
+      case *ast.LetStatement:
+         pending := len(s.pending)
+         r.resolve(node.Value, s) // note: binding not visible in its own value
+         r.declare(node.Name, node.Value, false, s)
+         for i := pending; i < len(s.pending); i++ { // but in the functions it binds
+            s.pending[i].visible = len(s.Bindings)
+         }
+      case *ast.ReturnStatement:
+         r.resolve(node.ReturnValue, s)
+      case *ast.ExpressionStatement:
+         r.resolve(node.Expression, s)
+      case *ast.BlockStatement:
+         for _, stmt := range node.Statements {
+            r.resolve(stmt, s)
+         }
+      // Expressions
+      case *ast.PrefixExpression:
+         r.resolve(node.Right, s)
+      case *ast.InfixExpression:
+         r.resolve(node.Left, s)
+         r.resolve(node.Right, s)
+      case *ast.IfExpression:
+         r.resolve(node.Condition, s)
+         r.resolve(node.Consequence, s)
+         if node.Alternative != nil {
+            r.resolve(node.Alternative, s)
+         }
+      case *ast.FunctionLiteral:
+         s.pending = append(s.pending, pendingFunction{node, len(s.Bindings)})
+      case *ast.CallExpression:
+         r.resolve(node.Function, s)
+         for _, arg := range node.Arguments {
+            r.resolve(arg, s)
+         }
+      case *ast.Identifier:
+         r.lookup(node, s)
+      case *ast.ArrayLiteral:
+         for _, el := range node.Elements {
+            r.resolve(el, s)
+         }
+      case *ast.IndexExpression:
+         r.resolve(node.Left, s)
+         r.resolve(node.Index, s)
+      case *ast.HashLiteral:
+         for _, key := range node.Keys {
+            r.resolve(key, s)
+            r.resolve(node.Pairs[key], s)
+         }
+   }
+}
+
+func (r *Resolver) resolvePending(s *Scope) {
+   for len(s.pending) > 0 {
+      fn := s.pending[0]
+      s.pending = s.pending[1:]
+      r.resolveFunction(fn.literal, s, fn.visible)
+   }
+}
+
+func (r *Resolver) resolveFunction(fl *ast.FunctionLiteral, outer *Scope, visible int) {
+   s := newScope(outer, fl)
+   s.visible = visible
+   if r.symbols != nil {
+      r.symbols.Scopes = append(r.symbols.Scopes, s)
+   }
+   for _, param := range fl.Parameters {
+      r.declare(param, nil, true, s)
+   }
+   r.resolve(fl.Body, s)
+   r.resolvePending(s)
+   fl.Locals = s.names
+}
+
+func (r *Resolver) declare(id *ast.Identifier, value ast.Expression, parameter bool, s *Scope) {
+   if id == nil { // incomplete let statement (Analyze of a program with errors)
+      return
+   }
+   b := &Binding{Name: id.Value, Decl: id, Value: value, Parameter: parameter, Refs: []*ast.Identifier{}}
+   if bs := s.byName[id.Value]; len(bs) > 0 {
+      b.slot = bs[0].slot
+   } else {
+      b.slot = len(s.names)
+      s.names = append(s.names, id.Value)
+   }
+   s.bind(b)
+   id.Address = &ast.Address{Depth: 0, Slot: b.slot}
+   r.record(id, b)
+}
+
+func (s *Scope) bind(b *Binding) {
+   b.ordinal = len(s.Bindings)
+   s.Bindings = append(s.Bindings, b)
+   s.byName[b.Name] = append(s.byName[b.Name], b)
+}
+
+/*
+ * lookup: the slots of the name from s outwards, up to the first one bound when id is evaluated
+ *    ~ the innermost scope is resolved in order, its slot is bound if it has one so far
+ *    ~ an enclosing scope is complete, its slot is bound if it has a binding declared before
+ *      the function literal (visible), otherwise id refers to the binding declared first after it,
+ *      and to the slots further out while that one is not yet bound
+ */
+func (r *Resolver) lookup(id *ast.Identifier, s *Scope) {
+   id.Address = nil
+   next := &id.Address
+   visible := -1 // all of the innermost scope
+   for depth := 0; s != nil; depth, s = depth + 1, s.Outer {
+      if bs := s.byName[id.Value]; len(bs) > 0 {
+         b, bound := bs[len(bs) - 1], true
+         if visible >= 0 {
+            b, bound = bs[0], false
+            for _, c := range bs {
+               if c.ordinal < visible {
+                  b, bound = c, true
+               }
+            }
+         }
+         if id.Address == nil {
+            r.record(id, b)
+         } else {
+            r.recordFallback(id, b)
+         }
+         *next = &ast.Address{Depth: depth, Slot: b.slot}
+         if bound {
+            return
+         }
+         next = &(*next).Outer
+      }
+      visible = s.visible
+   }
+   if id.Address != nil {
+      return
+   }
+   r.record(id, nil)
+   if _, ok := builtins[id.Value]; ok {
+      return
+   }
+   msg := fmt.Sprintf("resolve: identifier not found: %s (%s)", id.Value, id.Token.Position.String())
+   r.errors = append(r.errors, msg)
+   if r.symbols != nil {
+      r.symbols.Unresolved = append(r.symbols.Unresolved, id)
+   }
+}
+
+// the latest binding of name in s or its enclosing scopes, nil if there is none
+func (s *Scope) Lookup(name string) *Binding {
+   for ; s != nil; s = s.Outer {
+      if bs := s.byName[name]; len(bs) > 0 {
+         return bs[len(bs) - 1]
+      }
+   }
+   return nil
+}
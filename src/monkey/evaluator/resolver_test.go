@@ -0,0 +1,205 @@
+package evaluator
+
+import (
+   "fmt"
+   "monkey/ast"
+   "monkey/lexer"
+   "monkey/object"
+   "monkey/parser"
+   "strings"
+   "testing"
+)
+
+func TestResolveAddresses(t *testing.T) {
+   input := `
+let a = 1;
+let f = fn(x, y) {
+   let z = x;
+   fn(w) { a + y + z + w + f }
+};`
+
+   program, r := testResolve(t, input)
+   if len(r.Errors()) != 0 {
+      t.Fatalf("resolver has %d errors: %v", len(r.Errors()), r.Errors())
+   }
+
+   outer := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+   expectedLocals := []string{"x", "y", "z"}
+   if len(outer.Locals) != len(expectedLocals) {
+      t.Fatalf("wrong locals. want=%v, got=%v", expectedLocals, outer.Locals)
+   }
+   for i, name := range expectedLocals {
+      if outer.Locals[i] != name {
+         t.Errorf("wrong local at slot %d. want=%q, got=%q", i, name, outer.Locals[i])
+      }
+   }
+
+   inner := outer.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+   tests := []struct {
+      name string
+      depth int
+      slot int
+   }{
+      {"a", 2, 0},
+      {"y", 1, 1},
+      {"z", 1, 2},
+      {"w", 0, 0},
+      {"f", 2, 1},
+   }
+
+   ids := []*ast.Identifier{}
+   exp := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression
+   for {
+      infix, ok := exp.(*ast.InfixExpression)
+      if !ok {
+         ids = append([]*ast.Identifier{exp.(*ast.Identifier)}, ids...)
+         break
+      }
+      ids = append([]*ast.Identifier{infix.Right.(*ast.Identifier)}, ids...)
+      exp = infix.Left
+   }
+
+   for i, tt := range tests {
+      id := ids[i]
+      if id.Value != tt.name {
+         t.Fatalf("wrong identifier. want=%q, got=%q", tt.name, id.Value)
+      }
+      if id.Address == nil {
+         t.Errorf("identifier %q not resolved", tt.name)
+         continue
+      }
+      if id.Address.Depth != tt.depth || id.Address.Slot != tt.slot {
+         t.Errorf("wrong address for %q. want=(%d, %d), got=(%d, %d)",
+            tt.name, tt.depth, tt.slot, id.Address.Depth, id.Address.Slot)
+      }
+   }
+}
+
+func TestResolveErrors(t *testing.T) {
+   tests := []struct {
+      input string
+      expectedErrors int
+   }{
+      {"foobar", 1},
+      {"let a = a;", 1},
+      {"let f = fn() { b }; let b = 1; f()", 0},
+      {"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }", 0},
+      {"let g = fn() { h() }; let h = fn() { g() };", 0},
+      {"fn(x) { y }", 1},
+      {"len(push([], first([1])))", 0},
+      {"let len = fn(x) { 0 }; len(1)", 0},
+   }
+
+   for _, tt := range tests {
+      _, r := testResolve(t, tt.input)
+      if len(r.Errors()) != tt.expectedErrors {
+         t.Errorf("wrong number of errors for %q. want=%d, got=%d (%v)",
+            tt.input, tt.expectedErrors, len(r.Errors()), r.Errors())
+      }
+   }
+}
+
+func TestResolveShadowedLater(t *testing.T) {
+   tests := []struct {
+      input string
+      expected string
+   }{
+      {"let x = 10; let f = fn() { let g = fn() { x }; let r = g(); let x = 5; [r, g()] }; f()", "[10, 5]"},
+      {"let x = 1; let f = fn() { let x = 5; let h = fn() { x }; h() }; f()", "5"},
+      {"let x = 1; let f = fn() { let r = x; let x = 5; [r, x] }; f()", "[1, 5]"},
+      {"let f = fn() { let g = fn() { len }; let r = g(); let len = 1; [r, g()] }; f()", "[builtin len, 1]"},
+      {"let fib = 0; let f = fn() { let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10) }; f()", "55"},
+      {"let f = fn() { let even = fn(n) { if (n == 0) { 1 } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { 0 } else { even(n - 1) } }; even(4) }; f()", "1"},
+   }
+
+   for _, tt := range tests {
+      program, r := testResolve(t, tt.input)
+      if len(r.Errors()) != 0 {
+         t.Errorf("resolver has errors for %q: %v", tt.input, r.Errors())
+         continue
+      }
+      result := Eval(program, object.NewEnvironment())
+      if result == nil || result.Inspect() != tt.expected {
+         t.Errorf("wrong result for %q. want=%s, got=%v", tt.input, tt.expected, result)
+      }
+   }
+}
+
+func TestAnalyze(t *testing.T) {
+   input := `let x = 1;
+let f = fn(a) {
+   let h = fn() { x + a };
+   let x = h();
+   x + y
+};`
+   program := parser.New(lexer.New(input)).ParseProgram()
+   symbols := Analyze(program)
+
+   if len(symbols.Scopes) != 3 {
+      t.Fatalf("wrong number of scopes. want=3, got=%d", len(symbols.Scopes))
+   }
+   refs := make(map[string]string) // "name@line:char" of a reference -> of its declaration
+   for _, id := range symbols.Idents {
+      if b, ok := symbols.Uses[id]; ok && b.Decl != id {
+         refs[fmt.Sprintf("%s@%d:%d", id.Value, id.Pos().Line, id.Pos().Char)] = fmt.Sprintf("%d:%d", b.Decl.Pos().Line, b.Decl.Pos().Char)
+      }
+   }
+   expected := map[string]string{
+      "x@3:19": "4:8", // and 1:5 until it is bound
+      "a@3:23": "2:12",
+      "h@4:12": "3:8",
+      "x@5:4": "4:8",
+   }
+   if len(refs) != len(expected) {
+      t.Errorf("wrong references. want=%v, got=%v", expected, refs)
+   }
+   for ref, decl := range expected {
+      if refs[ref] != decl {
+         t.Errorf("wrong declaration of %s. want=%s, got=%s", ref, decl, refs[ref])
+      }
+   }
+   if len(symbols.Unresolved) != 1 || symbols.Unresolved[0].Value != "y" {
+      t.Errorf("wrong unresolved identifiers. got=%v", symbols.Unresolved)
+   }
+
+   x := symbols.Scopes[0].Lookup("x")
+   if len(x.Refs) != 1 || x.Refs[0].Pos().Line != 3 {
+      t.Errorf("wrong references of the outer x. got=%v", x.Refs)
+   }
+
+   f := symbols.Scopes[0].Lookup("f")
+   if f == nil || f.Function() == nil || len(f.Refs) != 0 {
+      t.Errorf("wrong binding of f. got=%+v", f)
+   }
+   if scope := symbols.ScopeAt(strings.Index(input, "x + a")); scope != symbols.Scopes[2] {
+      t.Errorf("wrong scope at h's body. got=%+v", scope)
+   }
+}
+
+func TestResolveAcrossPrograms(t *testing.T) {
+   r := NewResolver()
+   env := object.NewEnvironment()
+
+   for _, input := range []string{"let a = 5;", "let b = fn() { a * 2 };", "b() + a"} {
+      program := parser.New(lexer.New(input)).ParseProgram()
+      r.Resolve(program)
+      if len(r.Errors()) != 0 {
+         t.Fatalf("resolver has errors for %q: %v", input, r.Errors())
+      }
+      evaluated := Eval(program, env)
+      if input == "b() + a" {
+         testIntegerObject(t, evaluated, 15)
+      }
+   }
+}
+
+func testResolve(t *testing.T, input string) (*ast.Program, *Resolver) {
+   p := parser.New(lexer.New(input))
+   program := p.ParseProgram()
+   if len(p.Errors()) != 0 {
+      t.Fatalf("parser has errors: %v", p.Errors())
+   }
+   r := NewResolver()
+   r.Resolve(program)
+   return program, r
+}
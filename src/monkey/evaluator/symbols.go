@@ -0,0 +1,74 @@
+package evaluator
+
+import (
+   "monkey/ast"
+)
+
+/*
+ * Symbols: the scopes of a program and the binding each identifier refers to,
+ * shared by the tools that need scoping (linter, language server)
+ *    ~ computed by the resolver, so the tools scope names exactly like the evaluator
+ *    ~ Scopes: the program first, then function literals in the order their bodies are resolved
+ *    ~ Idents: declarations and references in the order they are resolved,
+ *      Uses maps both to their binding (builtins and unresolved names have none)
+ *    ~ Unresolved: identifiers bound neither by let, parameter, nor builtin
+ */
+type Symbols struct {
+   Scopes     []*Scope
+   Idents     []*ast.Identifier
+   Uses       map[*ast.Identifier]*Binding
+   Unresolved []*ast.Identifier
+}
+
+// resolves program on its own (e.g. a document, not REPL input), also when it has parser errors
+func Analyze(program *ast.Program) *Symbols {
+   r := NewResolver()
+   r.symbols = &Symbols{Scopes: []*Scope{r.global}, Idents: []*ast.Identifier{}, Uses: make(map[*ast.Identifier]*Binding)}
+   r.Resolve(program)
+   return r.symbols
+}
+
+func (r *Resolver) record(id *ast.Identifier, b *Binding) {
+   if r.symbols == nil {
+      return
+   }
+   r.symbols.Idents = append(r.symbols.Idents, id)
+   if b == nil {
+      return
+   }
+   r.symbols.Uses[id] = b
+   if b.Decl != id {
+      b.Refs = append(b.Refs, id)
+   }
+}
+
+// id may also refer to b, an outer binding read while the slot of its binding is not yet bound
+func (r *Resolver) recordFallback(id *ast.Identifier, b *Binding) {
+   if r.symbols != nil {
+      b.Refs = append(b.Refs, id)
+   }
+}
+
+// the function literal bound by a let statement, nil if it binds anything else
+func (b *Binding) Function() *ast.FunctionLiteral {
+   fl, _ := b.Value.(*ast.FunctionLiteral)
+   return fl
+}
+
+// innermost scope whose function literal contains the byte offset
+func (s *Symbols) ScopeAt(offset int) *Scope {
+   innermost := s.Scopes[0]
+   for _, sc := range s.Scopes[1:] {
+      if !contains(sc.Function, offset) {
+         continue
+      }
+      if innermost.Function == nil || contains(innermost.Function, sc.Function.Pos().Offset) {
+         innermost = sc
+      }
+   }
+   return innermost
+}
+
+func contains(node ast.Node, offset int) bool {
+   return node.Pos().Offset <= offset && offset < node.End().Offset
+}
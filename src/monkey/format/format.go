@@ -0,0 +1,334 @@
+package format
+
+import (
+   "bytes"
+   "errors"
+   "math"
+   "strings"
+   "unicode/utf8"
+   "monkey/ast"
+   "monkey/lexer"
+   "monkey/parser"
+   "monkey/token"
+)
+
+/*
+ * Formatter: canonical Monkey source from the AST
+ *    ~ indentation is 3 spaces, lines are kept within MaxWidth where possible
+ *    ~ parentheses only where the parser's precedences require them
+ *    ~ let and return statements end with ';', expression statements too, unless last in their block
+ *    ~ a function literal whose body is a single expression stays on one line if it fits,
+ *      other blocks are split over lines
+ *    ~ argument, array and hash lists that do not fit are wrapped, one element per line
+ *    ~ comments are put back between statements: own-line comments before the following statement,
+ *      trailing comments at the end of the preceding line; single blank lines are kept
+ */
+const MaxWidth = 80
+
+const indentUnit = "   "
+
+// formats Monkey source, fails if it does not parse
+func Source(src []byte) ([]byte, error) {
+   l := lexer.New(string(src))
+   p := parser.New(l)
+   program := p.ParseProgram()
+   if len(p.Errors()) != 0 {
+      return nil, errors.New(strings.Join(p.Errors(), "\n"))
+   }
+   return []byte(Program(program, l.Comments(), string(src))), nil
+}
+
+// formats a parsed program, comments and src (for blank lines) as seen by the lexer
+func Program(program *ast.Program, comments []token.Token, src string) string {
+   p := &printer{lines: strings.Split(src, "\n"), comments: comments}
+   var out bytes.Buffer
+   p.statements(&out, program.Statements, token.SourcePosition{Line: math.MaxInt}, 0)
+   return out.String()
+}
+
+type printer struct {
+   lines    []string      // source lines
+   comments []token.Token
+   next     int           // first comment not yet printed
+}
+
+func (p *printer) statements(out *bytes.Buffer, stmts []ast.Statement, end token.SourcePosition, indent int) {
+   start := out.Len()
+   for i, stmt := range stmts {
+      pos := stmt.Pos()
+      p.flushComments(out, pos, indent, start)
+      if out.Len() > start && p.blankBefore(pos.Line) {
+         out.WriteString("\n")
+      }
+      out.WriteString(pad(indent))
+      out.WriteString(p.statement(stmt, indent, i == len(stmts) - 1))
+      out.WriteString("\n")
+   }
+   p.flushComments(out, end, indent, start)
+}
+
+// prints the comments before pos, statements of the current block start at out[start:]
+func (p *printer) flushComments(out *bytes.Buffer, pos token.SourcePosition, indent, start int) {
+   for p.next < len(p.comments) && before(p.comments[p.next].Position, pos) {
+      comment := p.comments[p.next]
+      p.next += 1
+      if p.isTrailing(comment) && out.Len() > 0 && out.Bytes()[out.Len() - 1] == '\n' {
+         out.Truncate(out.Len() - 1)
+         out.WriteString(" " + comment.Literal + "\n")
+         continue
+      }
+      if out.Len() > start && p.blankBefore(comment.Position.Line) {
+         out.WriteString("\n")
+      }
+      out.WriteString(pad(indent) + comment.Literal + "\n")
+   }
+}
+
+func before(a, b token.SourcePosition) bool {
+   return a.Line < b.Line || (a.Line == b.Line && a.Char < b.Char)
+}
+
+// whether code precedes the comment on its line
+func (p *printer) isTrailing(comment token.Token) bool {
+   if comment.Position.Line > len(p.lines) {
+      return false
+   }
+   line := p.lines[comment.Position.Line - 1]
+   return strings.TrimSpace(line[:min(comment.Position.Char - 1, len(line))]) != ""
+}
+
+func (p *printer) blankBefore(line int) bool {
+   return line > 1 && line - 1 <= len(p.lines) && strings.TrimSpace(p.lines[line - 2]) == ""
+}
+
+// whether a comment starts before pos
+func (p *printer) commentBefore(pos token.SourcePosition) bool {
+   return p.next < len(p.comments) && before(p.comments[p.next].Position, pos)
+}
+
+func pad(indent int) string {
+   return strings.Repeat(indentUnit, indent)
+}
+
+func (p *printer) statement(stmt ast.Statement, indent int, last bool) string {
+   col := len(pad(indent))
+   switch stmt := stmt.(type) {
+      case *ast.LetStatement:
+         prefix := "let " + stmt.Name.Value + " = "
+         return prefix + p.expr(stmt.Value, parser.LOWEST, indent, col + len(prefix)) + ";"
+      case *ast.ReturnStatement:
+         return "return " + p.expr(stmt.ReturnValue, parser.LOWEST, indent, col + len("return ")) + ";"
+      case *ast.ExpressionStatement:
+         if last {
+            return p.expr(stmt.Expression, parser.LOWEST, indent, col)
+         }
+         return p.expr(stmt.Expression, parser.LOWEST, indent, col) + ";"
+      case *ast.BlockStatement:
+         return p.block(stmt, indent)
+      default:
+         return stmt.String()
+   }
+}
+
+// "{", the statements one level deeper, "}"
+func (p *printer) block(block *ast.BlockStatement, indent int) string {
+   if len(block.Statements) == 0 && !p.commentBefore(block.Rbrace.Position) {
+      return "{}"
+   }
+   var out bytes.Buffer
+   out.WriteString("{\n")
+   p.statements(&out, block.Statements, block.Rbrace.Position, indent + 1)
+   out.WriteString(pad(indent) + "}")
+   return out.String()
+}
+
+// binding power of an expression, operands that bind weaker need parentheses
+func precedence(e ast.Expression) int {
+   switch e := e.(type) {
+      case *ast.InfixExpression:
+         return parser.Precedence(e.Token.Type)
+      case *ast.PrefixExpression:
+         return parser.PREFIX
+      case *ast.CallExpression:
+         return parser.CALL
+      case *ast.IndexExpression:
+         return parser.INDEX
+      default: // literals, identifiers, if and fn
+         return parser.INDEX + 1
+   }
+}
+
+// e rendered at column col, with parentheses if it binds weaker than prec
+func (p *printer) expr(e ast.Expression, prec int, indent, col int) string {
+   if precedence(e) < prec {
+      return "(" + p.bareExpr(e, indent, col + 1) + ")"
+   }
+   return p.bareExpr(e, indent, col)
+}
+
+func (p *printer) bareExpr(e ast.Expression, indent, col int) string {
+   switch e := e.(type) {
+      case *ast.Identifier:
+         return e.Value
+      case *ast.IntegerLiteral:
+         return e.Token.Literal
+      case *ast.StringLiteral:
+         return `"` + e.Value + `"`
+      case *ast.RegexLiteral:
+         return e.String()
+      case *ast.Boolean:
+         return e.Token.Literal
+      case *ast.PrefixExpression:
+         return e.Operator + p.expr(e.Right, parser.PREFIX, indent, col + len(e.Operator))
+      case *ast.InfixExpression:
+         prec := parser.Precedence(e.Token.Type)
+         left := p.expr(e.Left, prec, indent, col)
+         op := " " + e.Operator + " "
+         right := p.expr(e.Right, prec + 1, indent, lastColumn(left, col) + len(op)) // left-associative
+         return left + op + right
+      case *ast.CallExpression:
+         function := p.expr(e.Function, parser.CALL, indent, col)
+         return function + p.list("(", ")", p.exprItems(e.Arguments), indent, lastColumn(function, col))
+      case *ast.IndexExpression:
+         left := p.expr(e.Left, parser.CALL, indent, col)
+         index := p.expr(e.Index, parser.LOWEST, indent, lastColumn(left, col) + 1)
+         return left + "[" + index + "]"
+      case *ast.ArrayLiteral:
+         return p.list("[", "]", p.exprItems(e.Elements), indent, col)
+      case *ast.HashLiteral:
+         items := make([]listItem, len(e.Keys))
+         for i, key := range e.Keys {
+            key, value := key, e.Pairs[key]
+            items[i].render = func(indent, col int) string {
+               k := p.expr(key, parser.LOWEST, indent, col)
+               return k + ": " + p.expr(value, parser.LOWEST, indent, lastColumn(k, col) + 2)
+            }
+            items[i].hanging = hasBlock(value)
+         }
+         return p.list("{", "}", items, indent, col)
+      case *ast.FunctionLiteral:
+         params := make([]string, len(e.Parameters))
+         for i, param := range e.Parameters {
+            params[i] = param.Value
+         }
+         head := "fn(" + strings.Join(params, ", ") + ") "
+         if body := p.inlineBody(e.Body, indent, col + width(head)); body != "" {
+            return head + body
+         }
+         return head + p.block(e.Body, indent)
+      case *ast.IfExpression:
+         head := "if ("
+         cond := p.expr(e.Condition, parser.LOWEST, indent, col + len(head))
+         result := head + cond + ") " + p.block(e.Consequence, indent)
+         if e.Alternative != nil {
+            result += " else " + p.block(e.Alternative, indent)
+         }
+         return result
+      default:
+         return e.String()
+   }
+}
+
+// "{ expr }" for a body of one expression that fits on the line, "" otherwise
+func (p *printer) inlineBody(body *ast.BlockStatement, indent, col int) string {
+   if len(body.Statements) != 1 || p.commentBefore(body.Rbrace.Position) {
+      return ""
+   }
+   stmt, ok := body.Statements[0].(*ast.ExpressionStatement)
+   if !ok {
+      return ""
+   }
+   next := p.next
+   inline := "{ " + p.expr(stmt.Expression, parser.LOWEST, indent, col + 2) + " }"
+   if strings.Contains(inline, "\n") || col + width(inline) > MaxWidth {
+      p.next = next
+      return ""
+   }
+   return inline
+}
+
+type listItem struct {
+   render  func(indent, col int) string
+   hanging bool // may span lines as the last item of an unwrapped list, e.g. f(x, fn(y) { ... })
+}
+
+func (p *printer) exprItems(exprs []ast.Expression) []listItem {
+   items := make([]listItem, len(exprs))
+   for i, e := range exprs {
+      e := e
+      items[i].render = func(indent, col int) string { return p.expr(e, parser.LOWEST, indent, col) }
+      items[i].hanging = hasBlock(e)
+   }
+   return items
+}
+
+func hasBlock(e ast.Expression) bool {
+   switch e.(type) {
+      case *ast.FunctionLiteral, *ast.IfExpression:
+         return true
+      default:
+         return false
+   }
+}
+
+/*
+ * list: delimited, comma-separated items
+ *    ~ on one line if that fits, where only a hanging last item may span lines
+ *    ~ wrapped otherwise: one item per line, one level deeper
+ */
+func (p *printer) list(open, close string, items []listItem, indent, col int) string {
+   if len(items) == 0 {
+      return open + close
+   }
+
+   next := p.next
+   rendered := make([]string, len(items))
+   c := col + len(open)
+   fits := true
+   for i, item := range items {
+      rendered[i] = item.render(indent, c)
+      if (i < len(items) - 1 || !item.hanging) && strings.Contains(rendered[i], "\n") {
+         fits = false
+         break
+      }
+      c = lastColumn(rendered[i], c) + len(", ")
+   }
+   if fits {
+      inline := open + strings.Join(rendered, ", ") + close
+      if col + width(firstLine(inline)) <= MaxWidth {
+         return inline
+      }
+   }
+
+   p.next = next // render again
+   var out bytes.Buffer
+   out.WriteString(open + "\n")
+   for i, item := range items {
+      out.WriteString(pad(indent + 1) + item.render(indent + 1, len(pad(indent + 1))))
+      if i < len(items) - 1 {
+         out.WriteString(",")
+      }
+      out.WriteString("\n")
+   }
+   out.WriteString(pad(indent) + close)
+   return out.String()
+}
+
+func width(s string) int {
+   return utf8.RuneCountInString(s)
+}
+
+func firstLine(s string) string {
+   if i := strings.IndexByte(s, '\n'); i >= 0 {
+      return s[:i]
+   }
+   return s
+}
+
+// column after s, when s is printed at column col
+func lastColumn(s string, col int) int {
+   if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+      return width(s[i + 1:])
+   }
+   return col + width(s)
+}
@@ -0,0 +1,104 @@
+package format
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"monkey/corpus"
+	"monkey/lexer"
+	monkeyparser "monkey/parser"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = (1 + (2 * 3))", "let x = 1 + 2 * 3;\n"},
+		{"let y = (a + b) * c - (d - e);", "let y = (a + b) * c - (d - e);\n"},
+		{"a - (b - c); (a - b) - c", "a - (b - c);\na - b - c\n"},
+		{"-(a + b); !(!x); -a[0]; (-a)[0]; f(1)[0]; (f)(1)", "-(a + b);\n!!x;\n-a[0];\n(-a)[0];\nf(1)[0];\nf(1)\n"},
+		{"a == (b || c); (a == b) || c", "a == b || c;\n(a == b) || c\n"},
+		{"return 1\nreturn (2)", "return 1;\nreturn 2;\n"},
+		{"if (x) { 1 } else { 2 }", "if (x) {\n   1\n} else {\n   2\n}\n"},
+		{"if(x){}", "if (x) {}\n"},
+		{"let f = fn(x, y) { x + y };", "let f = fn(x, y) { x + y };\n"},
+		{"let f = fn(x) { let y = x; y };", "let f = fn(x) {\n   let y = x;\n   y\n};\n"},
+		{"map(a, fn(x) {\n x * 2\n})", "map(a, fn(x) { x * 2 })\n"},
+		{"f();\n(1)", "f();\n1\n"},
+		{`{"a": 1, true: [], 2: /x\/y/i}`, "{\"a\": 1, true: [], 2: /(?i)x\\/y/}\n"},
+		{
+			"print(\"a long string argument\", \"another long string argument\", [1, 2, 3, 4, 5, 6])",
+			"print(\n   \"a long string argument\",\n   \"another long string argument\",\n   [1, 2, 3, 4, 5, 6]\n)\n",
+		},
+		{
+			"let h = {\"one\": 1, \"two\": fn(x) { if (x) { 1 } else { 2 } }, \"three\": [1, 2, 3]};",
+			"let h = {\n   \"one\": 1,\n   \"two\": fn(x) {\n      if (x) {\n         1\n      } else {\n         2\n      }\n   },\n   \"three\": [1, 2, 3]\n};\n",
+		},
+		{
+			"each(items, fn(item) { let doubled = item * 2; puts(doubled) })",
+			"each(items, fn(item) {\n   let doubled = item * 2;\n   puts(doubled)\n})\n",
+		},
+		// comments and blank lines
+		{"// header\n\n\n\nlet x = 1; // one\nlet y = 2;", "// header\n\nlet x = 1; // one\nlet y = 2;\n"},
+		{"let f = fn(x) { // start\n  x\n  // end\n};\n// last", "let f = fn(x) { // start\n   x\n   // end\n};\n// last\n"},
+		{"fn() {\n// only a comment\n}", "fn() {\n   // only a comment\n}\n"},
+		{"let a = [1, // one\n2];", "let a = [1, 2]; // one\n"},
+		{"let s = \"a\nb\"; // c\nlet t = 1;", "let s = \"a\nb\"; // c\nlet t = 1;\n"},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) failed: %s", tt.input, err)
+			continue
+		}
+		if string(formatted) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot= %q", tt.input, tt.expected, formatted)
+		}
+	}
+
+	if _, err := Source([]byte("let = 1;")); err == nil {
+		t.Errorf("expected parser error")
+	}
+}
+
+// every Monkey program in the parser tests (and the examples) formats to a fixed point with the same AST
+func TestIdempotency(t *testing.T) {
+	inputs, err := corpus.StringLiterals("../parser/parser_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	examples, err := ioutil.ReadFile("../examples/examples.mo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs = append(inputs, string(examples))
+
+	checked := 0
+	for _, input := range inputs {
+		p := monkeyparser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 || len(program.Statements) == 0 {
+			continue // not a program, e.g. an expected value
+		}
+		checked += 1
+
+		formatted, err := Source([]byte(input))
+		if err != nil {
+			t.Errorf("Source(%q) failed: %s", input, err)
+			continue
+		}
+		again, err := Source(formatted)
+		if err != nil || string(again) != string(formatted) {
+			t.Errorf("not idempotent for %q.\nfirst= %q\nsecond=%q (%v)", input, formatted, again, err)
+		}
+		reparsed := monkeyparser.New(lexer.New(string(formatted))).ParseProgram()
+		if reparsed.String() != program.String() {
+			t.Errorf("AST changed for %q.\nwant=%q\ngot= %q", input, program.String(), reparsed.String())
+		}
+	}
+	if checked < 50 {
+		t.Errorf("too few programs checked. got=%d", checked)
+	}
+}
@@ -0,0 +1,71 @@
+package framing
+
+import (
+   "bufio"
+   "fmt"
+   "io"
+   "strconv"
+   "strings"
+)
+
+/*
+ * Base protocol of the language server and debug adapter protocols: each message is
+ * a header part and a JSON content part
+ *    ~ header fields are "Name: value\r\n", the header ends with an empty line
+ *    ~ Content-Length (required) is the length of the content in bytes, at most MaxContentLength
+ *    ~ Read returns io.EOF only if the input ends before a message, io.ErrUnexpectedEOF within one
+ */
+const MaxContentLength = 64 << 20 // 64 MiB
+
+func Read(r *bufio.Reader) ([]byte, error) {
+   length := -1
+   for {
+      line, err := r.ReadString('\n')
+      if err != nil {
+         if err == io.EOF && line == "" && length < 0 {
+            return nil, io.EOF
+         }
+         return nil, fmt.Errorf("reading header: %s", errUnexpectedEOF(err))
+      }
+      line = strings.TrimRight(line, "\r\n")
+      if line == "" {
+         break
+      }
+      name, value, ok := strings.Cut(line, ":")
+      if !ok {
+         return nil, fmt.Errorf("malformed header line %q", line)
+      }
+      if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+         length, err = strconv.Atoi(strings.TrimSpace(value))
+         if err != nil || length < 0 {
+            return nil, fmt.Errorf("invalid Content-Length %q", value)
+         }
+         if length > MaxContentLength {
+            return nil, fmt.Errorf("Content-Length %d exceeds the maximum of %d bytes", length, MaxContentLength)
+         }
+      }
+   }
+   if length < 0 {
+      return nil, fmt.Errorf("missing Content-Length header")
+   }
+   content := make([]byte, length)
+   if _, err := io.ReadFull(r, content); err != nil {
+      return nil, fmt.Errorf("reading content: %s", errUnexpectedEOF(err))
+   }
+   return content, nil
+}
+
+func errUnexpectedEOF(err error) error {
+   if err == io.EOF {
+      return io.ErrUnexpectedEOF
+   }
+   return err
+}
+
+func Write(w io.Writer, content []byte) error {
+   if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+      return err
+   }
+   _, err := w.Write(content)
+   return err
+}
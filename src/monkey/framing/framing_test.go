@@ -0,0 +1,53 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	var buf bytes.Buffer
+	for _, content := range []string{`{"a":1}`, `{}`} {
+		if err := Write(&buf, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.WriteString("content-length: 2\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n[]")
+
+	r := bufio.NewReader(&buf)
+	for _, expected := range []string{`{"a":1}`, `{}`, `[]`} {
+		content, err := Read(r)
+		if err != nil || string(content) != expected {
+			t.Errorf("wrong content. want=%q, got=%q (%v)", expected, content, err)
+		}
+	}
+	if _, err := Read(r); err != io.EOF {
+		t.Errorf("wrong error at the end. want=EOF, got=%v", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Content-Type: x\r\n\r\n{}", "missing Content-Length header"},
+		{"Content-Length: x\r\n\r\n{}", `invalid Content-Length " x"`},
+		{"Content-Length: -1\r\n\r\n", `invalid Content-Length " -1"`},
+		{"Content-Length 2\r\n\r\n{}", `malformed header line "Content-Length 2"`},
+		{"Content-Length: 40\r\n\r\n{}", "reading content: unexpected EOF"},
+		{"Content-Length: 2\r\n", "reading header: unexpected EOF"},
+		{fmt.Sprintf("Content-Length: %d\r\n\r\n", MaxContentLength + 1), "Content-Length 67108865 exceeds the maximum of 67108864 bytes"},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(bufio.NewReader(strings.NewReader(tt.input)))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
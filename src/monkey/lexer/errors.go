@@ -0,0 +1,55 @@
+package lexer
+
+import (
+   "fmt"
+   "monkey/token"
+)
+
+/*
+ * Lexer errors: malformed input is returned as an ILLEGAL token and recorded as an error
+ *    ~ Pos is the start of the offending text, End just after it (on a later line for strings spanning lines)
+ *    ~ the parser reports them in place of its own error for the ILLEGAL token
+ */
+type ErrorKind int
+
+const (
+   UnterminatedString ErrorKind = iota
+   UnterminatedRegex
+   InvalidCharacter
+   BadEscape
+   BadRegexFlags
+   MalformedNumber
+)
+
+type Error struct {
+   Kind    ErrorKind
+   Pos     token.SourcePosition
+   End     token.SourcePosition
+   Message string
+   token   token.SourcePosition // of the ILLEGAL token, which may start before Pos, e.g. a regex with bad flags
+}
+
+// "line:char: message"
+func (e *Error) Error() string {
+   return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Char, e.Message)
+}
+
+// errors of the tokens read so far, in source order
+func (l *Lexer) Errors() []*Error {
+   return l.errors
+}
+
+// the error of the ILLEGAL token at pos, nil if there is none
+func (l *Lexer) ErrorAt(pos token.SourcePosition) *Error {
+   for _, err := range l.errors {
+      if err.token == pos {
+         return err
+      }
+   }
+   return nil
+}
+
+// an error in the ILLEGAL token at tok
+func (l *Lexer) errorf(kind ErrorKind, tok, pos, end token.SourcePosition, format string, a ...interface{}) {
+   l.errors = append(l.errors, &Error{Kind: kind, Pos: pos, End: end, Message: fmt.Sprintf(format, a...), token: tok})
+}
@@ -1,10 +1,9 @@
 package lexer
 
 import (
-   "errors"
 	"monkey/token"
-   "fmt"
-   "os"
+   "strings"
+   "unicode/utf8"
 )
 
 type Lexer struct {
@@ -13,19 +12,34 @@ type Lexer struct {
 	readIndex      int                  // read index (next char)
    ch             byte                 // current char
    position       token.SourcePosition // source position
+   prev           token.TokenType      // type of the previous token
+   comments       []token.Token        // skipped comments, in source order
+   errors         []*Error             // errors of the ILLEGAL tokens read so far
+   eof            bool                 // l.position is just after the input
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, position: token.SourcePosition{Line: 1}}
    // initialize l.index, l.readIndex, and l.ch
 	l.readChar() 
 	return l
 }
 
 func (l *Lexer) NextToken() token.Token {
+   tok := l.nextToken()
+   tok.End = l.position // tokens end before l.ch
+   l.prev = tok.Type
+   return tok
+}
+
+func (l *Lexer) nextToken() token.Token {
 	var tok token.Token
 
    l.skipWhitespace()
+   for l.ch == '/' && l.peekChar() == '/' {
+      l.readComment()
+      l.skipWhitespace()
+   }
 
 	switch l.ch {
 	case '=':
@@ -38,13 +52,13 @@ func (l *Lexer) NextToken() token.Token {
       if l.peekChar() == '&' {
          tok = l.makeTwoCharToken(token.AND)
       } else {
-			tok = l.newToken(token.ILLEGAL) 
+			tok = l.invalidChar()
       }
    case '|':
       if l.peekChar() == '|' {
          tok = l.makeTwoCharToken(token.OR)
       } else {
-         tok = l.newToken(token.ILLEGAL)
+         tok = l.invalidChar()
       }
 	case '+':
 		tok = l.newToken(token.PLUS)
@@ -59,7 +73,16 @@ func (l *Lexer) NextToken() token.Token {
    case '*':
       tok = l.newToken(token.ASTERISK)
    case '/':
-      tok = l.newToken(token.SLASH)
+      if l.regexAllowed() {
+         position := l.position
+         re, ok := l.readRegex(position)
+         if ok {
+            return token.Token{Type: token.REGEX, Literal: re, Position: position}
+         }
+         return token.Token{Type: token.ILLEGAL, Literal: re, Position: position} // l.ch is not part of the regex
+      } else {
+         tok = l.newToken(token.SLASH)
+      }
    case '<':
       tok = l.newToken(token.LT)
    case '>':
@@ -84,16 +107,17 @@ func (l *Lexer) NextToken() token.Token {
       tok = l.newToken(token.RBRACKET)
    case '"':
       position := l.position 
-      str, err := l.readString()
-      if err == nil {
+      str, ok := l.readString()
+      if ok {
          tok = token.Token{Type: token.STRING, Literal: str, Position: position}
       } else {
          tok = token.Token{Type: token.ILLEGAL, Literal: str, Position: position}
-         fmt.Fprintf(os.Stderr, "%s (%s)", err, position.String())
+         l.errorf(UnterminatedString, position, position, l.position, "unterminated string")
       }
 	case 0:
 		tok.Type = token.EOF
 		tok.Literal = ""
+      tok.Position = l.position // just after the input
 	default:
 		if isLetter(l.ch) {     
          // keyword or identifier
@@ -104,10 +128,15 @@ func (l *Lexer) NextToken() token.Token {
          // integer
          position := l.position
          num := l.readNumber()
+         if isLetter(l.ch) { // e.g. 12abc
+            num += l.readIdentifier()
+            l.errorf(MalformedNumber, position, position, l.position, "malformed number %q", num)
+            return token.Token{Type: token.ILLEGAL, Literal: num, Position: position}
+         }
          return token.Token{Type: token.INT, Literal: num, Position: position}
       } else {
          // error
-			tok = l.newToken(token.ILLEGAL) 
+			tok = l.invalidChar()
 		}
 	}
 
@@ -118,9 +147,15 @@ func (l *Lexer) NextToken() token.Token {
 func (l *Lexer) readChar() {
 	if l.readIndex >= len(l.input) {
 		l.ch = 0
+      if !l.eof {
+         l.eof = true
+         l.position.Char += 1
+         l.position.Offset = len(l.input)
+      }
 	} else {
 		l.ch = l.input[l.readIndex]
       l.position.Char += 1
+      l.position.Offset = l.readIndex
 	}
 	l.index = l.readIndex
 	l.readIndex += 1
@@ -159,19 +194,112 @@ func isDigit(ch byte) bool {
       
 }
 
-func (l *Lexer) readString() (string, error) {
+// comments (// to the end of the line) skipped so far, e.g. for a formatter to put back
+func (l *Lexer) Comments() []token.Token {
+   return l.comments
+}
+
+func (l *Lexer) readComment() {
+   position := l.position
+   comment := strings.TrimRight(l.readLiteral(func(ch byte) bool { return ch != '\n' && ch != 0 }), " \t\r")
+   end := token.SourcePosition{Line: position.Line, Char: position.Char + len(comment), Offset: position.Offset + len(comment)}
+   l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: comment, Position: position, End: end})
+}
+
+// the contents of a string, false if the input ends first
+func (l *Lexer) readString() (string, bool) {
    index := l.index + 1 // don't include "s in token
    for {
       l.readChar()
+      if l.ch == '\n' { // strings may span lines
+         l.position.Line += 1
+         l.position.Char = 0
+      }
       switch (l.ch) {
          case '"':
-            return l.input[index:l.index], nil
+            return l.input[index:l.index], true
          case 0:
-            return l.input[index:l.index], errors.New("readString: could not tokenize non-terminated string") 
+            return l.input[index:l.index], false
       }
    }
 }
 
+/*
+ * Regex literals: /pattern/flags
+ *    ~ a '/' starts a regex only at the start of an operand that can sensibly be a regex
+ *      (after "=", "(", "[", "{", ",", ":", ";", "return", "==", "!=", "&&", "||"), it divides otherwise
+ *    ~ "\/" stands for '/', other escapes are passed to the regex engine unchanged
+ *    ~ flags i, m, s and U are prepended to the pattern as (?flags)
+ *    ~ "//" always starts a comment, the empty regex is written /(?:)/
+ */
+func (l *Lexer) regexAllowed() bool {
+   switch l.prev {
+      case "", token.ASSIGN, token.LPAREN, token.LBRACKET, token.LBRACE, token.COMMA, token.COLON, token.SEMICOLON,
+         token.RETURN, token.EQ, token.NOT_EQ, token.AND, token.OR:
+         return true
+      default:
+         return false
+   }
+}
+
+// the pattern of a regex starting at position, false (with l.ch just after the bad input) on errors
+func (l *Lexer) readRegex(position token.SourcePosition) (string, bool) {
+   var pattern strings.Builder
+   for {
+      l.readChar()
+      switch l.ch {
+         case '/':
+            l.readChar()
+            flagsPosition := l.position
+            flags := l.readLiteral(isLetter)
+            if strings.Trim(flags, "imsU") != "" {
+               l.errorf(BadRegexFlags, position, flagsPosition, l.position, "unknown regex flags %q", flags)
+               return pattern.String(), false
+            }
+            if flags != "" {
+               return "(?" + flags + ")" + pattern.String(), true
+            }
+            return pattern.String(), true
+         case '\\':
+            if l.peekChar() == '\n' {
+               escape := l.position
+               l.readChar()
+               l.errorf(BadEscape, position, escape, l.position, "bad escape: \\ at the end of a line")
+               return pattern.String(), false
+            }
+            if l.peekChar() == '/' {
+               l.readChar()
+            } else {
+               pattern.WriteByte(l.ch)
+               l.readChar()
+            }
+            if l.ch == 0 {
+               l.errorf(UnterminatedRegex, position, position, l.position, "unterminated regex")
+               return pattern.String(), false
+            }
+            pattern.WriteByte(l.ch)
+         case 0, '\n':
+            l.errorf(UnterminatedRegex, position, position, l.position, "unterminated regex")
+            return pattern.String(), false
+         default:
+            pattern.WriteByte(l.ch)
+      }
+   }
+}
+
+// an ILLEGAL token for the character (possibly multi-byte) at l.ch
+func (l *Lexer) invalidChar() token.Token {
+   position := l.position
+   _, size := utf8.DecodeRuneInString(l.input[l.index:])
+   literal := l.input[l.index:l.index + size]
+   for i := 1; i < size; i++ {
+      l.readChar()
+   }
+   end := token.SourcePosition{Line: position.Line, Char: position.Char + size, Offset: position.Offset + size}
+   l.errorf(InvalidCharacter, position, position, end, "invalid character %q", literal)
+   return token.Token{Type: token.ILLEGAL, Literal: literal, Position: position}
+}
+
 func (l *Lexer) newToken(tt token.TokenType) token.Token {
 	return token.Token{Type: tt, Literal: string(l.ch), Position: l.position}
 }
@@ -172,3 +172,115 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestRegexLiterals(t *testing.T) {
+   input := `let r = /a\/b\d+/i; r / 2; x = (/[a-z]/ == /y/s);`
+
+   tests := []ExpectedToken{
+      {token.LET, "let"},
+      {token.IDENT, "r"},
+      {token.ASSIGN, "="},
+      {token.REGEX, `(?i)a/b\d+`},
+      {token.SEMICOLON, ";"},
+      {token.IDENT, "r"},
+      {token.SLASH, "/"},
+      {token.INT, "2"},
+      {token.SEMICOLON, ";"},
+      {token.IDENT, "x"},
+      {token.ASSIGN, "="},
+      {token.LPAREN, "("},
+      {token.REGEX, "[a-z]"},
+      {token.EQ, "=="},
+      {token.REGEX, "(?s)y"},
+      {token.RPAREN, ")"},
+      {token.SEMICOLON, ";"},
+      {token.EOF, ""},
+   }
+
+   l := New(input)
+   for i, ttok := range tests {
+      tok := l.NextToken()
+      if tok.Type != ttok.expectedType || tok.Literal != ttok.expectedLiteral {
+         t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q", i, ttok.expectedType, ttok.expectedLiteral, tok.Type, tok.Literal)
+      }
+   }
+
+   for _, input := range []string{"= /abc", "= /abc\n/", "= /abc/x"} {
+      l := New(input)
+      l.NextToken()
+      if tok := l.NextToken(); tok.Type != token.ILLEGAL {
+         t.Errorf("%q - expected ILLEGAL token. got=%q", input, tok.Type)
+      }
+   }
+}
+
+func TestLexerErrors(t *testing.T) {
+   tests := []struct {
+      input    string
+      kind     ErrorKind
+      pos, end token.SourcePosition
+      message  string
+   }{
+      {`x = "abc`, UnterminatedString, token.SourcePosition{Line: 1, Char: 5, Offset: 4}, token.SourcePosition{Line: 1, Char: 9, Offset: 8}, "unterminated string"},
+      {"x = \"a\nb", UnterminatedString, token.SourcePosition{Line: 1, Char: 5, Offset: 4}, token.SourcePosition{Line: 2, Char: 2, Offset: 8}, "unterminated string"},
+      {"x = /abc\n", UnterminatedRegex, token.SourcePosition{Line: 1, Char: 5, Offset: 4}, token.SourcePosition{Line: 1, Char: 9, Offset: 8}, "unterminated regex"},
+      {"x = /a/ix", BadRegexFlags, token.SourcePosition{Line: 1, Char: 8, Offset: 7}, token.SourcePosition{Line: 1, Char: 10, Offset: 9}, `unknown regex flags "ix"`},
+      {"x = /a\\\n/", BadEscape, token.SourcePosition{Line: 1, Char: 7, Offset: 6}, token.SourcePosition{Line: 1, Char: 8, Offset: 7}, `bad escape: \ at the end of a line`},
+      {"x = 12ab + 1", MalformedNumber, token.SourcePosition{Line: 1, Char: 5, Offset: 4}, token.SourcePosition{Line: 1, Char: 9, Offset: 8}, `malformed number "12ab"`},
+      {"x # 1", InvalidCharacter, token.SourcePosition{Line: 1, Char: 3, Offset: 2}, token.SourcePosition{Line: 1, Char: 4, Offset: 3}, `invalid character "#"`},
+      {"x = é", InvalidCharacter, token.SourcePosition{Line: 1, Char: 5, Offset: 4}, token.SourcePosition{Line: 1, Char: 7, Offset: 6}, `invalid character "é"`},
+      {"a & b", InvalidCharacter, token.SourcePosition{Line: 1, Char: 3, Offset: 2}, token.SourcePosition{Line: 1, Char: 4, Offset: 3}, `invalid character "&"`},
+   }
+
+   for _, tt := range tests {
+      l := New(tt.input)
+      illegal := 0
+      for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+         if tok.Type == token.ILLEGAL {
+            illegal += 1
+            if l.ErrorAt(tok.Position) == nil {
+               t.Errorf("%q - no error for ILLEGAL token %q", tt.input, tok.Literal)
+            }
+         }
+      }
+      errors := l.Errors()
+      if len(errors) != 1 || illegal != 1 {
+         t.Errorf("%q - wrong number of errors/ILLEGAL tokens. want=1/1, got=%d/%d", tt.input, len(errors), illegal)
+         continue
+      }
+      err := errors[0]
+      if err.Kind != tt.kind || err.Pos != tt.pos || err.End != tt.end || err.Message != tt.message {
+         t.Errorf("%q - wrong error. want=%d %+v-%+v %q, got=%d %+v-%+v %q", tt.input,
+            tt.kind, tt.pos, tt.end, tt.message, err.Kind, err.Pos, err.End, err.Message)
+      }
+   }
+}
+
+func TestTokenPositions(t *testing.T) {
+   input := "let s = \"a\nb\";\n  x /r/i"
+
+   tests := []struct {
+      literal   string
+      pos, end  token.SourcePosition
+   }{
+      {"let", token.SourcePosition{Line: 1, Char: 1, Offset: 0}, token.SourcePosition{Line: 1, Char: 4, Offset: 3}},
+      {"s", token.SourcePosition{Line: 1, Char: 5, Offset: 4}, token.SourcePosition{Line: 1, Char: 6, Offset: 5}},
+      {"=", token.SourcePosition{Line: 1, Char: 7, Offset: 6}, token.SourcePosition{Line: 1, Char: 8, Offset: 7}},
+      {"a\nb", token.SourcePosition{Line: 1, Char: 9, Offset: 8}, token.SourcePosition{Line: 2, Char: 3, Offset: 13}},
+      {";", token.SourcePosition{Line: 2, Char: 3, Offset: 13}, token.SourcePosition{Line: 2, Char: 4, Offset: 14}},
+      {"x", token.SourcePosition{Line: 3, Char: 3, Offset: 17}, token.SourcePosition{Line: 3, Char: 4, Offset: 18}},
+      {"/", token.SourcePosition{Line: 3, Char: 5, Offset: 19}, token.SourcePosition{Line: 3, Char: 6, Offset: 20}},
+      {"r", token.SourcePosition{Line: 3, Char: 6, Offset: 20}, token.SourcePosition{Line: 3, Char: 7, Offset: 21}},
+      {"/", token.SourcePosition{Line: 3, Char: 7, Offset: 21}, token.SourcePosition{Line: 3, Char: 8, Offset: 22}},
+      {"i", token.SourcePosition{Line: 3, Char: 8, Offset: 22}, token.SourcePosition{Line: 3, Char: 9, Offset: 23}},
+      {"", token.SourcePosition{Line: 3, Char: 9, Offset: 23}, token.SourcePosition{Line: 3, Char: 9, Offset: 23}},
+   }
+
+   l := New(input)
+   for i, tt := range tests {
+      tok := l.NextToken()
+      if tok.Literal != tt.literal || tok.Position != tt.pos || tok.End != tt.end {
+         t.Errorf("tests[%d] - wrong token. want=%q %+v-%+v, got=%q %+v-%+v", i, tt.literal, tt.pos, tt.end, tok.Literal, tok.Position, tok.End)
+      }
+   }
+}
@@ -0,0 +1,179 @@
+package lint
+
+import (
+   "errors"
+   "fmt"
+   "sort"
+   "strings"
+   "monkey/ast"
+   "monkey/evaluator"
+   "monkey/lexer"
+   "monkey/parser"
+   "monkey/token"
+)
+
+/*
+ * Linter: static checks on a parsed program, nothing is evaluated
+ *    ~ bindings and scopes are those of the resolver (evaluator.Analyze)
+ *    ~ unused bindings are reported inside functions only, top-level bindings may be used by later input
+ *      (REPL, :load); names starting with '_' are never reported as unused
+ *    ~ diagnostics are ordered by position
+ */
+const (
+   UNUSED      = "unused"      // let binding or parameter never referred to
+   SHADOW      = "shadow"      // binding hides an outer binding or a builtin
+   UNDEFINED   = "undefined"   // identifier bound neither by let, parameter, nor builtin
+   ARITY       = "arity"       // builtin called with the wrong number of arguments
+   UNREACHABLE = "unreachable" // statement after return
+   CONSTANT    = "constant"    // if condition that does not depend on anything
+)
+
+type Diagnostic struct {
+   Pos     token.SourcePosition
+   End     token.SourcePosition // end of the node the diagnostic is about
+   Check   string
+   Message string
+}
+
+// "line:char: message (check)"
+func (d Diagnostic) String() string {
+   return fmt.Sprintf("%d:%d: %s (%s)", d.Pos.Line, d.Pos.Char, d.Message, d.Check)
+}
+
+// lints Monkey source, fails if it does not parse
+func Source(src []byte) ([]Diagnostic, error) {
+   p := parser.New(lexer.New(string(src)))
+   program := p.ParseProgram()
+   if len(p.Errors()) != 0 {
+      return nil, errors.New(strings.Join(p.Errors(), "\n"))
+   }
+   return Program(program), nil
+}
+
+func Program(program *ast.Program) []Diagnostic {
+   l := &linter{diagnostics: []Diagnostic{}, symbols: evaluator.Analyze(program)}
+   ast.Inspect(program, l.check)
+   l.checkBindings()
+   sort.SliceStable(l.diagnostics, func(i, j int) bool {
+      return l.diagnostics[i].Pos.Offset < l.diagnostics[j].Pos.Offset
+   })
+   return l.diagnostics
+}
+
+type linter struct {
+   diagnostics []Diagnostic
+   symbols     *evaluator.Symbols
+}
+
+func (l *linter) report(node ast.Node, check, format string, a ...interface{}) {
+   l.diagnostics = append(l.diagnostics, Diagnostic{Pos: node.Pos(), End: node.End(), Check: check, Message: fmt.Sprintf(format, a...)})
+}
+
+func (l *linter) check(node ast.Node) bool {
+   switch node := node.(type) {
+      case *ast.Program:
+         l.checkUnreachable(node.Statements)
+      case *ast.BlockStatement:
+         l.checkUnreachable(node.Statements)
+      case *ast.IfExpression:
+         if isConstant(node.Condition) {
+            l.report(node.Condition, CONSTANT, "condition %s is constant", node.Condition.String())
+         }
+      case *ast.CallExpression:
+         l.checkArity(node)
+   }
+   return true
+}
+
+// the statement following a return, the rest of the statements are still checked
+func (l *linter) checkUnreachable(stmts []ast.Statement) {
+   for i, stmt := range stmts {
+      if _, ok := stmt.(*ast.ReturnStatement); ok && i < len(stmts) - 1 {
+         l.report(stmts[i + 1], UNREACHABLE, "unreachable code after return")
+         return
+      }
+   }
+}
+
+// shadowing and unused bindings, undefined identifiers
+func (l *linter) checkBindings() {
+   for _, s := range l.symbols.Scopes {
+      seen := make(map[string]bool)
+      for _, b := range s.Bindings {
+         if !seen[b.Name] { // a let in the same scope rebinds the name
+            seen[b.Name] = true
+            l.checkShadow(b, s)
+         }
+         if s.Function == nil || len(b.Refs) > 0 || strings.HasPrefix(b.Name, "_") {
+            continue
+         }
+         if b.Parameter {
+            l.report(b.Decl, UNUSED, "unused parameter %s", b.Name)
+         } else {
+            l.report(b.Decl, UNUSED, "unused variable %s", b.Name)
+         }
+      }
+   }
+   for _, id := range l.symbols.Unresolved {
+      l.report(id, UNDEFINED, "identifier not found: %s", id.Value)
+   }
+}
+
+// a binding in a function body shadows the enclosing scopes
+func (l *linter) checkShadow(b *evaluator.Binding, s *evaluator.Scope) {
+   if outer := s.Outer.Lookup(b.Name); outer != nil {
+      pos := outer.Decl.Pos()
+      l.report(b.Decl, SHADOW, "%s shadows the binding at %d:%d", b.Name, pos.Line, pos.Char)
+   } else if _, _, ok := evaluator.BuiltinArity(b.Name); ok {
+      l.report(b.Decl, SHADOW, "%s shadows the builtin", b.Name)
+   }
+}
+
+// calls of builtins that are not shadowed by a binding
+func (l *linter) checkArity(call *ast.CallExpression) {
+   id, ok := call.Function.(*ast.Identifier)
+   if !ok || l.symbols.Uses[id] != nil {
+      return
+   }
+   min, max, ok := evaluator.BuiltinArity(id.Value)
+   if !ok {
+      return
+   }
+   got := len(call.Arguments)
+   if got >= min && (max < 0 || got <= max) {
+      return
+   }
+   var want string
+   switch {
+      case max < 0:
+         want = fmt.Sprintf("at least %d", min)
+      case min == max:
+         want = fmt.Sprintf("%d", min)
+      default:
+         want = fmt.Sprintf("%d to %d", min, max)
+   }
+   l.report(call, ARITY, "%s takes %s %s, got %d", id.Value, want, plural(min, max), got)
+}
+
+func plural(min, max int) string {
+   if max == 1 || (max < 0 && min == 1) {
+      return "argument"
+   }
+   return "arguments"
+}
+
+// whether an expression evaluates to the same value every time, without referring to any binding
+func isConstant(e ast.Expression) bool {
+   switch e := e.(type) {
+      case *ast.IntegerLiteral, *ast.StringLiteral, *ast.RegexLiteral, *ast.Boolean, *ast.FunctionLiteral:
+         return true
+      case *ast.ArrayLiteral, *ast.HashLiteral: // always truthy
+         return true
+      case *ast.PrefixExpression:
+         return isConstant(e.Right)
+      case *ast.InfixExpression:
+         return isConstant(e.Left) && isConstant(e.Right)
+      default:
+         return false
+   }
+}
@@ -0,0 +1,98 @@
+package lint
+
+import (
+   "os"
+   "testing"
+)
+
+func TestLint(t *testing.T) {
+   tests := []struct {
+      input    string
+      expected []string
+   }{
+      {"let x = 1; puts(x);", []string{}},
+      {"let f = fn(x) { let y = 2; x };", []string{"1:21: unused variable y (unused)"}},
+      {"let f = fn(x, y) { x };", []string{"1:15: unused parameter y (unused)"}},
+      {"let f = fn(x, _y) { x };", []string{}},
+      {"let unused = 1;", []string{}}, // top level
+      {"let f = fn(x) { let x = x + 1; x };", []string{}}, // rebinding in the same scope
+      {
+         "let x = 1;\nlet f = fn(x) { x };",
+         []string{"2:12: x shadows the binding at 1:5 (shadow)"},
+      },
+      {"let f = fn(len) { len };", []string{"1:12: len shadows the builtin (shadow)"}},
+      {"let g = fn() { h() }; let h = fn() { 1 };", []string{}}, // declared later, visible from the body
+      {"puts(y);", []string{"1:6: identifier not found: y (undefined)"}},
+      {"y; let y = 1;", []string{"1:1: identifier not found: y (undefined)"}},
+      {"let f = fn() { f() };", []string{}}, // recursion
+      {
+         "let x = 1;\nlet f = fn() { let h = fn() { x }; let r = h(); let x = 5; r };",
+         []string{"2:53: x shadows the binding at 1:5 (shadow)"},
+      },
+      {"push([1]);", []string{"1:1: push takes 2 arguments, got 1 (arity)"}},
+      {"len();", []string{"1:1: len takes 1 argument, got 0 (arity)"}},
+      {"range(1, 2, 3, 4);", []string{"1:1: range takes 1 to 3 arguments, got 4 (arity)"}},
+      {"zip();", []string{"1:1: zip takes at least 1 argument, got 0 (arity)"}},
+      {"puts(); puts(1, 2, 3);", []string{}},
+      {"let f = fn(push) { push() };", []string{"1:12: push shadows the builtin (shadow)"}}, // not the builtin
+      {
+         "let f = fn(x) {\n   return x;\n   puts(x);\n   x\n};",
+         []string{"3:4: unreachable code after return (unreachable)"},
+      },
+      {
+         "let f = fn(x) { if (x) { return 1; 2 } else { 3 } };",
+         []string{"1:36: unreachable code after return (unreachable)"},
+      },
+      {"if (true) { 1 }", []string{"1:5: condition true is constant (constant)"}},
+      {"if (1 < 2) { 1 }", []string{"1:5: condition (1 < 2) is constant (constant)"}},
+      {"if (!\"a\") { 1 }", []string{"1:5: condition (!a) is constant (constant)"}},
+      {"let x = 1; if (x < 2) { 1 }", []string{}},
+      {
+         "let f = fn(a) {\n   if (false) { b }\n};",
+         []string{
+            "1:12: unused parameter a (unused)",
+            "2:8: condition false is constant (constant)",
+            "2:17: identifier not found: b (undefined)",
+         },
+      },
+   }
+
+   for _, tt := range tests {
+      diagnostics, err := Source([]byte(tt.input))
+      if err != nil {
+         t.Errorf("%q: %s", tt.input, err)
+         continue
+      }
+      if len(diagnostics) != len(tt.expected) {
+         t.Errorf("%q: wrong number of diagnostics. got=%v, want=%v", tt.input, diagnostics, tt.expected)
+         continue
+      }
+      for i, d := range diagnostics {
+         if d.String() != tt.expected[i] {
+            t.Errorf("%q: wrong diagnostic. got=%q, want=%q", tt.input, d.String(), tt.expected[i])
+         }
+      }
+   }
+}
+
+func TestLintParseError(t *testing.T) {
+   if _, err := Source([]byte("let = 1;")); err == nil {
+      t.Errorf("no error for invalid source")
+   }
+}
+
+func TestLintExamples(t *testing.T) {
+   src, err := os.ReadFile("../examples/examples.mo")
+   if err != nil {
+      t.Fatal(err)
+   }
+   diagnostics, err := Source(src)
+   if err != nil {
+      t.Fatal(err)
+   }
+   for _, d := range diagnostics {
+      if d.Check == UNDEFINED || d.Check == ARITY {
+         t.Errorf("examples.mo:%s", d)
+      }
+   }
+}
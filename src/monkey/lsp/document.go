@@ -0,0 +1,130 @@
+package lsp
+
+import (
+   "sort"
+   "unicode/utf16"
+   "unicode/utf8"
+   "monkey/ast"
+   "monkey/evaluator"
+   "monkey/lexer"
+   "monkey/lint"
+   "monkey/parser"
+   "monkey/token"
+)
+
+/*
+ * Document: an open text document and what the server knows about it
+ *    ~ analysed again on every change: tokens, AST (also when it has errors), symbol index
+ *    ~ token and node positions are converted to LSP positions (0-based lines, UTF-16 columns)
+ *      through their byte offsets
+ */
+type document struct {
+   uri      string
+   text     string
+   lines    []int         // offset of the first byte of each line
+   tokens   []token.Token // without EOF
+   comments []token.Token
+   program  *ast.Program
+   errors   []*parser.Error
+   symbols  *evaluator.Symbols
+}
+
+func newDocument(uri, text string) *document {
+   d := &document{uri: uri, text: text, lines: []int{0}}
+   for i := 0; i < len(text); i++ {
+      if text[i] == '\n' {
+         d.lines = append(d.lines, i + 1)
+      }
+   }
+
+   l := lexer.New(text)
+   for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+      d.tokens = append(d.tokens, tok)
+   }
+   d.comments = l.Comments()
+
+   p := parser.New(lexer.New(text))
+   d.program = p.ParseProgram()
+   d.errors = p.Diagnostics()
+   d.symbols = evaluator.Analyze(d.program)
+   return d
+}
+
+func (d *document) position(offset int) Position {
+   line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i] > offset }) - 1
+   return Position{Line: line, Character: utf16Len(d.text[d.lines[line]:offset])}
+}
+
+// byte offset of an LSP position, clamped to its line
+func (d *document) offsetAt(p Position) int {
+   if p.Line < 0 {
+      return 0
+   }
+   if p.Line >= len(d.lines) {
+      return len(d.text)
+   }
+   offset, units := d.lines[p.Line], 0
+   for offset < len(d.text) && d.text[offset] != '\n' && units < p.Character {
+      r, size := utf8.DecodeRuneInString(d.text[offset:])
+      units += len(utf16.Encode([]rune{r}))
+      offset += size
+   }
+   return offset
+}
+
+func (d *document) rangeOf(start, end int) Range {
+   return Range{Start: d.position(start), End: d.position(end)}
+}
+
+func utf16Len(s string) int {
+   n := 0
+   for _, r := range s {
+      n += len(utf16.Encode([]rune{r}))
+   }
+   return n
+}
+
+func (d *document) nodeRange(node ast.Node) Range {
+   return d.rangeOf(node.Pos().Offset, node.End().Offset)
+}
+
+// range from pos to end, at least the character at pos
+func (d *document) span(pos, end token.SourcePosition) Range {
+   start, stop := min(pos.Offset, len(d.text)), min(end.Offset, len(d.text))
+   if stop <= start && start < len(d.text) && d.text[start] != '\n' {
+      _, size := utf8.DecodeRuneInString(d.text[start:])
+      stop = start + size
+   }
+   return d.rangeOf(start, max(start, stop))
+}
+
+// identifier under the cursor (also just after its last character)
+func (d *document) identAt(p Position) *ast.Identifier {
+   offset := d.offsetAt(p)
+   for _, id := range d.symbols.Idents {
+      if id.Pos().Offset <= offset && offset <= id.End().Offset {
+         return id
+      }
+   }
+   return nil
+}
+
+func (d *document) diagnostics() []Diagnostic {
+   diagnostics := []Diagnostic{}
+   for _, err := range d.errors {
+      diagnostics = append(diagnostics, Diagnostic{Range: d.span(err.Pos, err.End), Severity: SeverityError, Source: "monkey", Message: err.Message})
+   }
+   if len(d.errors) > 0 {
+      return diagnostics
+   }
+   for _, l := range lint.Program(d.program) {
+      diagnostics = append(diagnostics, Diagnostic{
+         Range: d.span(l.Pos, l.End),
+         Severity: SeverityWarning,
+         Code: l.Check,
+         Source: "monkey vet",
+         Message: l.Message,
+      })
+   }
+   return diagnostics
+}
@@ -0,0 +1,303 @@
+package lsp
+
+import (
+   "encoding/json"
+   "sort"
+   "strings"
+   "monkey/ast"
+   "monkey/evaluator"
+   "monkey/format"
+   "monkey/token"
+)
+
+// document and identifier a position request is about, id is nil if the cursor is not on one
+func (s *Server) identParams(params json.RawMessage) (*document, *ast.Identifier, error) {
+   var p TextDocumentPositionParams
+   if err := decode(params, &p); err != nil {
+      return nil, nil, err
+   }
+   d, err := s.document(p.TextDocument.URI)
+   if err != nil {
+      return nil, nil, err
+   }
+   return d, d.identAt(p.Position), nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+   d, id, err := s.identParams(params)
+   if err != nil || id == nil {
+      return nil, err
+   }
+   b, ok := d.symbols.Uses[id]
+   if !ok {
+      return nil, nil
+   }
+   return Location{URI: d.uri, Range: d.nodeRange(b.Decl)}, nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+   var p ReferenceParams
+   if err := decode(params, &p); err != nil {
+      return nil, err
+   }
+   d, err := s.document(p.TextDocument.URI)
+   if err != nil {
+      return nil, err
+   }
+   id := d.identAt(p.Position)
+   b, ok := d.symbols.Uses[id]
+   if id == nil || !ok {
+      return []Location{}, nil
+   }
+   ids := b.Refs
+   if p.Context.IncludeDeclaration {
+      ids = append([]*ast.Identifier{b.Decl}, ids...)
+   }
+   sort.SliceStable(ids, func(i, j int) bool { return ids[i].Pos().Offset < ids[j].Pos().Offset })
+   locations := []Location{}
+   for _, id := range ids {
+      locations = append(locations, Location{URI: d.uri, Range: d.nodeRange(id)})
+   }
+   return locations, nil
+}
+
+/*
+ * Hover: a Monkey code block with the signature, followed by the description of builtins
+ */
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+   d, id, err := s.identParams(params)
+   if err != nil || id == nil {
+      return nil, err
+   }
+   var code, text string
+   if b, ok := d.symbols.Uses[id]; ok {
+      code = describe(b)
+   } else if usage := evaluator.BuiltinUsage(id.Value); usage != "" {
+      code, text, _ = strings.Cut(usage, ": ")
+      code = "builtin " + code
+   } else {
+      return nil, nil
+   }
+   value := "```monkey\n" + code + "\n```"
+   if text != "" {
+      value += "\n\n" + text
+   }
+   return Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: d.nodeRange(id)}, nil
+}
+
+const maxHoverValue = 60
+
+func describe(b *evaluator.Binding) string {
+   if b.Parameter {
+      return "parameter " + b.Name
+   }
+   if fl := b.Function(); fl != nil {
+      return "let " + b.Name + " = " + signature(fl)
+   }
+   if b.Value != nil && len(b.Value.String()) <= maxHoverValue {
+      return "let " + b.Name + " = " + b.Value.String()
+   }
+   return "let " + b.Name
+}
+
+func signature(fl *ast.FunctionLiteral) string {
+   params := make([]string, len(fl.Parameters))
+   for i, param := range fl.Parameters {
+      params[i] = param.Value
+   }
+   return "fn(" + strings.Join(params, ", ") + ")"
+}
+
+/*
+ * Completion: bindings visible at the cursor (innermost first), builtins and keywords,
+ * the editor filters them by the word being typed
+ */
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+   var p TextDocumentPositionParams
+   if err := decode(params, &p); err != nil {
+      return nil, err
+   }
+   d, err := s.document(p.TextDocument.URI)
+   if err != nil {
+      return nil, err
+   }
+   items := []CompletionItem{}
+   seen := make(map[string]bool)
+   for sc := d.symbols.ScopeAt(d.offsetAt(p.Position)); sc != nil; sc = sc.Outer {
+      for _, b := range sc.Bindings {
+         if seen[b.Name] {
+            continue
+         }
+         seen[b.Name] = true
+         kind := CompletionVariable
+         if b.Function() != nil {
+            kind = CompletionFunction
+         }
+         items = append(items, CompletionItem{Label: b.Name, Kind: kind, Detail: describe(b)})
+      }
+   }
+   for _, name := range evaluator.New().BuiltinNames() {
+      if !seen[name] {
+         items = append(items, CompletionItem{Label: name, Kind: CompletionFunction, Detail: evaluator.BuiltinUsage(name)})
+      }
+   }
+   for _, keyword := range token.Keywords() {
+      items = append(items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+   }
+   return items, nil
+}
+
+/*
+ * Document symbols: let statements of the program, with those of function bodies as children
+ */
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+   var p DocumentParams
+   if err := decode(params, &p); err != nil {
+      return nil, err
+   }
+   d, err := s.document(p.TextDocument.URI)
+   if err != nil {
+      return nil, err
+   }
+   return d.symbolsOf(d.program.Statements), nil
+}
+
+func (d *document) symbolsOf(stmts []ast.Statement) []DocumentSymbol {
+   symbols := []DocumentSymbol{}
+   for _, stmt := range stmts {
+      let, ok := stmt.(*ast.LetStatement)
+      if !ok || let.Name == nil {
+         continue
+      }
+      symbol := DocumentSymbol{Name: let.Name.Value, Kind: SymbolVariable, Range: d.nodeRange(let), SelectionRange: d.nodeRange(let.Name)}
+      if fl, ok := let.Value.(*ast.FunctionLiteral); ok && fl.Body != nil {
+         symbol.Kind = SymbolFunction
+         symbol.Detail = signature(fl)
+         symbol.Children = d.symbolsOf(fl.Body.Statements)
+      }
+      symbols = append(symbols, symbol)
+   }
+   return symbols
+}
+
+// the whole document replaced by its formatted text, no edits if it does not parse
+func (s *Server) formatting(params json.RawMessage) (interface{}, error) {
+   var p DocumentParams
+   if err := decode(params, &p); err != nil {
+      return nil, err
+   }
+   d, err := s.document(p.TextDocument.URI)
+   if err != nil {
+      return nil, err
+   }
+   formatted, err := format.Source([]byte(d.text))
+   if err != nil || string(formatted) == d.text {
+      return []TextEdit{}, nil
+   }
+   return []TextEdit{{Range: d.rangeOf(0, len(d.text)), NewText: string(formatted)}}, nil
+}
+
+/*
+ * Semantic tokens: keywords, identifiers by what they are bound to, literals, operators and comments
+ *    ~ identifiers are functions (let-bound function literals and builtins), parameters or variables
+ *    ~ tokens spanning lines (strings) are split, as clients need not support multi-line tokens
+ */
+type semanticToken struct {
+   start, end int // byte offsets
+   tokenType  int
+   modifiers  int
+}
+
+func (s *Server) semanticTokens(params json.RawMessage) (interface{}, error) {
+   var p DocumentParams
+   if err := decode(params, &p); err != nil {
+      return nil, err
+   }
+   d, err := s.document(p.TextDocument.URI)
+   if err != nil {
+      return nil, err
+   }
+   return SemanticTokens{Data: d.encode(d.semanticTokens())}, nil
+}
+
+func (d *document) semanticTokens() []semanticToken {
+   idents := make(map[int]*ast.Identifier)
+   for _, id := range d.symbols.Idents {
+      idents[id.Pos().Offset] = id
+   }
+
+   result := []semanticToken{}
+   for _, tok := range append(append([]token.Token{}, d.tokens...), d.comments...) {
+      start, end := tok.Position.Offset, tok.End.Offset
+      st := semanticToken{start: start, end: end, tokenType: -1}
+      switch tok.Type {
+         case token.IDENT:
+            st.tokenType, st.modifiers = d.classify(idents[start], tok.Literal)
+         case token.INT:
+            st.tokenType = tokenNumber
+         case token.STRING:
+            st.tokenType = tokenString
+         case token.REGEX:
+            st.tokenType = tokenRegexp
+         case token.COMMENT:
+            st.tokenType = tokenComment
+         case token.ASSIGN, token.PLUS, token.MINUS, token.BANG, token.ASTERISK, token.SLASH,
+            token.LT, token.GT, token.EQ, token.NOT_EQ, token.AND, token.OR:
+            st.tokenType = tokenOperator
+         default:
+            if token.LookupIdent(tok.Literal) == tok.Type { // keywords
+               st.tokenType = tokenKeyword
+            }
+      }
+      if st.tokenType >= 0 && end > start {
+         result = append(result, st)
+      }
+   }
+   sort.Slice(result, func(i, j int) bool { return result[i].start < result[j].start })
+   return result
+}
+
+func (d *document) classify(id *ast.Identifier, name string) (int, int) {
+   b, ok := d.symbols.Uses[id]
+   if id == nil || !ok {
+      if evaluator.BuiltinUsage(name) != "" {
+         return tokenFunction, modifierDefaultLibrary
+      }
+      return tokenVariable, 0
+   }
+   tokenType, modifiers := tokenVariable, 0
+   if b.Parameter {
+      tokenType = tokenParameter
+   } else if b.Function() != nil {
+      tokenType = tokenFunction
+   }
+   if b.Decl == id {
+      modifiers = modifierDeclaration
+   }
+   return tokenType, modifiers
+}
+
+// relative encoding: line delta, start delta (on the same line), length, type, modifiers
+func (d *document) encode(tokens []semanticToken) []int {
+   data := []int{}
+   prev := Position{}
+   for _, st := range tokens {
+      for start := st.start; start < st.end; {
+         end := st.end
+         if nl := strings.IndexByte(d.text[start:end], '\n'); nl >= 0 {
+            end = start + nl
+         }
+         if end > start {
+            pos := d.position(start)
+            delta := pos.Character
+            if pos.Line == prev.Line {
+               delta -= prev.Character
+            }
+            data = append(data, pos.Line - prev.Line, delta, utf16Len(d.text[start:end]), st.tokenType, st.modifiers)
+            prev = pos
+         }
+         start = end + 1
+      }
+   }
+   return data
+}
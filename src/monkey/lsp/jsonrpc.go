@@ -0,0 +1,17 @@
+package lsp
+
+import (
+   "encoding/json"
+   "io"
+   "monkey/framing"
+)
+
+// a JSON-RPC message in the base protocol (see framing.Read)
+func writeMessage(w io.Writer, msg *message) error {
+   msg.JSONRPC = "2.0"
+   content, err := json.Marshal(msg)
+   if err != nil {
+      return err
+   }
+   return framing.Write(w, content)
+}
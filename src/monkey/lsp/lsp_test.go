@@ -0,0 +1,359 @@
+package lsp
+
+import (
+   "bufio"
+   "bytes"
+   "encoding/json"
+   "fmt"
+   "io"
+   "monkey/framing"
+   "reflect"
+   "strings"
+   "testing"
+)
+
+const uri = "file:///test.mo"
+
+func request(id int, method, params string) string {
+   return fmt.Sprintf(`{"jsonrpc": "2.0", "id": %d, "method": %q, "params": %s}`, id, method, params)
+}
+
+func notification(method, params string) string {
+   return fmt.Sprintf(`{"jsonrpc": "2.0", "method": %q, "params": %s}`, method, params)
+}
+
+func open(text string) string {
+   return notification("textDocument/didOpen", fmt.Sprintf(`{"textDocument": {"uri": %q, "languageId": "monkey", "version": 1, "text": %q}}`, uri, text))
+}
+
+func at(line, character int) string {
+   return fmt.Sprintf(`{"textDocument": {"uri": %q}, "position": {"line": %d, "character": %d}}`, uri, line, character)
+}
+
+var documentParams = fmt.Sprintf(`{"textDocument": {"uri": %q}}`, uri)
+
+// runs a session: initialize, the given messages, shutdown and exit; returns what the server wrote
+func session(t *testing.T, messages ...string) []message {
+   t.Helper()
+   script := append([]string{request(0, "initialize", `{"capabilities": {}}`), notification("initialized", `{}`)}, messages...)
+   script = append(script, request(9999, "shutdown", "null"), notification("exit", "null"))
+   var in bytes.Buffer
+   for _, msg := range script {
+      fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+   }
+   var out bytes.Buffer
+   if err := Serve(&in, &out); err != nil {
+      t.Fatalf("Serve failed: %s", err)
+   }
+   return readAll(t, &out)
+}
+
+func readAll(t *testing.T, out io.Reader) []message {
+   t.Helper()
+   r := bufio.NewReader(out)
+   result := []message{}
+   for {
+      content, err := framing.Read(r)
+      if err == io.EOF {
+         return result
+      }
+      if err != nil {
+         t.Fatalf("bad output: %s", err)
+      }
+      var msg message
+      if err := json.Unmarshal(content, &msg); err != nil {
+         t.Fatalf("bad output %q: %s", content, err)
+      }
+      result = append(result, msg)
+   }
+}
+
+// decodes the result of the response to request id into v
+func response(t *testing.T, messages []message, id int, v interface{}) {
+   t.Helper()
+   for _, msg := range messages {
+      if msg.ID != nil && string(*msg.ID) == fmt.Sprint(id) {
+         if msg.Error != nil {
+            t.Fatalf("request %d failed: %s", id, msg.Error.Message)
+         }
+         if err := json.Unmarshal(msg.Result, v); err != nil {
+            t.Fatalf("request %d: bad result %s: %s", id, msg.Result, err)
+         }
+         return
+      }
+   }
+   t.Fatalf("no response to request %d", id)
+}
+
+func published(t *testing.T, messages []message) [][]Diagnostic {
+   t.Helper()
+   result := [][]Diagnostic{}
+   for _, msg := range messages {
+      if msg.Method == "textDocument/publishDiagnostics" {
+         var p PublishDiagnosticsParams
+         json.Unmarshal(msg.Params, &p)
+         result = append(result, p.Diagnostics)
+      }
+   }
+   return result
+}
+
+func span(startLine, startChar, endLine, endChar int) Range {
+   return Range{Start: Position{startLine, startChar}, End: Position{endLine, endChar}}
+}
+
+func TestInitialize(t *testing.T) {
+   messages := session(t)
+   var result struct {
+      Capabilities map[string]interface{} `json:"capabilities"`
+   }
+   response(t, messages, 0, &result)
+   for _, capability := range []string{"hoverProvider", "definitionProvider", "referencesProvider", "completionProvider",
+      "documentSymbolProvider", "documentFormattingProvider", "semanticTokensProvider"} {
+      if _, ok := result.Capabilities[capability]; !ok {
+         t.Errorf("capability %s not announced", capability)
+      }
+   }
+   var shutdown interface{}
+   response(t, messages, 9999, &shutdown)
+   if shutdown != nil {
+      t.Errorf("shutdown result not null. got=%v", shutdown)
+   }
+}
+
+func TestProtocolErrors(t *testing.T) {
+   var in bytes.Buffer
+   for _, msg := range []string{request(1, "textDocument/hover", at(0, 0)), request(2, "initialize", "{}"), request(3, "no/such/method", "{}"), "{"} {
+      fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+   }
+   var out bytes.Buffer
+   if err := Serve(&in, &out); err == nil {
+      t.Errorf("no error when the input ends without exit")
+   }
+   codes := []int{}
+   for _, msg := range readAll(t, &out) {
+      if msg.Error != nil {
+         codes = append(codes, msg.Error.Code)
+      }
+   }
+   expected := []int{codeServerNotInitialized, codeMethodNotFound, codeParseError}
+   if !reflect.DeepEqual(codes, expected) {
+      t.Errorf("wrong error codes. got=%v, want=%v", codes, expected)
+   }
+
+   if err := Serve(strings.NewReader("Content-Length: 1000000000\r\n\r\n{}"), io.Discard); err == nil {
+      t.Errorf("no error for content exceeding the maximum length")
+   }
+   if err := Serve(strings.NewReader("Content-Length: 40\r\n\r\n{}"), io.Discard); err == nil {
+      t.Errorf("no error for truncated content")
+   }
+}
+
+func TestDiagnostics(t *testing.T) {
+   messages := session(t,
+      open("let x = 1;\nlet y = ;\n"),
+      notification("textDocument/didChange", fmt.Sprintf(`{"textDocument": {"uri": %q, "version": 2}, "contentChanges": [{"text": "let f = fn(a) { puts(b) };"}]}`, uri)),
+      notification("textDocument/didClose", documentParams),
+   )
+   diagnostics := published(t, messages)
+   if len(diagnostics) != 3 {
+      t.Fatalf("wrong number of publications. got=%d", len(diagnostics))
+   }
+
+   if len(diagnostics[0]) != 1 {
+      t.Fatalf("wrong parse diagnostics. got=%+v", diagnostics[0])
+   }
+   parseError := diagnostics[0][0]
+   if parseError.Severity != SeverityError || parseError.Range != span(1, 8, 1, 9) || strings.Contains(parseError.Message, "position{") {
+      t.Errorf("wrong parse diagnostic. got=%+v", parseError)
+   }
+
+   expected := []Diagnostic{
+      {Range: span(0, 11, 0, 12), Severity: SeverityWarning, Code: "unused", Source: "monkey vet", Message: "unused parameter a"},
+      {Range: span(0, 21, 0, 22), Severity: SeverityWarning, Code: "undefined", Source: "monkey vet", Message: "identifier not found: b"},
+   }
+   if !reflect.DeepEqual(diagnostics[1], expected) {
+      t.Errorf("wrong lint diagnostics. got=%+v, want=%+v", diagnostics[1], expected)
+   }
+   if len(diagnostics[2]) != 0 {
+      t.Errorf("diagnostics not cleared on close. got=%+v", diagnostics[2])
+   }
+}
+
+const program = `let add = fn(a, b) { a + b };
+let twice = fn(f, x) {
+   let once = f(x);
+   f(once)
+};
+twice(fn(n) { add(n, 1) }, 1);`
+
+func TestDefinitionAndReferences(t *testing.T) {
+   messages := session(t,
+      open(program),
+      request(1, "textDocument/definition", at(5, 15)),  // add in the call
+      request(2, "textDocument/definition", at(3, 6)),   // once
+      request(3, "textDocument/definition", at(0, 23)),  // +
+      request(4, "textDocument/references", fmt.Sprintf(`{"textDocument": {"uri": %q}, "position": {"line": 1, "character": 15}, "context": {"includeDeclaration": true}}`, uri)),
+      request(5, "textDocument/references", fmt.Sprintf(`{"textDocument": {"uri": %q}, "position": {"line": 0, "character": 5}, "context": {"includeDeclaration": false}}`, uri)),
+   )
+   var location Location
+   response(t, messages, 1, &location)
+   if location.Range != span(0, 4, 0, 7) || location.URI != uri {
+      t.Errorf("wrong definition of add. got=%+v", location)
+   }
+   response(t, messages, 2, &location)
+   if location.Range != span(2, 7, 2, 11) {
+      t.Errorf("wrong definition of once. got=%+v", location)
+   }
+   var none *Location
+   response(t, messages, 3, &none)
+   if none != nil {
+      t.Errorf("definition outside identifiers. got=%+v", none)
+   }
+
+   var refs []Location
+   response(t, messages, 4, &refs)
+   ranges := []Range{}
+   for _, ref := range refs {
+      ranges = append(ranges, ref.Range)
+   }
+   expected := []Range{span(1, 15, 1, 16), span(2, 14, 2, 15), span(3, 3, 3, 4)}
+   if !reflect.DeepEqual(ranges, expected) {
+      t.Errorf("wrong references of f. got=%v, want=%v", ranges, expected)
+   }
+   response(t, messages, 5, &refs)
+   if len(refs) != 1 || refs[0].Range != span(5, 14, 5, 17) {
+      t.Errorf("wrong references of add. got=%+v", refs)
+   }
+}
+
+func TestHover(t *testing.T) {
+   messages := session(t,
+      open(program + "\nlen(\"abc\");"),
+      request(1, "textDocument/hover", at(5, 15)), // add
+      request(2, "textDocument/hover", at(0, 13)), // parameter a
+      request(3, "textDocument/hover", at(6, 1)),  // len
+      request(4, "textDocument/hover", at(6, 5)),  // string
+   )
+   tests := []struct {
+      id       int
+      expected string
+   }{
+      {1, "```monkey\nlet add = fn(a, b)\n```"},
+      {2, "```monkey\nparameter a\n```"},
+      {3, "```monkey\nbuiltin len(x)\n```\n\nnumber of characters of a string, elements of an array or pairs of a hash"},
+   }
+   for _, tt := range tests {
+      var hover Hover
+      response(t, messages, tt.id, &hover)
+      if hover.Contents.Value != tt.expected || hover.Contents.Kind != "markdown" {
+         t.Errorf("wrong hover %d. got=%q, want=%q", tt.id, hover.Contents.Value, tt.expected)
+      }
+   }
+   var none *Hover
+   response(t, messages, 4, &none)
+   if none != nil {
+      t.Errorf("hover outside identifiers. got=%+v", none)
+   }
+}
+
+func TestCompletion(t *testing.T) {
+   messages := session(t,
+      open(program),
+      request(1, "textDocument/completion", at(3, 3)), // in twice
+      request(2, "textDocument/completion", at(5, 0)), // top level
+   )
+   labels := func(id int) map[string]int {
+      var items []CompletionItem
+      response(t, messages, id, &items)
+      result := make(map[string]int)
+      for _, item := range items {
+         result[item.Label] = item.Kind
+      }
+      return result
+   }
+
+   inside := labels(1)
+   for label, kind := range map[string]int{"once": CompletionVariable, "f": CompletionVariable, "x": CompletionVariable,
+      "add": CompletionFunction, "twice": CompletionFunction, "push": CompletionFunction, "let": CompletionKeyword} {
+      if inside[label] != kind {
+         t.Errorf("wrong completion %s inside twice. got=%d, want=%d", label, inside[label], kind)
+      }
+   }
+   outside := labels(2)
+   if _, ok := outside["once"]; ok {
+      t.Errorf("local binding completed outside its function")
+   }
+   if outside["add"] != CompletionFunction {
+      t.Errorf("global binding not completed")
+   }
+}
+
+func TestDocumentSymbols(t *testing.T) {
+   messages := session(t, open(program), request(1, "textDocument/documentSymbol", documentParams))
+   var symbols []DocumentSymbol
+   response(t, messages, 1, &symbols)
+   expected := []DocumentSymbol{
+      {Name: "add", Detail: "fn(a, b)", Kind: SymbolFunction, Range: span(0, 0, 0, 28), SelectionRange: span(0, 4, 0, 7)},
+      {Name: "twice", Detail: "fn(f, x)", Kind: SymbolFunction, Range: span(1, 0, 4, 1), SelectionRange: span(1, 4, 1, 9),
+         Children: []DocumentSymbol{
+            {Name: "once", Kind: SymbolVariable, Range: span(2, 3, 2, 18), SelectionRange: span(2, 7, 2, 11)},
+         },
+      },
+   }
+   if !reflect.DeepEqual(symbols, expected) {
+      t.Errorf("wrong symbols.\ngot= %+v\nwant=%+v", symbols, expected)
+   }
+}
+
+func TestFormatting(t *testing.T) {
+   messages := session(t,
+      open("let x=1\nputs( x )"),
+      request(1, "textDocument/formatting", documentParams),
+      open("let x = 1;\n"),
+      request(2, "textDocument/formatting", documentParams),
+      open("let x = ;"),
+      request(3, "textDocument/formatting", documentParams),
+   )
+   var edits []TextEdit
+   response(t, messages, 1, &edits)
+   expected := []TextEdit{{Range: span(0, 0, 1, 9), NewText: "let x = 1;\nputs(x)\n"}}
+   if !reflect.DeepEqual(edits, expected) {
+      t.Errorf("wrong edits. got=%+v, want=%+v", edits, expected)
+   }
+   for _, id := range []int{2, 3} { // formatted, does not parse
+      response(t, messages, id, &edits)
+      if len(edits) != 0 {
+         t.Errorf("request %d: unexpected edits %+v", id, edits)
+      }
+   }
+}
+
+func TestSemanticTokens(t *testing.T) {
+   text := "let s = \"a\nb\"; // note\nlet f = fn(x) { len(x) + 1 };\nf(/é+/)"
+   messages := session(t, open(text), request(1, "textDocument/semanticTokens/full", documentParams))
+   var tokens SemanticTokens
+   response(t, messages, 1, &tokens)
+   expected := []int{
+      0, 0, 3, tokenKeyword, 0,                     // let
+      0, 4, 1, tokenVariable, modifierDeclaration,  // s
+      0, 2, 1, tokenOperator, 0,                    // =
+      0, 2, 2, tokenString, 0,                      // "a
+      1, 0, 2, tokenString, 0,                      // b"
+      0, 4, 7, tokenComment, 0,                     // // note
+      1, 0, 3, tokenKeyword, 0,                     // let
+      0, 4, 1, tokenFunction, modifierDeclaration,  // f
+      0, 2, 1, tokenOperator, 0,                    // =
+      0, 2, 2, tokenKeyword, 0,                     // fn
+      0, 3, 1, tokenParameter, modifierDeclaration, // x
+      0, 5, 3, tokenFunction, modifierDefaultLibrary, // len
+      0, 4, 1, tokenParameter, 0,                   // x
+      0, 3, 1, tokenOperator, 0,                    // +
+      0, 2, 1, tokenNumber, 0,                      // 1
+      1, 0, 1, tokenFunction, 0,                    // f
+      0, 2, 4, tokenRegexp, 0,                      // /é+/ (é is one UTF-16 unit)
+   }
+   if !reflect.DeepEqual(tokens.Data, expected) {
+      t.Errorf("wrong semantic tokens.\ngot= %v\nwant=%v", tokens.Data, expected)
+   }
+}
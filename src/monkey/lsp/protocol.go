@@ -0,0 +1,200 @@
+package lsp
+
+import (
+   "encoding/json"
+)
+
+/*
+ * Protocol: the parts of the Language Server Protocol used by the server
+ *    ~ https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/
+ *    ~ positions are 0-based lines and UTF-16 code units within the line
+ */
+type Position struct {
+   Line      int `json:"line"`
+   Character int `json:"character"`
+}
+
+type Range struct {
+   Start Position `json:"start"`
+   End   Position `json:"end"`
+}
+
+type Location struct {
+   URI   string `json:"uri"`
+   Range Range  `json:"range"`
+}
+
+type TextDocumentItem struct {
+   URI     string `json:"uri"`
+   Version int    `json:"version"`
+   Text    string `json:"text"`
+}
+
+type TextDocumentIdentifier struct {
+   URI string `json:"uri"`
+}
+
+type TextDocumentPositionParams struct {
+   TextDocument TextDocumentIdentifier `json:"textDocument"`
+   Position     Position               `json:"position"`
+}
+
+type DidOpenTextDocumentParams struct {
+   TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+// full document sync: the last change holds the whole text
+type DidChangeTextDocumentParams struct {
+   TextDocument   TextDocumentIdentifier `json:"textDocument"`
+   ContentChanges []struct {
+      Text string `json:"text"`
+   } `json:"contentChanges"`
+}
+
+type DidCloseTextDocumentParams struct {
+   TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type ReferenceParams struct {
+   TextDocumentPositionParams
+   Context struct {
+      IncludeDeclaration bool `json:"includeDeclaration"`
+   } `json:"context"`
+}
+
+type DocumentParams struct { // semantic tokens, document symbols, formatting
+   TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+const (
+   SeverityError   = 1
+   SeverityWarning = 2
+)
+
+type Diagnostic struct {
+   Range    Range  `json:"range"`
+   Severity int    `json:"severity"`
+   Code     string `json:"code,omitempty"`
+   Source   string `json:"source"`
+   Message  string `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+   URI         string       `json:"uri"`
+   Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type MarkupContent struct {
+   Kind  string `json:"kind"` // "markdown"
+   Value string `json:"value"`
+}
+
+type Hover struct {
+   Contents MarkupContent `json:"contents"`
+   Range    Range         `json:"range"`
+}
+
+const (
+   CompletionFunction = 3
+   CompletionVariable = 6
+   CompletionKeyword  = 14
+)
+
+type CompletionItem struct {
+   Label  string `json:"label"`
+   Kind   int    `json:"kind"`
+   Detail string `json:"detail,omitempty"`
+}
+
+const (
+   SymbolFunction = 12
+   SymbolVariable = 13
+)
+
+type DocumentSymbol struct {
+   Name           string           `json:"name"`
+   Detail         string           `json:"detail,omitempty"`
+   Kind           int              `json:"kind"`
+   Range          Range            `json:"range"`
+   SelectionRange Range            `json:"selectionRange"`
+   Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+type TextEdit struct {
+   Range   Range  `json:"range"`
+   NewText string `json:"newText"`
+}
+
+type SemanticTokens struct {
+   Data []int `json:"data"`
+}
+
+// token types and modifiers announced in the legend, indices are used in SemanticTokens.Data
+var semanticTokenTypes = []string{"keyword", "variable", "parameter", "function", "string", "number", "regexp", "operator", "comment"}
+
+var semanticTokenModifiers = []string{"declaration", "defaultLibrary"}
+
+const (
+   tokenKeyword = iota
+   tokenVariable
+   tokenParameter
+   tokenFunction
+   tokenString
+   tokenNumber
+   tokenRegexp
+   tokenOperator
+   tokenComment
+)
+
+const (
+   modifierDeclaration = 1 << iota
+   modifierDefaultLibrary
+)
+
+func serverCapabilities() map[string]interface{} {
+   return map[string]interface{}{
+      "textDocumentSync": 1, // full
+      "hoverProvider": true,
+      "definitionProvider": true,
+      "referencesProvider": true,
+      "documentSymbolProvider": true,
+      "documentFormattingProvider": true,
+      "completionProvider": map[string]interface{}{},
+      "semanticTokensProvider": map[string]interface{}{
+         "legend": map[string]interface{}{
+            "tokenTypes": semanticTokenTypes,
+            "tokenModifiers": semanticTokenModifiers,
+         },
+         "full": true,
+      },
+   }
+}
+
+/*
+ * JSON-RPC 2.0 messages: requests have an id, notifications do not, responses carry a result or an error
+ */
+type message struct {
+   JSONRPC string           `json:"jsonrpc"`
+   ID      *json.RawMessage `json:"id,omitempty"`
+   Method  string           `json:"method,omitempty"`
+   Params  json.RawMessage  `json:"params,omitempty"`
+   Result  json.RawMessage  `json:"result,omitempty"` // "null" for an empty result
+   Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+   Code    int    `json:"code"`
+   Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+   return e.Message
+}
+
+const (
+   codeParseError           = -32700
+   codeInvalidRequest       = -32600
+   codeMethodNotFound       = -32601
+   codeInvalidParams        = -32602
+   codeServerNotInitialized = -32002
+)
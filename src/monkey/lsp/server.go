@@ -0,0 +1,197 @@
+package lsp
+
+import (
+   "bufio"
+   "encoding/json"
+   "fmt"
+   "io"
+   "monkey/framing"
+)
+
+/*
+ * Server: a language server for Monkey over a pair of streams (stdin/stdout for editors)
+ *    ~ requests are handled one at a time, in order
+ *    ~ documents are synchronised in full, diagnostics are published after every change
+ *    ~ Serve returns at "exit", or when the input ends; the error is nil only after a "shutdown" request
+ */
+type Server struct {
+   out         io.Writer
+   documents   map[string]*document
+   initialized bool
+   shutdown    bool
+}
+
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers map[string]handler // set in init, handlers refer to the server's methods
+
+func init() {
+   handlers = map[string]handler{
+      "initialize": (*Server).initialize,
+      "initialized": ignore,
+      "shutdown": func(s *Server, params json.RawMessage) (interface{}, error) {
+         s.shutdown = true
+         return nil, nil
+      },
+      "textDocument/didOpen": (*Server).didOpen,
+      "textDocument/didChange": (*Server).didChange,
+      "textDocument/didClose": (*Server).didClose,
+      "textDocument/didSave": ignore,
+      "textDocument/semanticTokens/full": (*Server).semanticTokens,
+      "textDocument/definition": (*Server).definition,
+      "textDocument/references": (*Server).references,
+      "textDocument/hover": (*Server).hover,
+      "textDocument/completion": (*Server).completion,
+      "textDocument/documentSymbol": (*Server).documentSymbol,
+      "textDocument/formatting": (*Server).formatting,
+      "$/cancelRequest": ignore,
+      "$/setTrace": ignore,
+   }
+}
+
+func ignore(s *Server, params json.RawMessage) (interface{}, error) {
+   return nil, nil
+}
+
+func Serve(in io.Reader, out io.Writer) error {
+   s := &Server{out: out, documents: make(map[string]*document)}
+   r := bufio.NewReader(in)
+   for {
+      content, err := framing.Read(r)
+      if err == io.EOF {
+         return fmt.Errorf("input ended without exit")
+      }
+      if err != nil {
+         return err
+      }
+      var msg message
+      if err := json.Unmarshal(content, &msg); err != nil {
+         null := json.RawMessage("null")
+         s.reply(&null, nil, &responseError{Code: codeParseError, Message: err.Error()})
+         continue
+      }
+      if msg.Method == "exit" {
+         if !s.shutdown {
+            return fmt.Errorf("exit without shutdown")
+         }
+         return nil
+      }
+      s.handle(&msg)
+   }
+}
+
+func (s *Server) handle(msg *message) {
+   result, err := s.dispatch(msg)
+   if msg.ID == nil { // notification
+      return
+   }
+   if err != nil {
+      rerr, ok := err.(*responseError)
+      if !ok {
+         rerr = &responseError{Code: codeInvalidRequest, Message: err.Error()}
+      }
+      s.reply(msg.ID, nil, rerr)
+      return
+   }
+   s.reply(msg.ID, result, nil)
+}
+
+func (s *Server) dispatch(msg *message) (result interface{}, err error) {
+   h, ok := handlers[msg.Method]
+   switch {
+      case !ok:
+         return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+      case !s.initialized && msg.Method != "initialize":
+         return nil, &responseError{Code: codeServerNotInitialized, Message: "server not initialized"}
+      case s.shutdown && msg.Method != "shutdown":
+         return nil, &responseError{Code: codeInvalidRequest, Message: "server is shutting down"}
+   }
+   defer func() { // a bug in a feature should not take the editor's server down
+      if r := recover(); r != nil {
+         result, err = nil, fmt.Errorf("%s: internal error: %v", msg.Method, r)
+      }
+   }()
+   return h(s, msg.Params)
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) {
+   msg := &message{ID: id, Error: rerr}
+   if rerr == nil {
+      data, err := json.Marshal(result)
+      if err != nil {
+         msg.Error = &responseError{Code: codeInvalidRequest, Message: err.Error()}
+      } else {
+         msg.Result = data
+      }
+   }
+   writeMessage(s.out, msg)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+   data, err := json.Marshal(params)
+   if err != nil {
+      return
+   }
+   writeMessage(s.out, &message{Method: method, Params: data})
+}
+
+func decode(params json.RawMessage, v interface{}) error {
+   if err := json.Unmarshal(params, v); err != nil {
+      return &responseError{Code: codeInvalidParams, Message: err.Error()}
+   }
+   return nil
+}
+
+func (s *Server) document(uri string) (*document, error) {
+   d, ok := s.documents[uri]
+   if !ok {
+      return nil, &responseError{Code: codeInvalidParams, Message: "unknown document: " + uri}
+   }
+   return d, nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+   s.initialized = true
+   return map[string]interface{}{
+      "capabilities": serverCapabilities(),
+      "serverInfo": map[string]string{"name": "monkey"},
+   }, nil
+}
+
+// Document synchronisation
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+   var p DidOpenTextDocumentParams
+   if err := decode(params, &p); err != nil {
+      return nil, err
+   }
+   s.open(p.TextDocument.URI, p.TextDocument.Text)
+   return nil, nil
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+   var p DidChangeTextDocumentParams
+   if err := decode(params, &p); err != nil {
+      return nil, err
+   }
+   if len(p.ContentChanges) > 0 {
+      s.open(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges) - 1].Text)
+   }
+   return nil, nil
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+   var p DidCloseTextDocumentParams
+   if err := decode(params, &p); err != nil {
+      return nil, err
+   }
+   delete(s.documents, p.TextDocument.URI)
+   s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+   return nil, nil
+}
+
+func (s *Server) open(uri, text string) {
+   d := newDocument(uri, text)
+   s.documents[uri] = d
+   s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: d.diagnostics()})
+}
@@ -2,16 +2,64 @@ package main
 
 import (
    "fmt"
+   "io"
    "os"
    "os/user"
+   "path/filepath"
+   "sort"
    "monkey/repl"
 )
 
+/*
+ * monkey: REPL without arguments, otherwise "monkey <command> [arguments]"
+ *    ~ commands read the program's streams through their parameters, so they can be tested
+ *    ~ a command returns the exit status: 0 on success, 1 if it reports problems, 2 on usage or I/O errors
+ */
+type command struct {
+   usage string
+   run   func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]*command{
+   "ast": &command{usage: "ast [-format=f] [files...]  print the syntax tree (f: tree, sexpr or dot)", run: runAST},
+   "dap": &command{usage: "dap                         debug adapter on standard input/output", run: runDAP},
+   "debug": &command{usage: "debug <file>                step through a program", run: runDebug},
+   "fmt": &command{usage: "fmt [-w] [-d] [files...]    format Monkey source", run: runFmt},
+   "vet": &command{usage: "vet [files...]              report likely mistakes", run: runVet},
+   "lint": &command{usage: "lint [files...]             same as vet", run: runVet},
+   "lsp": &command{usage: "lsp                         language server on standard input/output", run: runLSP},
+   "run": &command{usage: "run [-profile f] <file>     run a program, writing a pprof profile to f", run: runRun},
+   "parse": &command{usage: "parse [-json] [-trace] [files...]  print the parsed program or its syntax tree", run: runParse},
+}
+
 func main() {
+   if len(os.Args) > 1 {
+      cmd, ok := commands[os.Args[1]]
+      if !ok {
+         usage(os.Stderr)
+         os.Exit(2)
+      }
+      os.Exit(cmd.run(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+   }
+
    user, err := user.Current()
    if err != nil {
       panic(err)
    }
    fmt.Printf("Hello %s! This is REPL for Monkey programming language.\n", user.Username)
-   repl.Start(os.Stdin, os.Stdout) 
+   fmt.Printf("Type :help for a list of commands.\n")
+   repl.Start(os.Stdin, os.Stdout, repl.WithHistoryFile(filepath.Join(user.HomeDir, ".monkey_history")))
+}
+
+func usage(w io.Writer) {
+   names := make([]string, 0, len(commands))
+   for name := range commands {
+      names = append(names, name)
+   }
+   sort.Strings(names)
+   fmt.Fprintf(w, "usage: monkey [command]\n\ncommands:\n")
+   for _, name := range names {
+      fmt.Fprintf(w, "   %s\n", commands[name].usage)
+   }
+   fmt.Fprintf(w, "\nwithout a command, monkey starts the REPL\n")
 }
@@ -0,0 +1,193 @@
+package object
+
+import (
+   "hash/fnv"
+   "math/bits"
+)
+
+/*
+ * Persistent hash map: hash array mapped trie (HAMT) keyed by HashKey
+ *    ~ each level consumes 5 bits of the 64-bit hash, nodes store only occupied slots
+ *    ~ keys with equal hashes are chained in their leaf
+ *    ~ insert and delete copy at most one path from the root, O(log32 n)
+ */
+const (
+   hamtBits = 5
+   hamtMask = 1 << hamtBits - 1
+)
+
+type hamt struct {
+   root  *hamtNode
+   count int
+}
+
+type hamtNode struct {
+   bitmap uint32
+   slots  []hamtSlot
+}
+
+// either a leaf (key/value chain) or a sub-trie
+type hamtSlot struct {
+   leaf *hamtLeaf
+   node *hamtNode
+}
+
+type hamtLeaf struct {
+   hash  uint64
+   key   HashKey
+   pair  HashPair
+   index int // position in insertion order
+   next  *hamtLeaf
+}
+
+func hashOf(key HashKey) uint64 {
+   h := fnv.New64a()
+   h.Write([]byte(key.Type))
+   return key.Value ^ h.Sum64()
+}
+
+func (m hamt) get(key HashKey) (*hamtLeaf, bool) {
+   hash := hashOf(key)
+   node := m.root
+   for shift := uint(0); node != nil; shift += hamtBits {
+      bit := uint32(1) << ((hash >> shift) & hamtMask)
+      if node.bitmap & bit == 0 {
+         return nil, false
+      }
+      slot := node.slots[bits.OnesCount32(node.bitmap & (bit - 1))]
+      if slot.node != nil {
+         node = slot.node
+         continue
+      }
+      for leaf := slot.leaf; leaf != nil; leaf = leaf.next {
+         if leaf.key == key {
+            return leaf, true
+         }
+      }
+      return nil, false
+   }
+   return nil, false
+}
+
+func (m hamt) set(key HashKey, pair HashPair, index int) hamt {
+   leaf := &hamtLeaf{hash: hashOf(key), key: key, pair: pair, index: index}
+   root, added := assocNode(m.root, 0, leaf)
+   m.root = root
+   if added {
+      m.count += 1
+   }
+   return m
+}
+
+func (m hamt) delete(key HashKey) hamt {
+   root, removed := dissocNode(m.root, 0, hashOf(key), key)
+   m.root = root
+   if removed {
+      m.count -= 1
+   }
+   return m
+}
+
+func assocNode(node *hamtNode, shift uint, leaf *hamtLeaf) (*hamtNode, bool) {
+   bit := uint32(1) << ((leaf.hash >> shift) & hamtMask)
+   if node == nil {
+      return &hamtNode{bitmap: bit, slots: []hamtSlot{{leaf: leaf}}}, true
+   }
+
+   idx := bits.OnesCount32(node.bitmap & (bit - 1))
+   if node.bitmap & bit == 0 { // free slot
+      slots := make([]hamtSlot, len(node.slots) + 1)
+      copy(slots, node.slots[:idx])
+      slots[idx] = hamtSlot{leaf: leaf}
+      copy(slots[idx + 1:], node.slots[idx:])
+      return &hamtNode{bitmap: node.bitmap | bit, slots: slots}, true
+   }
+
+   slot := node.slots[idx]
+   var replacement hamtSlot
+   added := true
+   switch {
+      case slot.node != nil:
+         replacement.node, added = assocNode(slot.node, shift + hamtBits, leaf)
+      case slot.leaf.hash == leaf.hash:
+         replacement.leaf, added = assocLeaf(slot.leaf, leaf)
+      default: // split leaf into a sub-trie
+         sub, _ := assocNode(nil, shift + hamtBits, slot.leaf)
+         replacement.node, _ = assocNode(sub, shift + hamtBits, leaf)
+   }
+
+   slots := make([]hamtSlot, len(node.slots))
+   copy(slots, node.slots)
+   slots[idx] = replacement
+   return &hamtNode{bitmap: node.bitmap, slots: slots}, added
+}
+
+// replace or append leaf within a chain of equal hashes
+func assocLeaf(chain *hamtLeaf, leaf *hamtLeaf) (*hamtLeaf, bool) {
+   if chain == nil {
+      return leaf, true
+   }
+   if chain.key == leaf.key {
+      replaced := *leaf
+      replaced.next = chain.next
+      return &replaced, false
+   }
+   next, added := assocLeaf(chain.next, leaf)
+   copied := *chain
+   copied.next = next
+   return &copied, added
+}
+
+func dissocNode(node *hamtNode, shift uint, hash uint64, key HashKey) (*hamtNode, bool) {
+   if node == nil {
+      return nil, false
+   }
+   bit := uint32(1) << ((hash >> shift) & hamtMask)
+   if node.bitmap & bit == 0 {
+      return node, false
+   }
+
+   idx := bits.OnesCount32(node.bitmap & (bit - 1))
+   slot := node.slots[idx]
+   var replacement hamtSlot
+   var removed bool
+   if slot.node != nil {
+      replacement.node, removed = dissocNode(slot.node, shift + hamtBits, hash, key)
+   } else {
+      replacement.leaf, removed = dissocLeaf(slot.leaf, key)
+   }
+   if !removed {
+      return node, false
+   }
+
+   if replacement.node == nil && replacement.leaf == nil { // slot became empty
+      if len(node.slots) == 1 {
+         return nil, true
+      }
+      slots := make([]hamtSlot, len(node.slots) - 1)
+      copy(slots, node.slots[:idx])
+      copy(slots[idx:], node.slots[idx + 1:])
+      return &hamtNode{bitmap: node.bitmap &^ bit, slots: slots}, true
+   }
+
+   slots := make([]hamtSlot, len(node.slots))
+   copy(slots, node.slots)
+   slots[idx] = replacement
+   return &hamtNode{bitmap: node.bitmap, slots: slots}, true
+}
+
+func dissocLeaf(chain *hamtLeaf, key HashKey) (*hamtLeaf, bool) {
+   if chain == nil {
+      return nil, false
+   }
+   if chain.key == key {
+      return chain.next, true
+   }
+   next, removed := dissocLeaf(chain.next, key)
+   if !removed {
+      return chain, false
+   }
+   copied := *chain
+   copied.next = next
+   return &copied, true
+}
@@ -10,6 +10,7 @@ import (
    "strings"
    "bytes"
    "hash/fnv"
+   "regexp"
    "monkey/ast"
 )
 
@@ -26,6 +27,7 @@ const (
    BUILTIN_OBJ       = "BUILTIN"
    ARRAY_OBJ         = "ARRAY"
    HASH_OBJ          = "HASH"
+   REGEX_OBJ         = "REGEX"
 )
 
 // Object system
@@ -60,6 +62,14 @@ type Null struct {}
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 func (n *Null) Inspect() string { return "null" }
 
+// compiled RE2 pattern, safe to share between goroutines
+type Regex struct {
+   Value *regexp.Regexp
+}
+
+func (r *Regex) Type() ObjectType { return REGEX_OBJ }
+func (r *Regex) Inspect() string { return "/" + strings.Replace(r.Value.String(), "/", "\\/", -1) + "/" }
+
 type ReturnValue struct {
    Value Object
 }
@@ -74,38 +84,78 @@ type Error struct {
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string { return "Error: " + e.Message }
 
+/*
+ * Environment: chain of slice-backed frames
+ *    ~ bindings are addressed by (depth, slot) as computed by the resolver
+ *    ~ the top-level frame grows on demand, function frames are sized by their literal
+ */
 type Environment struct {
-   store map[string]Object
+   store []Object
+   names []string // name of each slot
    outer *Environment
 }
 
 func NewEnvironment() *Environment {
-   s := make(map[string]Object)
-   return &Environment{store: s, outer: nil}
+   return &Environment{store: []Object{}, names: []string{}, outer: nil}
 }
 
-func NewExtendedEnvironment(outer *Environment) *Environment {
-   env := NewEnvironment()
-   env.outer = outer
-   return env
+func NewExtendedEnvironment(outer *Environment, names []string) *Environment {
+   return &Environment{store: make([]Object, len(names)), names: names, outer: outer}
 }
 
-func (e *Environment) Get(name string) (Object, bool) {
-      obj, ok := e.store[name]
-      if !ok && e.outer != nil {
-         obj, ok = e.outer.Get(name)
-      }
-      return obj, ok
+func (e *Environment) Get(depth, slot int) (Object, bool) {
+   for ; depth > 0; depth-- {
+      e = e.outer
+   }
+   if slot >= len(e.store) || e.store[slot] == nil {
+      return nil, false // declared, but not (yet) bound
+   }
+   return e.store[slot], true
 }
 
-func (e *Environment) Set(name string, obj Object) Object {
-   e.store[name] = obj
+func (e *Environment) Set(slot int, name string, obj Object) Object {
+   if slot >= len(e.store) {
+      e.store = append(e.store, make([]Object, slot + 1 - len(e.store))...)
+      e.names = append(e.names, make([]string, slot + 1 - len(e.names))...)
+   }
+   if e.names[slot] != name { // only the top-level frame owns its names
+      e.names[slot] = name
+   }
+   e.store[slot] = obj
    return obj
 }
 
+// names bound in this frame and its outer frames, innermost first
+func (e *Environment) Names() []string {
+   seen := make(map[string]bool)
+   names := []string{}
+   for ; e != nil; e = e.outer {
+      for slot, name := range e.names {
+         if name != "" && e.store[slot] != nil && !seen[name] {
+            seen[name] = true
+            names = append(names, name)
+         }
+      }
+   }
+   return names
+}
+
+// value bound to name, by name rather than address (for tools, e.g. the REPL)
+func (e *Environment) Lookup(name string) (Object, bool) {
+   for ; e != nil; e = e.outer {
+      for slot := len(e.names) - 1; slot >= 0; slot-- {
+         if e.names[slot] == name && e.store[slot] != nil {
+            return e.store[slot], true
+         }
+      }
+   }
+   return nil, false
+}
+
 type Function struct {
    Parameters []*ast.Identifier
    Body *ast.BlockStatement
+   Locals []string // frame layout
    Env *Environment
 }
 
@@ -129,14 +179,34 @@ func (f *Function) Inspect() string {
 type BuiltinFunction func(args ...Object) Object 
 
 type Builtin struct {
+   Name string
    Fn BuiltinFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
-func (b* Builtin) Inspect() string { return "builtin" }
+func (b* Builtin) Inspect() string { return "builtin " + b.Name }
 
+// persistent array (see vector.go)
 type Array struct {
-   Elements []Object
+   elements vector
+}
+
+func NewArray(elements []Object) *Array {
+   return &Array{elements: newVector(elements)}
+}
+
+func (ao *Array) Len() int { return ao.elements.len() }
+func (ao *Array) Get(i int) Object { return ao.elements.get(i) }
+func (ao *Array) Elements() []Object { return ao.elements.elements() }
+
+// new array with obj appended
+func (ao *Array) Push(obj Object) *Array {
+   return &Array{elements: ao.elements.push(obj)}
+}
+
+// new array without the first element
+func (ao *Array) Rest() *Array {
+   return &Array{elements: ao.elements.rest()}
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
@@ -144,7 +214,7 @@ func (ao *Array) Inspect() string {
    var out bytes.Buffer 
 
    elements := []string{}
-   for _, e := range ao.Elements {
+   for _, e := range ao.Elements() {
       elements = append(elements, e.Inspect())
    }
 
@@ -188,8 +258,59 @@ type HashPair struct {
    Value Object
 }
 
+/*
+ * Persistent hash (see hamt.go)
+ *    ~ pairs are iterated in insertion order
+ *    ~ order holds the key of each inserted pair, nil once deleted
+ */
 type Hash struct {
-   Pairs map[HashKey]HashPair
+   pairs hamt
+   order vector
+}
+
+func NewHash() *Hash {
+   return &Hash{order: newVector(nil)}
+}
+
+func (h *Hash) Len() int { return h.pairs.count }
+
+func (h *Hash) Get(key HashKey) (HashPair, bool) {
+   if leaf, ok := h.pairs.get(key); ok {
+      return leaf.pair, true
+   }
+   return HashPair{}, false
+}
+
+// new hash with pair inserted (or replaced, keeping its position)
+func (h *Hash) Set(pair HashPair) *Hash {
+   key := pair.Key.(Hashable).HashKey()
+   if leaf, ok := h.pairs.get(key); ok {
+      return &Hash{pairs: h.pairs.set(key, pair, leaf.index), order: h.order}
+   }
+   index := h.order.len()
+   return &Hash{pairs: h.pairs.set(key, pair, index), order: h.order.push(pair.Key)}
+}
+
+// new hash without key
+func (h *Hash) Delete(key HashKey) *Hash {
+   leaf, ok := h.pairs.get(key)
+   if !ok {
+      return h
+   }
+   return &Hash{pairs: h.pairs.delete(key), order: h.order.set(leaf.index, nil)}
+}
+
+// pairs in insertion order
+func (h *Hash) Pairs() []HashPair {
+   pairs := make([]HashPair, 0, h.Len())
+   for _, key := range h.order.elements() {
+      if key == nil {
+         continue
+      }
+      pair, _ := h.Get(key.(Hashable).HashKey())
+      pairs = append(pairs, pair)
+   }
+   return pairs
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -197,7 +318,7 @@ func (h *Hash) Inspect() string {
    var out bytes.Buffer
 
    pairs := []string{}
-   for _, pair := range h.Pairs {
+   for _, pair := range h.Pairs() {
       pairs = append(pairs, fmt.Sprintf("%s:%s", pair.Key.Inspect(), pair.Value.Inspect()))
    }
 
@@ -206,3 +327,29 @@ func (h *Hash) Inspect() string {
    out.WriteString("}")
    return out.String()
 }
+
+// frame enclosing this one, nil for the top-level frame
+func (e *Environment) Outer() *Environment {
+   return e.outer
+}
+
+// name of each slot of this frame (not its outer frames), "" for unused slots
+func (e *Environment) Slots() []string {
+   return e.names
+}
+
+type Binding struct {
+   Name  string
+   Value Object
+}
+
+// bound slots of this frame (not its outer frames) in slot order, e.g. for debuggers
+func (e *Environment) Bindings() []Binding {
+   bindings := []Binding{}
+   for slot, name := range e.names {
+      if name != "" && slot < len(e.store) && e.store[slot] != nil {
+         bindings = append(bindings, Binding{name, e.store[slot]})
+      }
+   }
+   return bindings
+}
@@ -62,3 +62,129 @@ func TestIntegerHashKey(t *testing.T) {
 	}
 }
 
+/*
+ * Test of persistent Array and Hash: structural sharing must not leak mutations
+ */
+func TestArrayPushGet(t *testing.T) {
+	const n = 40000 // deep enough for a three-level trie
+	arrays := []*Array{NewArray(nil)}
+	arr := arrays[0]
+	for i := 0; i < n; i++ {
+		arr = arr.Push(&Integer{Value: int64(i)})
+		if i%997 == 0 {
+			arrays = append(arrays, arr)
+		}
+	}
+
+	if arr.Len() != n {
+		t.Fatalf("array has wrong length. want=%d, got=%d", n, arr.Len())
+	}
+	for i := 0; i < n; i++ {
+		if got := arr.Get(i).(*Integer).Value; got != int64(i) {
+			t.Fatalf("wrong element at %d. got=%d", i, got)
+		}
+	}
+
+	// earlier versions are unaffected by later pushes
+	for _, old := range arrays {
+		for i := 0; i < old.Len(); i++ {
+			if got := old.Get(i).(*Integer).Value; got != int64(i) {
+				t.Fatalf("old version has wrong element at %d. got=%d", i, got)
+			}
+		}
+	}
+}
+
+func TestArrayRest(t *testing.T) {
+	arr := NewArray([]Object{&Integer{Value: 1}, &Integer{Value: 2}, &Integer{Value: 3}})
+	rest := arr.Rest()
+	pushed := rest.Push(&Integer{Value: 4})
+
+	expected := map[*Array][]int64{
+		arr:    {1, 2, 3},
+		rest:   {2, 3},
+		pushed: {2, 3, 4},
+	}
+	for array, elements := range expected {
+		if array.Len() != len(elements) {
+			t.Fatalf("array has wrong length. want=%d, got=%d", len(elements), array.Len())
+		}
+		for i, el := range array.Elements() {
+			if el.(*Integer).Value != elements[i] {
+				t.Errorf("wrong element at %d. want=%d, got=%s", i, elements[i], el.Inspect())
+			}
+		}
+	}
+}
+
+func TestHashSetGetDelete(t *testing.T) {
+	const n = 5000
+	hash := NewHash()
+	for i := 0; i < n; i++ {
+		hash = hash.Set(HashPair{Key: &Integer{Value: int64(i)}, Value: &Integer{Value: int64(i * i)}})
+	}
+	withStrings := hash.Set(HashPair{Key: &String{Value: "one"}, Value: &Integer{Value: 1}})
+	replaced := withStrings.Set(HashPair{Key: &Integer{Value: 0}, Value: &String{Value: "zero"}})
+	deleted := replaced.Delete((&Integer{Value: 1}).HashKey())
+
+	if hash.Len() != n || withStrings.Len() != n+1 || replaced.Len() != n+1 || deleted.Len() != n {
+		t.Fatalf("wrong lengths. got=%d, %d, %d, %d",
+			hash.Len(), withStrings.Len(), replaced.Len(), deleted.Len())
+	}
+
+	for i := 0; i < n; i++ {
+		pair, ok := hash.Get((&Integer{Value: int64(i)}).HashKey())
+		if !ok || pair.Value.(*Integer).Value != int64(i*i) {
+			t.Fatalf("wrong pair for key %d. got=%+v", i, pair)
+		}
+	}
+	if _, ok := hash.Get((&String{Value: "one"}).HashKey()); ok {
+		t.Errorf("original hash contains later key")
+	}
+	if pair, _ := hash.Get((&Integer{Value: 0}).HashKey()); pair.Value.Inspect() != "0" {
+		t.Errorf("original hash sees replaced value. got=%s", pair.Value.Inspect())
+	}
+	if pair, _ := replaced.Get((&Integer{Value: 0}).HashKey()); pair.Value.Inspect() != "zero" {
+		t.Errorf("replaced value not found. got=%s", pair.Value.Inspect())
+	}
+	if _, ok := deleted.Get((&Integer{Value: 1}).HashKey()); ok {
+		t.Errorf("deleted key still present")
+	}
+	if _, ok := replaced.Get((&Integer{Value: 1}).HashKey()); !ok {
+		t.Errorf("delete removed key from original hash")
+	}
+
+	// insertion order survives replacement and deletion
+	pairs := deleted.Pairs()
+	if pairs[0].Value.Inspect() != "zero" || pairs[1].Key.Inspect() != "2" || pairs[len(pairs)-1].Key.Inspect() != "one" {
+		t.Errorf("wrong pair order. got=%s, %s, ..., %s",
+			pairs[0].Key.Inspect(), pairs[1].Key.Inspect(), pairs[len(pairs)-1].Key.Inspect())
+	}
+}
+
+func TestHashCollisions(t *testing.T) {
+	seed := func(tt ObjectType) uint64 { return hashOf(HashKey{Type: tt, Value: 0}) }
+	integer := HashKey{Type: INTEGER_OBJ, Value: 42}
+	colliding := HashKey{Type: STRING_OBJ, Value: 42 ^ seed(INTEGER_OBJ) ^ seed(STRING_OBJ)}
+	if hashOf(integer) != hashOf(colliding) {
+		t.Fatalf("keys do not collide")
+	}
+
+	m := hamt{}
+	m = m.set(integer, HashPair{Value: &Integer{Value: 1}}, 0)
+	m = m.set(colliding, HashPair{Value: &Integer{Value: 2}}, 1)
+	if m.count != 2 {
+		t.Fatalf("wrong count. got=%d", m.count)
+	}
+	if leaf, ok := m.get(colliding); !ok || leaf.pair.Value.Inspect() != "2" {
+		t.Errorf("colliding key not found")
+	}
+
+	m = m.delete(integer)
+	if _, ok := m.get(integer); ok || m.count != 1 {
+		t.Errorf("colliding key not deleted")
+	}
+	if leaf, ok := m.get(colliding); !ok || leaf.pair.Value.Inspect() != "2" {
+		t.Errorf("delete removed wrong colliding key")
+	}
+}
@@ -0,0 +1,148 @@
+package object
+
+/*
+ * Persistent vector: 32-way trie with a tail buffer (as in Clojure)
+ *    ~ push, get and set copy at most one path from the root, O(log32 n)
+ *    ~ start offsets the visible range, so dropping the head (rest) is O(1)
+ *    ~ all operations return a new vector, sharing structure with the old one
+ */
+const (
+   vectorBits  = 5
+   vectorWidth = 1 << vectorBits
+   vectorMask  = vectorWidth - 1
+)
+
+type vector struct {
+   size  int // number of elements stored (including the dropped head)
+   start int // index of the first visible element
+   shift uint
+   root  *vectorNode
+   tail  []Object
+}
+
+type vectorNode struct {
+   children []*vectorNode // internal nodes
+   values   []Object      // leaf nodes
+}
+
+var emptyVectorNode = &vectorNode{}
+
+func newVector(elements []Object) vector {
+   v := vector{shift: vectorBits, root: emptyVectorNode, tail: []Object{}}
+   for _, el := range elements {
+      v = v.push(el)
+   }
+   return v
+}
+
+func (v vector) len() int {
+   return v.size - v.start
+}
+
+func (v vector) tailOffset() int {
+   if v.size < vectorWidth {
+      return 0
+   }
+   return ((v.size - 1) >> vectorBits) << vectorBits
+}
+
+func (v vector) leafFor(i int) []Object {
+   if i >= v.tailOffset() {
+      return v.tail
+   }
+   node := v.root
+   for level := v.shift; level > 0; level -= vectorBits {
+      node = node.children[(i >> level) & vectorMask]
+   }
+   return node.values
+}
+
+func (v vector) get(i int) Object {
+   i += v.start
+   return v.leafFor(i)[i & vectorMask]
+}
+
+func (v vector) set(i int, obj Object) vector {
+   i += v.start
+   if i >= v.tailOffset() {
+      tail := make([]Object, len(v.tail))
+      copy(tail, v.tail)
+      tail[i & vectorMask] = obj
+      v.tail = tail
+      return v
+   }
+   v.root = v.setPath(v.shift, v.root, i, obj)
+   return v
+}
+
+func (v vector) setPath(level uint, node *vectorNode, i int, obj Object) *vectorNode {
+   if level == 0 {
+      values := make([]Object, len(node.values))
+      copy(values, node.values)
+      values[i & vectorMask] = obj
+      return &vectorNode{values: values}
+   }
+   children := make([]*vectorNode, len(node.children))
+   copy(children, node.children)
+   idx := (i >> level) & vectorMask
+   children[idx] = v.setPath(level - vectorBits, node.children[idx], i, obj)
+   return &vectorNode{children: children}
+}
+
+func (v vector) push(obj Object) vector {
+   if v.size - v.tailOffset() < vectorWidth { // room in tail
+      tail := make([]Object, len(v.tail) + 1)
+      copy(tail, v.tail)
+      tail[len(v.tail)] = obj
+      v.tail = tail
+      v.size += 1
+      return v
+   }
+
+   // tail is full: move it into the trie
+   tailNode := &vectorNode{values: v.tail}
+   if (v.size >> vectorBits) > (1 << v.shift) { // root overflow
+      v.root = &vectorNode{children: []*vectorNode{v.root, newVectorPath(v.shift, tailNode)}}
+      v.shift += vectorBits
+   } else {
+      v.root = v.pushTail(v.shift, v.root, tailNode)
+   }
+   v.tail = []Object{obj}
+   v.size += 1
+   return v
+}
+
+func (v vector) pushTail(level uint, parent *vectorNode, tailNode *vectorNode) *vectorNode {
+   idx := ((v.size - 1) >> level) & vectorMask
+   children := make([]*vectorNode, idx + 1)
+   copy(children, parent.children)
+
+   if level == vectorBits {
+      children[idx] = tailNode
+   } else if idx < len(parent.children) {
+      children[idx] = v.pushTail(level - vectorBits, parent.children[idx], tailNode)
+   } else {
+      children[idx] = newVectorPath(level - vectorBits, tailNode)
+   }
+   return &vectorNode{children: children}
+}
+
+func newVectorPath(level uint, node *vectorNode) *vectorNode {
+   if level == 0 {
+      return node
+   }
+   return &vectorNode{children: []*vectorNode{newVectorPath(level - vectorBits, node)}}
+}
+
+func (v vector) rest() vector {
+   v.start += 1
+   return v
+}
+
+func (v vector) elements() []Object {
+   elements := make([]Object, 0, v.len())
+   for i := v.start; i < v.size; i++ {
+      elements = append(elements, v.leafFor(i)[i & vectorMask])
+   }
+   return elements
+}
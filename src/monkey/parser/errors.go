@@ -0,0 +1,160 @@
+package parser
+
+import (
+   "fmt"
+   "sort"
+   "strings"
+   "monkey/token"
+)
+
+/*
+ * Parser errors: position, extent and message of each syntax error
+ *    ~ Expected and Got are set when a specific token was missing, e.g. ")" expected, ";" found
+ *    ~ ILLEGAL tokens are reported with the lexer's error (e.g. unterminated string), not as unexpected tokens,
+ *      the errors of ILLEGAL tokens skipped after an error are added in order of position
+ *    ~ after an error the parser skips to the end of the statement (";", before "}" or the next let/return)
+ *      and goes on, an error at the position of the previous one is dropped as a follow-on error
+ *    ~ parsing stops after MaxErrors errors
+ */
+const MaxErrors = 10
+
+type Error struct {
+   Pos      token.SourcePosition
+   End      token.SourcePosition // just after the offending token, on the same line
+   Message  string
+   Expected token.TokenType      // "" if no specific token was expected
+   Got      token.TokenType
+}
+
+// "line:char: message"
+func (e *Error) Error() string {
+   return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Char, e.Message)
+}
+
+func (p *Parser) Errors() []string {
+   msgs := make([]string, len(p.errors))
+   for i, err := range p.errors {
+      msgs[i] = err.Error()
+   }
+   return msgs
+}
+
+func (p *Parser) Diagnostics() []*Error {
+   return p.errors
+}
+
+func (p *Parser) errorAt(tok token.Token, expected token.TokenType, format string, a ...interface{}) {
+   if p.tooMany {
+      return
+   }
+   if n := len(p.errors); n > 0 && p.errors[n - 1].Pos == tok.Position {
+      return
+   }
+   err := &Error{
+      Pos: tok.Position,
+      End: tok.End,
+      Message: fmt.Sprintf(format, a...),
+      Expected: expected,
+      Got: tok.Type,
+   }
+   if lerr := p.l.ErrorAt(tok.Position); tok.Type == token.ILLEGAL && lerr != nil {
+      err.Pos, err.End, err.Message = lerr.Pos, lerr.End, lerr.Message
+   }
+   p.errors = append(p.errors, err)
+   if len(p.errors) == MaxErrors {
+      p.tooMany = true
+      p.errors = append(p.errors, &Error{Pos: tok.Position, End: tok.End, Message: "too many errors", Got: tok.Type})
+   }
+}
+
+// adds the lexer errors not reported in place of an error for their ILLEGAL token
+func (p *Parser) mergeLexerErrors() {
+   if p.tooMany {
+      return
+   }
+   reported := make(map[token.SourcePosition]bool)
+   for _, err := range p.errors {
+      if err.Got == token.ILLEGAL {
+         reported[err.Pos] = true
+      }
+   }
+   merged := false
+   for _, lerr := range p.l.Errors() {
+      if !reported[lerr.Pos] {
+         p.errors = append(p.errors, &Error{Pos: lerr.Pos, End: lerr.End, Message: lerr.Message, Got: token.ILLEGAL})
+         merged = true
+      }
+   }
+   if merged {
+      sort.SliceStable(p.errors, func(i, j int) bool {
+         return p.errors[i].Pos.Offset < p.errors[j].Pos.Offset
+      })
+   }
+}
+
+/*
+ * Synchronization: skips the rest of a statement that has errors
+ *    ~ stops on ";", or before "}", "let", "return" and the end of input,
+ *      at the nesting depth the statement started at (or outside of it)
+ *    ~ brackets opened while skipping are skipped up to their closing bracket, brackets left open
+ *      at the error still end the statement on ";" or before "let" and "return" (e.g. "[1, 2;")
+ */
+func (p *Parser) synchronize(depth int) {
+   open := p.depth + nesting(p.curToken.Type) // depth at the error
+   for !p.curTokenIs(token.EOF) {
+      after := p.depth + nesting(p.curToken.Type) // depth after p.curToken
+      if after <= open && (p.curTokenIs(token.SEMICOLON) || p.peekTokenIs(token.LET) || p.peekTokenIs(token.RETURN)) {
+         return
+      }
+      if after <= depth && (p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF)) {
+         return
+      }
+      p.nextToken()
+   }
+}
+
+func nesting(tt token.TokenType) int {
+   switch tt {
+      case token.LPAREN, token.LBRACKET, token.LBRACE:
+         return 1
+      case token.RPAREN, token.RBRACKET, token.RBRACE:
+         return -1
+      default:
+         return 0
+   }
+}
+
+var spellings = map[token.TokenType]string{
+   token.EOF: "end of input",
+   token.ILLEGAL: "illegal token",
+   token.IDENT: "identifier",
+   token.INT: "integer",
+   token.STRING: "string",
+   token.REGEX: "regex",
+   token.COMMA: `","`,
+   token.SEMICOLON: `";"`,
+   token.COLON: `":"`,
+}
+
+// how a token type is called in messages, e.g. `")"`, `"let"` or identifier
+func describe(tt token.TokenType) string {
+   if spelling, ok := spellings[tt]; ok {
+      return spelling
+   }
+   for _, keyword := range token.Keywords() {
+      if token.LookupIdent(keyword) == tt {
+         return `"` + keyword + `"`
+      }
+   }
+   return `"` + strings.ToLower(string(tt)) + `"`
+}
+
+// describe, with the literal of tokens that have a value, e.g. identifier "x"
+func describeToken(tok token.Token) string {
+   switch tok.Type {
+      case token.IDENT, token.INT, token.STRING, token.REGEX, token.ILLEGAL:
+         return fmt.Sprintf("%s %q", describe(tok.Type), tok.Literal)
+      default:
+         return describe(tok.Type)
+   }
+}
@@ -1,7 +1,8 @@
 package parser
 
 import (
-   "fmt"
+   "io"
+   "regexp"
    "strconv"
    "monkey/ast"
    "monkey/lexer"
@@ -22,6 +23,14 @@ const (
    INDEX          // a[1]
 )
 
+// binding power of an infix operator (LOWEST for other tokens)
+func Precedence(tt token.TokenType) int {
+   if precedence, ok := precedences[tt]; ok {
+      return precedence
+   }
+   return LOWEST
+}
+
 var precedences = map[token.TokenType]int{
    token.RPAREN:     LOWEST,
    token.EQ:         EQUALS,
@@ -47,7 +56,12 @@ type Parser struct {
    l *lexer.Lexer
    curToken token.Token
    peekToken token.Token
-   errors []string
+   errors []*Error
+   synced int       // errors up to here have been recovered from
+   tooMany bool     // MaxErrors reached, parsing stopped
+   depth int        // brackets, braces and parentheses opened before p.curToken
+   tracer io.Writer // nil: parsing is not traced
+   traceLevel int   // nesting of traced parsing functions
 
    prefixParseFns map[token.TokenType]prefixParseFn
    infixParseFns map[token.TokenType]infixParseFn
@@ -72,14 +86,20 @@ func (p *Parser) registerInfixFn(tokenType token.TokenType, fn infixParseFn) {
    p.infixParseFns[tokenType] = fn
 }
 
-func New(l *lexer.Lexer) *Parser {
-   p := &Parser{l: l, errors: []string{}}
+type Option func(p *Parser)
+
+func New(l *lexer.Lexer, options ...Option) *Parser {
+   p := &Parser{l: l, errors: []*Error{}}
+   for _, option := range options {
+      option(p)
+   }
 
    // prefix parse functions
    p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
    p.registerPrefixFn(token.IDENT, p.parseIdentifier)
    p.registerPrefixFn(token.INT, p.parseIntegerLiteral)
    p.registerPrefixFn(token.STRING, p.parseStringLiteral)
+   p.registerPrefixFn(token.REGEX, p.parseRegexLiteral)
    p.registerPrefixFn(token.TRUE, p.parseBoolean)
    p.registerPrefixFn(token.FALSE, p.parseBoolean)
    p.registerPrefixFn(token.BANG, p.parsePrefixExpression)
@@ -112,35 +132,46 @@ func New(l *lexer.Lexer) *Parser {
    return p
 }
 
-func (p *Parser) Errors() []string {
-   return p.errors
-}
-
 func (p *Parser) nextToken() token.Token {
+   p.depth += nesting(p.curToken.Type)
    p.curToken = p.peekToken
    p.peekToken = p.l.NextToken()
    return p.curToken
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
-//   defer untrace(trace("ParseProgram"))
+   defer p.untrace(p.trace("ParseProgram", 0))
 
    prog := &ast.Program{}
    prog.Statements = []ast.Statement{}
 
-   for !p.curTokenIs(token.EOF) {
-      stmt := p.parseStatement()
-      if stmt != nil {
+   for !p.curTokenIs(token.EOF) && !p.tooMany {
+      if stmt := p.parseStatementOrSkip(); stmt != nil {
          prog.Statements = append(prog.Statements, stmt)
       }
       p.nextToken() // consume (optional) token.SEMICOLON 
    }
+   p.mergeLexerErrors()
 
    return prog
 }
 
+// a statement, nil if it has errors (the tokens after an error are skipped)
+func (p *Parser) parseStatementOrSkip() ast.Statement {
+   errors, depth := len(p.errors), p.depth
+   stmt := p.parseStatement()
+   if len(p.errors) > p.synced { // not yet recovered by an inner statement
+      p.synchronize(depth)
+      p.synced = len(p.errors)
+   }
+   if len(p.errors) > errors {
+      return nil
+   }
+   return stmt
+}
+
 func (p *Parser) parseStatement() ast.Statement {
-//   defer untrace(trace("parseStatement"))
+   defer p.untrace(p.trace("parseStatement", 0))
 
    switch p.curToken.Type {
       case token.LET:
@@ -153,7 +184,7 @@ func (p *Parser) parseStatement() ast.Statement {
 }
 
 func (p *Parser) parseLetStatement() ast.Statement {
-//   defer untrace(trace("parseLetStatement"))
+   defer p.untrace(p.trace("parseLetStatement", 0))
 
    stmt := &ast.LetStatement{Token: p.curToken}
 
@@ -179,7 +210,7 @@ func (p *Parser) parseLetStatement() ast.Statement {
 }
 
 func (p *Parser) parseReturnStatement() ast.Statement {
-//   defer untrace(trace("parseReturnStatement"))
+   defer p.untrace(p.trace("parseReturnStatement", 0))
 
    stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -195,7 +226,7 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 }
 
 func (p *Parser) parseExpressionStatement() ast.Statement {
-//   defer untrace(trace("parseExpressionStatement"))
+   defer p.untrace(p.trace("parseExpressionStatement", 0))
 
    stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -209,20 +240,20 @@ func (p *Parser) parseExpressionStatement() ast.Statement {
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-//   defer untrace(trace("parseBlockStatement"))
+   defer p.untrace(p.trace("parseBlockStatement", 0))
 
    bs := &ast.BlockStatement{Token: p.curToken}
    bs.Statements = []ast.Statement{}
 
    p.nextToken() // consume token.LBRACE
 
-   for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-      stmt := p.parseStatement()
-      if stmt != nil {
+   for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) && !p.tooMany {
+      if stmt := p.parseStatementOrSkip(); stmt != nil {
          bs.Statements = append(bs.Statements, stmt)
       }
       p.nextToken()
    }
+   bs.Rbrace = p.curToken
 
    return bs
 }
@@ -233,17 +264,20 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
  *    ~ peekPrecedence: left-binding power (next operator)
  */
 func (p *Parser) parseExpression(precedence int) ast.Expression { 
-//   defer untrace(trace("parseExpression"))
+   defer p.untrace(p.trace("parseExpression", precedence))
 
    prefix := p.prefixParseFns[p.curToken.Type] 
 
    if prefix == nil {
-      msg := fmt.Sprintf("parseExpression: found no prefix parse function for %s (%s)", p.curToken.Type, p.curToken.Position.String())
-      p.errors = append(p.errors, msg)
+      p.errorAt(p.curToken, "", "expected an expression, got %s", describeToken(p.curToken))
       return nil
    }
 
+   errors := len(p.errors)
    leftExp := prefix() 
+   if len(p.errors) > errors { // the statement is skipped
+      return nil
+   }
 
    for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() { // token.LPAREN, token.EOF etc. have LOWEST precedence (unspecified)
       infix := p.infixParseFns[p.peekToken.Type]
@@ -254,13 +288,16 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
       p.nextToken()
       leftExp = infix(leftExp)
+      if len(p.errors) > errors {
+         return nil
+      }
    }
    
    return leftExp
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
-//  defer untrace(trace("parsePrefixExpression"))
+   defer p.untrace(p.trace("parsePrefixExpression", PREFIX))
 
   pe := &ast.PrefixExpression{
      Token: p.curToken,
@@ -273,7 +310,7 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-//   defer untrace(trace("parseInfixExpression"))
+   defer p.untrace(p.trace("parseInfixExpression", p.curPrecedence()))
 
    ie := &ast.InfixExpression{
       Token: p.curToken,
@@ -289,7 +326,7 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
-//   defer untrace(trace("parseIfExpression"))
+   defer p.untrace(p.trace("parseIfExpression", 0))
    
    ie := &ast.IfExpression{Token: p.curToken}
 
@@ -299,6 +336,9 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
    p.nextToken()  // consume token.LPAREN
    ie.Condition = p.parseExpression(LOWEST)
+   if ie.Condition == nil { // the statement is skipped
+      return nil
+   }
 
    if !p.expectPeek(token.RPAREN) {
       return nil
@@ -324,21 +364,20 @@ func (p *Parser) parseIfExpression() ast.Expression {
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-//   defer untrace(trace("parseIdentifier"))
+   defer p.untrace(p.trace("parseIdentifier", 0))
 
    return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-//   defer untrace(trace("parseIntegerLiteral"))
+   defer p.untrace(p.trace("parseIntegerLiteral", 0))
 
    il := &ast.IntegerLiteral{Token: p.curToken}
 
    val, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 
    if err != nil {
-      msg := fmt.Sprintf("parseIdentifier: could not parse %s as integer (%s)", p.curToken.Literal, p.curToken.Position.String())
-      p.errors = append(p.errors, msg)
+      p.errorAt(p.curToken, "", "could not parse %s as integer", p.curToken.Literal)
       return nil
    }
 
@@ -348,19 +387,36 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 }
 
 func (p *Parser) parseStringLiteral() ast.Expression {
+   defer p.untrace(p.trace("parseStringLiteral", 0))
+
    return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseRegexLiteral() ast.Expression {
+   defer p.untrace(p.trace("parseRegexLiteral", 0))
+
+   if _, err := regexp.Compile(p.curToken.Literal); err != nil {
+      p.errorAt(p.curToken, "", "could not parse /%s/ as regex: %s", p.curToken.Literal, err)
+      return nil
+   }
+   return &ast.RegexLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
-//   defer untrace(trace("parseBoolean"))
+   defer p.untrace(p.trace("parseBoolean", 0))
 
    return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)} // only called for token.TRUE and token.FALSE
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
+   defer p.untrace(p.trace("parseGroupedExpression", 0))
+
    p.nextToken() // consume token.LPAREN
    
    exp := p.parseExpression(LOWEST) // parse until matching token.RPAREN
+   if exp == nil { // the statement is skipped
+      return nil
+   }
 
    if !p.expectPeek(token.RPAREN) {
       return nil
@@ -370,7 +426,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 }
 
 func (p *Parser) parseFuncLiteral() ast.Expression {
-//   defer untrace(trace("parseFuncLiteral"))
+   defer p.untrace(p.trace("parseFuncLiteral", 0))
 
    fl := &ast.FunctionLiteral{Token: p.curToken}
 
@@ -379,6 +435,9 @@ func (p *Parser) parseFuncLiteral() ast.Expression {
    }
    
    fl.Parameters = p.parseFuncParameters() // (x, y, ...)
+   if fl.Parameters == nil {
+      return nil
+   }
 
    if !p.expectPeek(token.LBRACE) {
       return nil
@@ -390,7 +449,7 @@ func (p *Parser) parseFuncLiteral() ast.Expression {
 }
 
 func (p *Parser) parseFuncParameters() []*ast.Identifier {
-//   defer untrace(trace("parseFuncParameters"))
+   defer p.untrace(p.trace("parseFuncParameters", 0))
 
    ids := []*ast.Identifier{}
 
@@ -399,14 +458,18 @@ func (p *Parser) parseFuncParameters() []*ast.Identifier {
       return ids
    }
 
-   p.nextToken()
+   if !p.expectPeek(token.IDENT) {
+      return nil
+   }
 
    id := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
    ids = append(ids, id) 
 
    for p.peekTokenIs(token.COMMA) {
       p.nextToken() // consume token.IDENT
-      p.nextToken() // consume token.COMMA
+      if !p.expectPeek(token.IDENT) { // consume token.COMMA
+         return nil
+      }
       id = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
       ids = append(ids, id)
    }
@@ -419,21 +482,25 @@ func (p *Parser) parseFuncParameters() []*ast.Identifier {
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
-//   defer untrace(trace("parseCallExpression"))
+   defer p.untrace(p.trace("parseCallExpression", CALL))
 
    exp := &ast.CallExpression{Token: p.curToken, Function: function}
    exp.Arguments = p.parseExpressionList(token.RPAREN) // (x, y, ...)
+   exp.Rparen = p.curToken
    return exp
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
+   defer p.untrace(p.trace("parseArrayLiteral", 0))
+
    array := &ast.ArrayLiteral{Token: p.curToken}
    array.Elements = p.parseExpressionList(token.RBRACKET)
+   array.Rbracket = p.curToken
    return array
 }
 
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
-//   defer untrace(trace("parseExpressionList"))
+   defer p.untrace(p.trace("parseExpressionList", 0))
 
    list := []ast.Expression{}
 
@@ -443,12 +510,17 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
    }
 
    p.nextToken() // consume start token
-   list = append(list, p.parseExpression(LOWEST))
-
-   for p.peekTokenIs(token.COMMA) {
+   for {
+      exp := p.parseExpression(LOWEST)
+      if exp == nil { // the statement is skipped
+         return nil
+      }
+      list = append(list, exp)
+      if !p.peekTokenIs(token.COMMA) {
+         break
+      }
       p.nextToken() 
       p.nextToken() // consume token.COMMA
-      list = append(list, p.parseExpression(LOWEST))
    }
    
    if !p.expectPeek(end) { // align p.curToken with end token
@@ -459,17 +531,24 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
+   defer p.untrace(p.trace("parseHashLiteral", 0))
+
    hash := &ast.HashLiteral{Token: p.curToken}
    hash.Pairs = make(map[ast.Expression]ast.Expression)
+   hash.Keys = []ast.Expression{}
    for !p.peekTokenIs(token.RBRACE) {
       p.nextToken()
       key := p.parseExpression(LOWEST)
-      if !p.expectPeek(token.COLON) {
+      if key == nil || !p.expectPeek(token.COLON) {
          return nil
       }
       p.nextToken() // consume token.COLON
       value := p.parseExpression(LOWEST)
+      if value == nil {
+         return nil
+      }
       hash.Pairs[key] = value
+      hash.Keys = append(hash.Keys, key)
       if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) { // expect token.LBRACE or token.COMMA
          return nil
       }
@@ -477,18 +556,20 @@ func (p *Parser) parseHashLiteral() ast.Expression {
    if !p.expectPeek(token.RBRACE) {
       return nil
    }
+   hash.Rbrace = p.curToken
    return hash
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-//   defer untrace(trace("parseIndexExpression"))
+   defer p.untrace(p.trace("parseIndexExpression", INDEX))
 
    ie := &ast.IndexExpression{Token: p.curToken, Left: left}
    p.nextToken() // consume token.LBRACKET
    ie.Index = p.parseExpression(LOWEST)
-   if !p.expectPeek(token.RBRACKET) {
+   if ie.Index == nil || !p.expectPeek(token.RBRACKET) {
       return nil
    }
+   ie.Rbracket = p.curToken
    return ie
 }
 
@@ -505,8 +586,7 @@ func (p *Parser) expectPeek(tt token.TokenType) bool {
       p.nextToken()
       return true
    } else {
-      msg := fmt.Sprintf("expectPeek: wrong peek token type. expected=%q, got=%q (%s)", tt, p.peekToken.Type, p.peekToken.Position.String())
-      p.errors = append(p.errors, msg)
+      p.errorAt(p.peekToken, tt, "expected %s, got %s", describe(tt), describeToken(p.peekToken))
       return false
    }
 }
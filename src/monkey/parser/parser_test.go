@@ -3,7 +3,13 @@ package parser
 import (
 	"fmt"
 	"monkey/ast"
+	"monkey/corpus"
+	"monkey/evaluator"
 	"monkey/lexer"
+	"monkey/object"
+	"monkey/token"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -697,6 +703,52 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestRegexLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input string
+		value string
+		str   string
+	}{
+		{`/a+b/;`, "a+b", "/a+b/"},
+		{`match(/\d\/\d/i, s)`, `(?i)\d/\d`, `match(/(?i)\d\/\d/, s)`},
+		{`let r = [/x/, 10 / 2 / 1];`, "x", "let r = [/x/, ((10 / 2) / 1)]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var literal *ast.RegexLiteral
+		switch stmt := program.Statements[0].(type) {
+		case *ast.ExpressionStatement:
+			if call, ok := stmt.Expression.(*ast.CallExpression); ok {
+				literal, _ = call.Arguments[0].(*ast.RegexLiteral)
+			} else {
+				literal, _ = stmt.Expression.(*ast.RegexLiteral)
+			}
+		case *ast.LetStatement:
+			literal, _ = stmt.Value.(*ast.ArrayLiteral).Elements[0].(*ast.RegexLiteral)
+		}
+		if literal == nil {
+			t.Fatalf("no *ast.RegexLiteral in %s", tt.input)
+		}
+		if literal.Value != tt.value {
+			t.Errorf("literal.Value not %q. got=%q", tt.value, literal.Value)
+		}
+		if program.String() != tt.str {
+			t.Errorf("program.String() not %q. got=%q", tt.str, program.String())
+		}
+	}
+
+	p := New(lexer.New(`/a(/`))
+	p.ParseProgram()
+	if len(p.Errors()) != 1 || !strings.Contains(p.Errors()[0], "could not parse /a(/ as regex") {
+		t.Errorf("expected regex parse error. got=%v", p.Errors())
+	}
+}
+
 func TestParsingEmptyArrayLiterals(t *testing.T) {
 	input := "[]"
 
@@ -936,6 +988,113 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestParserErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let = 1;", []string{`1:5: expected identifier, got "="`}},
+		{"let x 1;", []string{`1:7: expected "=", got integer "1"`}},
+		{"let x = ;", []string{`1:9: expected an expression, got ";"`}},
+		{"fn(1) {}", []string{`1:4: expected identifier, got integer "1"`}},
+		{"if (x { 1 }", []string{`1:7: expected ")", got "{"`}},
+		{`{"a" 1}`, []string{`1:6: expected ":", got integer "1"`}},
+		{"puts(1", []string{`1:7: expected ")", got end of input`}},
+		{"let x = 5;\n  x + ;", []string{`2:7: expected an expression, got ";"`}},
+		{`let s = "abc`, []string{"1:9: unterminated string"}},
+		{"let r = /a/x; let n = 12ab;", []string{
+			`1:12: unknown regex flags "x"`,
+			`1:23: malformed number "12ab"`,
+		}},
+		{"let a = 1 + #;", []string{`1:13: invalid character "#"`}},
+		{"let = @ 2;", []string{
+			`1:5: expected identifier, got "="`,
+			`1:7: invalid character "@"`,
+		}},
+		{"let x = ;\nlet y = @;", []string{
+			`1:9: expected an expression, got ";"`,
+			`2:9: invalid character "@"`,
+		}},
+		{"let x = (1 + ; let y = 2", []string{`1:14: expected an expression, got ";"`}},
+		{"let x = f(1, ; let y = 2", []string{`1:14: expected an expression, got ";"`}},
+		{"let x = [1, 2 +; let y = 2", []string{`1:16: expected an expression, got ";"`}},
+		{"let x = {1: ; let y = 2", []string{`1:13: expected an expression, got ";"`}},
+		{"let x = a[1 * ; let y = 2", []string{`1:15: expected an expression, got ";"`}},
+		{"if (x == ) { 1 }", []string{`1:10: expected an expression, got ")"`}},
+		{"let x = ;\nlet y = ;", []string{
+			`1:9: expected an expression, got ";"`,
+			`2:9: expected an expression, got ";"`,
+		}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("wrong number of errors for %q. want=%q, got=%q", tt.input, tt.expected, errors)
+			continue
+		}
+		for i, msg := range tt.expected {
+			if errors[i] != msg {
+				t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, msg, errors[i])
+			}
+		}
+	}
+}
+
+func TestParserErrorFields(t *testing.T) {
+	p := New(lexer.New("let x = (1 + 2;"))
+	p.ParseProgram()
+	errors := p.Diagnostics()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors. want=1, got=%q", p.Errors())
+	}
+	err := errors[0]
+	if err.Expected != token.RPAREN || err.Got != token.SEMICOLON {
+		t.Errorf("wrong tokens. want=%q/%q, got=%q/%q", token.RPAREN, token.SEMICOLON, err.Expected, err.Got)
+	}
+	if err.Pos != (token.SourcePosition{Line: 1, Char: 15, Offset: 14}) || err.End != (token.SourcePosition{Line: 1, Char: 16, Offset: 15}) {
+		t.Errorf("wrong extent. got=%+v-%+v", err.Pos, err.End)
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	input := `let a = ;
+let b = fn(x) { let = x; x * 2 };
+let c = [1, 2;
+let x = (1 + ; let y = 2
+let d = b(a)
+return d;`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 4 {
+		t.Fatalf("wrong number of errors. want=4, got=%q", p.Errors())
+	}
+	expected := []string{"let y = 2", "let d = b(a)", "return d"}
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("wrong number of statements kept. want=%d, got=%q", len(expected), program.String())
+	}
+	for i, stmt := range program.Statements {
+		if stmt.String() != expected[i] {
+			t.Errorf("statement %d wrong. want=%q, got=%q", i, expected[i], stmt.String())
+		}
+	}
+}
+
+func TestParserMaxErrors(t *testing.T) {
+	p := New(lexer.New(strings.Repeat("let = 1;\n", 2*MaxErrors)))
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) != MaxErrors+1 {
+		t.Fatalf("wrong number of errors. want=%d, got=%d", MaxErrors+1, len(errors))
+	}
+	if !strings.HasSuffix(errors[MaxErrors], "too many errors") {
+		t.Errorf("last error wrong. got=%q", errors[MaxErrors])
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
@@ -1081,4 +1240,157 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	t.FailNow()
 }
 
+func TestNodeSpans(t *testing.T) {
+	input := `let add = fn(a, b) {
+   a +
+      b
+};
+add(1, [2, 3][0]) * -x;
+if (x) { "s" } else { /r/i };
+{"k": true}["k"]`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	text := func(node ast.Node) string { return input[node.Pos().Offset:node.End().Offset] }
+	let := program.Statements[0].(*ast.LetStatement)
+	fl := let.Value.(*ast.FunctionLiteral)
+	infix := fl.Body.Statements[0].(*ast.ExpressionStatement).Expression
+	product := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	call := product.Left.(*ast.CallExpression)
+	ifExp := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	index := program.Statements[3].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{let, input[:strings.Index(input, ";")]},
+		{let.Name, "add"},
+		{fl.Body, "{\n   a +\n      b\n}"},
+		{infix, "a +\n      b"},
+		{product, "add(1, [2, 3][0]) * -x"},
+		{call, "add(1, [2, 3][0])"},
+		{call.Arguments[1], "[2, 3][0]"},
+		{call.Arguments[1].(*ast.IndexExpression).Left, "[2, 3]"},
+		{product.Right, "-x"},
+		{ifExp, `if (x) { "s" } else { /r/i }`},
+		{ifExp.Consequence.Statements[0], `"s"`},
+		{ifExp.Alternative.Statements[0], "/r/i"},
+		{index.Left, `{"k": true}`},
+		{index, `{"k": true}["k"]`},
+		{program, input},
+	}
+
+	for i, tt := range tests {
+		if got := text(tt.node); got != tt.expected {
+			t.Errorf("tests[%d] - wrong span of %T. want=%q, got=%q", i, tt.node, tt.expected, got)
+		}
+	}
+
+	if pos := infix.(*ast.InfixExpression).Right.Pos(); pos.Line != 3 || pos.Char != 7 {
+		t.Errorf("wrong position of b. want=3:7, got=%d:%d", pos.Line, pos.Char)
+	}
+}
+
+// every program in these tests (and the examples) decodes to the same AST, evaluating the same
+func TestASTJSONRoundTrip(t *testing.T) {
+	inputs, err := corpus.StringLiterals("parser_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	examples, err := os.ReadFile("../examples/examples.mo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs = append(inputs, string(examples))
+
+	checked := 0
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 || len(program.Statements) == 0 {
+			continue // not a program, e.g. an expected value
+		}
+		checked += 1
+
+		data, err := ast.MarshalJSON(program)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		node, err := ast.UnmarshalJSON(data)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		decoded, ok := node.(*ast.Program)
+		if !ok {
+			t.Fatalf("%q: decoded %T, want *ast.Program", input, node)
+		}
+		if decoded.String() != program.String() || decoded.Pos() != program.Pos() || decoded.End() != program.End() {
+			t.Errorf("%q: wrong program decoded. got=%q", input, decoded.String())
+		}
+
+		if want, got := evaluate(program), evaluate(decoded); got != want {
+			t.Errorf("%q: decoded program evaluates differently. want=%s, got=%s", input, want, got)
+		}
+	}
+	if checked < 50 {
+		t.Errorf("only %d programs checked", checked)
+	}
+}
+
+func evaluate(program *ast.Program) string {
+	evaluator.NewResolver().Resolve(program)
+	if result := evaluator.New().Eval(program, object.NewEnvironment()); result != nil {
+		return result.Inspect()
+	}
+	return "<nil>"
+}
+
+func TestTracer(t *testing.T) {
+	var out strings.Builder
+	p := New(lexer.New("-a * b;"), WithTracer(&out))
+	p.ParseProgram()
+	checkParserErrors(t, p)
 
+	expected := `BEGIN ParseProgram token=- "-" @1:1
+   BEGIN parseStatement token=- "-" @1:1
+      BEGIN parseExpressionStatement token=- "-" @1:1
+         BEGIN parseExpression precedence=LOWEST token=- "-" @1:1
+            BEGIN parsePrefixExpression precedence=PREFIX token=- "-" @1:1
+               BEGIN parseExpression precedence=PREFIX token=IDENT "a" @1:2
+                  BEGIN parseIdentifier token=IDENT "a" @1:2
+                  END parseIdentifier token=IDENT "a" @1:2
+               END parseExpression precedence=PREFIX token=IDENT "a" @1:2
+            END parsePrefixExpression precedence=PREFIX token=IDENT "a" @1:2
+            BEGIN parseInfixExpression precedence=PRODUCT token=* "*" @1:4
+               BEGIN parseExpression precedence=PRODUCT token=IDENT "b" @1:6
+                  BEGIN parseIdentifier token=IDENT "b" @1:6
+                  END parseIdentifier token=IDENT "b" @1:6
+               END parseExpression precedence=PRODUCT token=IDENT "b" @1:6
+            END parseInfixExpression precedence=PRODUCT token=IDENT "b" @1:6
+         END parseExpression precedence=LOWEST token=IDENT "b" @1:6
+      END parseExpressionStatement token=SEMICOLON ";" @1:7
+   END parseStatement token=SEMICOLON ";" @1:7
+END ParseProgram token=EOF @1:8
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace. expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestTracerPerParser(t *testing.T) {
+	var traced strings.Builder
+	p := New(lexer.New("1 + 2"), WithTracer(&traced))
+	q := New(lexer.New("3 + 4"))
+	p.ParseProgram()
+	q.ParseProgram()
+
+	if strings.Contains(traced.String(), `"3"`) {
+		t.Errorf("untraced parser wrote events: %q", traced.String())
+	}
+	if !strings.HasPrefix(traced.String(), "BEGIN ParseProgram") || !strings.HasSuffix(traced.String(), "END ParseProgram token=EOF @1:6\n") {
+		t.Errorf("unbalanced trace: %q", traced.String())
+	}
+}
@@ -1,33 +1,78 @@
 package parser
 
 import (
-	"fmt"
-	"strings"
+   "fmt"
+   "io"
+   "strings"
+   "monkey/token"
 )
 
-var traceLevel int = 0
-
-const traceIdentPlaceholder string = "\t"
+/*
+ * Tracing: each parsing function writes a BEGIN event when called and an END event on return
+ *    ~ events are indented by nesting, one per line:
+ *      BEGIN parseExpression precedence=LOWEST token=INT "5" @1:9
+ *    ~ token: p.curToken when the event is written (the last token of the node for END)
+ *    ~ precedence: right-binding power of parseExpression and of the infix/prefix parsing
+ *      functions, omitted for the others
+ *    ~ tracing state belongs to the parser, parsers on other goroutines are not affected
+ */
+func WithTracer(w io.Writer) Option {
+   return func(p *Parser) {
+      p.tracer = w
+      p.traceLevel = 0
+   }
+}
 
-func identLevel() string {
-	return strings.Repeat(traceIdentPlaceholder, traceLevel - 1)
+var precedenceNames = map[int]string{
+   LOWEST:      "LOWEST",
+   EQUALS:      "EQUALS",
+   OR:          "OR",
+   AND:         "AND",
+   LESSGREATER: "LESSGREATER",
+   SUM:         "SUM",
+   PRODUCT:     "PRODUCT",
+   PREFIX:      "PREFIX",
+   CALL:        "CALL",
+   INDEX:       "INDEX",
 }
 
-func tracePrint(fs string) {
-	fmt.Printf("%s%s\n", identLevel(), fs)
+// a traced parsing function, returned by trace for untrace
+type traceEvent struct {
+   fn         string
+   precedence int // 0: none
 }
 
-func incIdent() { traceLevel = traceLevel + 1 }
-func decIdent() { traceLevel = traceLevel - 1 }
+// usage: defer p.untrace(p.trace("parseExpression", precedence))
+func (p *Parser) trace(fn string, precedence int) traceEvent {
+   ev := traceEvent{fn, precedence}
+   if p.tracer != nil {
+      p.tracePrint("BEGIN", ev)
+      p.traceLevel += 1
+   }
+   return ev
+}
 
-func trace(msg string) string {
-	incIdent()
-	tracePrint("BEGIN " + msg)
-	return msg
+func (p *Parser) untrace(ev traceEvent) {
+   if p.tracer != nil {
+      p.traceLevel -= 1
+      p.tracePrint("END", ev)
+   }
 }
 
-func untrace(msg string) {
-	tracePrint("END " + msg)
-	decIdent()
+func (p *Parser) tracePrint(kind string, ev traceEvent) {
+   var out strings.Builder
+   out.WriteString(strings.Repeat("   ", p.traceLevel) + kind + " " + ev.fn)
+   if name, ok := precedenceNames[ev.precedence]; ok {
+      out.WriteString(" precedence=" + name)
+   }
+   out.WriteString(" token=" + traceToken(p.curToken))
+   fmt.Fprintln(p.tracer, out.String())
 }
 
+// e.g. INT "5" @1:9
+func traceToken(tok token.Token) string {
+   if tok.Type == token.EOF {
+      return fmt.Sprintf("EOF @%d:%d", tok.Position.Line, tok.Position.Char)
+   }
+   return fmt.Sprintf("%s %q @%d:%d", tok.Type, tok.Literal, tok.Position.Line, tok.Position.Char)
+}
@@ -0,0 +1,136 @@
+package profile
+
+import (
+   "compress/gzip"
+   "io"
+)
+
+/*
+ * WritePprof: the profile in pprof format (gzipped profile.proto), for go tool pprof
+ *    ~ https://github.com/google/pprof/blob/main/proto/profile.proto
+ *    ~ sample types: evaluations/count and time/nanoseconds (the default)
+ *    ~ a location is a line of a function, locations have no addresses or mappings
+ */
+func (p *Profiler) WritePprof(w io.Writer) error {
+   var b protobuf
+   indexes := map[string]int64{"": 0}
+   table := []string{""}
+   str := func(s string) int64 {
+      if i, ok := indexes[s]; ok {
+         return i
+      }
+      indexes[s] = int64(len(table))
+      table = append(table, s)
+      return indexes[s]
+   }
+   valueType := func(typ, unit string) protobuf {
+      var vt protobuf
+      vt.int(1, str(typ))
+      vt.int(2, str(unit))
+      return vt
+   }
+
+   // sample_type
+   b.message(1, valueType("evaluations", "count"))
+   b.message(1, valueType("time", "nanoseconds"))
+   // sample: location_id, value
+   for _, s := range p.Samples() {
+      var sample protobuf
+      ids := make([]int64, len(s.Locations))
+      for i, id := range s.Locations {
+         ids[i] = int64(id)
+      }
+      sample.packed(1, ids)
+      sample.packed(2, []int64{s.Evaluations, s.Nanoseconds})
+      b.message(2, sample)
+   }
+   // location: id, line (function_id, line)
+   for i, loc := range p.locs {
+      var line, location protobuf
+      line.int(1, int64(loc.Function.ID))
+      line.int(2, int64(loc.Line))
+      location.int(1, int64(i + 1))
+      location.message(4, line)
+      b.message(4, location)
+   }
+   // function: id, name, system_name, filename, start_line
+   for _, fn := range p.sortedFunctions() {
+      var function protobuf
+      function.int(1, int64(fn.ID))
+      function.int(2, str(fn.Name))
+      function.int(3, str(fn.Name))
+      function.int(4, str(fn.Filename))
+      function.int(5, int64(fn.StartLine))
+      b.message(5, function)
+   }
+   // time_nanos, duration_nanos, period_type, period
+   b.int(9, p.start.UnixNano())
+   b.int(10, int64(p.duration))
+   b.message(11, valueType("evaluations", "count"))
+   b.int(12, 1)
+   // string_table, complete once all fields are written
+   for _, s := range table {
+      b.bytes(6, []byte(s))
+   }
+
+   gz := gzip.NewWriter(w)
+   if _, err := gz.Write(b); err != nil {
+      return err
+   }
+   return gz.Close()
+}
+
+// functions ordered by id
+func (p *Profiler) sortedFunctions() []*Function {
+   functions := make([]*Function, len(p.functions))
+   for _, fn := range p.functions {
+      functions[fn.ID - 1] = fn
+   }
+   return functions
+}
+
+/*
+ * protobuf: encoder for the wire format, enough for profile.proto
+ *    ~ int: varint field (wire type 0), bytes and message: length-delimited (wire type 2)
+ *    ~ packed: repeated varints in one length-delimited field
+ *    ~ zero ints are omitted, as proto3 does
+ */
+type protobuf []byte
+
+func (b *protobuf) varint(x uint64) {
+   for x >= 0x80 {
+      *b = append(*b, byte(x) | 0x80)
+      x >>= 7
+   }
+   *b = append(*b, byte(x))
+}
+
+func (b *protobuf) key(field int, wireType int) {
+   b.varint(uint64(field << 3 | wireType))
+}
+
+func (b *protobuf) int(field int, x int64) {
+   if x == 0 {
+      return
+   }
+   b.key(field, 0)
+   b.varint(uint64(x))
+}
+
+func (b *protobuf) bytes(field int, data []byte) {
+   b.key(field, 2)
+   b.varint(uint64(len(data)))
+   *b = append(*b, data...)
+}
+
+func (b *protobuf) message(field int, msg protobuf) {
+   b.bytes(field, msg)
+}
+
+func (b *protobuf) packed(field int, xs []int64) {
+   var data protobuf
+   for _, x := range xs {
+      data.varint(uint64(x))
+   }
+   b.bytes(field, data)
+}
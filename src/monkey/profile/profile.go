@@ -0,0 +1,278 @@
+package profile
+
+import (
+   "fmt"
+   "io"
+   "sort"
+   "strconv"
+   "time"
+   "monkey/ast"
+   "monkey/evaluator"
+   "monkey/object"
+)
+
+/*
+ * Profiler: evaluator hooks counting evaluations by Monkey function and source line
+ *    ~ each evaluated node is one evaluation of the line it starts on, in the function
+ *      being applied (main for the top level, go tool pprof drops names in <>)
+ *    ~ time is measured between consecutive events and attributed to the line evaluated
+ *      before, time spent in builtins to the builtin
+ *    ~ samples are call stacks: the line being evaluated, then the line of each pending call
+ *    ~ functions are named after their call, e.g. fib, or after their literal, e.g. fn@3,
+ *      builtins by their name
+ */
+type Profiler struct {
+   evaluator.BaseHooks
+   filename  string
+   functions map[functionKey]*Function
+   locations map[Location]int   // ids, 1-based
+   locs      []Location         // by id - 1
+   samples   map[string]*Sample // by stack, e.g. "3,1"
+   stack     []*frame
+   active    *Sample // time since last is attributed to it
+   last      time.Time
+   start     time.Time
+   duration  time.Duration
+}
+
+type Function struct {
+   ID        int
+   Name      string
+   Filename  string
+   StartLine int
+}
+
+type functionKey struct {
+   name string
+   line int // 0 for builtins
+}
+
+type Location struct {
+   Function *Function
+   Line     int
+}
+
+type Sample struct {
+   Locations   []int // ids, innermost first
+   Evaluations int64
+   Nanoseconds int64
+}
+
+type frame struct {
+   function *Function
+   line     int    // being evaluated
+   callers  string // stack of the calling frames
+}
+
+// profiler of a program read from filename (for source locations)
+func New(filename string) *Profiler {
+   p := &Profiler{
+      filename: filename,
+      functions: make(map[functionKey]*Function),
+      locations: make(map[Location]int),
+      samples: make(map[string]*Sample),
+   }
+   main := p.function("main", 1)
+   p.stack = []*frame{&frame{function: main, line: main.StartLine}}
+   p.start = time.Now()
+   p.last = p.start
+   return p
+}
+
+// ends profiling, attributing the time since the last event
+func (p *Profiler) Stop() {
+   now := time.Now()
+   if p.active != nil {
+      p.active.Nanoseconds += int64(now.Sub(p.last))
+   }
+   p.active, p.last = nil, now
+   p.duration = now.Sub(p.start)
+}
+
+func (p *Profiler) EnterNode(node ast.Node, env *object.Environment) {
+   f := p.stack[len(p.stack) - 1]
+   if line := node.Pos().Line; line > 0 {
+      f.line = line
+   }
+   s := p.sample()
+   s.Evaluations += 1
+   p.switchTo(s)
+}
+
+func (p *Profiler) Call(node *ast.CallExpression, fn object.Object, args []object.Object) {
+   var function *Function
+   switch fn := fn.(type) {
+      case *object.Builtin:
+         function = p.function(fn.Name, 0)
+      case *object.Function:
+         line := fn.Body.Pos().Line
+         name := "fn@" + strconv.Itoa(line)
+         if node != nil {
+            if id, ok := node.Function.(*ast.Identifier); ok {
+               name = id.Value
+            }
+         }
+         function = p.function(name, line)
+      default:
+         return // not a function, Return ignores it too
+   }
+   f := &frame{function: function, line: function.StartLine, callers: p.key(len(p.stack))}
+   p.stack = append(p.stack, f)
+   p.switchTo(p.sample())
+}
+
+func (p *Profiler) Return(node *ast.CallExpression, fn object.Object, result object.Object) {
+   switch fn.(type) {
+      case *object.Builtin, *object.Function:
+         p.stack = p.stack[:len(p.stack) - 1]
+         p.switchTo(p.sample())
+   }
+}
+
+func (p *Profiler) switchTo(s *Sample) {
+   now := time.Now()
+   if p.active != nil {
+      p.active.Nanoseconds += int64(now.Sub(p.last))
+   }
+   p.active, p.last = s, now
+}
+
+// sample of the current stack, created on first use
+func (p *Profiler) sample() *Sample {
+   key := p.key(len(p.stack))
+   if s, ok := p.samples[key]; ok {
+      return s
+   }
+   s := &Sample{}
+   for i := len(p.stack) - 1; i >= 0; i-- {
+      s.Locations = append(s.Locations, p.location(p.stack[i]))
+   }
+   p.samples[key] = s
+   return s
+}
+
+// stack of the innermost n frames, e.g. "3,1"
+func (p *Profiler) key(n int) string {
+   if n == 0 {
+      return ""
+   }
+   f := p.stack[n - 1]
+   id := strconv.Itoa(p.location(f))
+   if f.callers == "" {
+      return id
+   }
+   return id + "," + f.callers
+}
+
+func (p *Profiler) location(f *frame) int {
+   loc := Location{f.function, f.line}
+   if id, ok := p.locations[loc]; ok {
+      return id
+   }
+   p.locs = append(p.locs, loc)
+   p.locations[loc] = len(p.locs)
+   return len(p.locs)
+}
+
+func (p *Profiler) function(name string, line int) *Function {
+   key := functionKey{name, line}
+   if fn, ok := p.functions[key]; ok {
+      return fn
+   }
+   filename := p.filename
+   if line == 0 { // builtin
+      filename = ""
+   }
+   fn := &Function{ID: len(p.functions) + 1, Name: name, Filename: filename, StartLine: line}
+   p.functions[key] = fn
+   return fn
+}
+
+// samples sorted by their stacks, for stable output
+func (p *Profiler) Samples() []*Sample {
+   keys := make([]string, 0, len(p.samples))
+   for key := range p.samples {
+      keys = append(keys, key)
+   }
+   sort.Strings(keys)
+   samples := make([]*Sample, len(keys))
+   for i, key := range keys {
+      samples[i] = p.samples[key]
+   }
+   return samples
+}
+
+// location of an id
+func (p *Profiler) Location(id int) Location {
+   return p.locs[id - 1]
+}
+
+/*
+ * WriteTop: plain-text summary of the n functions with the most evaluations of their own
+ *    ~ flat: evaluations (and time) in the function itself, cum: including its calls
+ *    ~ recursive calls count once towards cum
+ */
+func (p *Profiler) WriteTop(w io.Writer, n int) {
+   type entry struct {
+      function          *Function
+      flat, cum         int64
+      flatTime, cumTime int64
+   }
+   entries := make(map[*Function]*entry)
+   var total, totalTime int64
+   for _, s := range p.Samples() {
+      total += s.Evaluations
+      totalTime += s.Nanoseconds
+      seen := make(map[*Function]bool)
+      for i, id := range s.Locations {
+         fn := p.Location(id).Function
+         e, ok := entries[fn]
+         if !ok {
+            e = &entry{function: fn}
+            entries[fn] = e
+         }
+         if i == 0 {
+            e.flat += s.Evaluations
+            e.flatTime += s.Nanoseconds
+         }
+         if !seen[fn] {
+            seen[fn] = true
+            e.cum += s.Evaluations
+            e.cumTime += s.Nanoseconds
+         }
+      }
+   }
+   sorted := make([]*entry, 0, len(entries))
+   for _, e := range entries {
+      sorted = append(sorted, e)
+   }
+   sort.Slice(sorted, func(i, j int) bool {
+      if sorted[i].flat != sorted[j].flat {
+         return sorted[i].flat > sorted[j].flat
+      }
+      return sorted[i].function.Name < sorted[j].function.Name
+   })
+   if n > 0 && len(sorted) > n {
+      sorted = sorted[:n]
+   }
+
+   fmt.Fprintf(w, "%d evaluations in %s\n", total, p.duration.Round(time.Microsecond))
+   fmt.Fprintf(w, "%12s %6s %12s %6s %10s %10s  %s\n", "flat", "flat%", "cum", "cum%", "flat time", "cum time", "function")
+   for _, e := range sorted {
+      where := "builtin"
+      if e.function.Filename != "" {
+         where = fmt.Sprintf("%s:%d", e.function.Filename, e.function.StartLine)
+      }
+      fmt.Fprintf(w, "%12d %5.1f%% %12d %5.1f%% %10s %10s  %s (%s)\n",
+         e.flat, percent(e.flat, total), e.cum, percent(e.cum, total),
+         time.Duration(e.flatTime).Round(time.Microsecond), time.Duration(e.cumTime).Round(time.Microsecond),
+         e.function.Name, where)
+   }
+}
+
+func percent(part, total int64) float64 {
+   if total == 0 {
+      return 0
+   }
+   return 100 * float64(part) / float64(total)
+}
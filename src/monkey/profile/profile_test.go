@@ -0,0 +1,198 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+const fibProgram = `let fib = fn(n) {
+   if (n < 2) { return n; }
+   fib(n - 1) + fib(n - 2)
+};
+let double = fn(x) { x * 2 };
+map([fib(5)], double);
+len("abc")`
+
+func profileProgram(t *testing.T, input string) *Profiler {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	resolver := evaluator.NewResolver()
+	resolver.Resolve(program)
+	if len(resolver.Errors()) != 0 {
+		t.Fatalf("resolver errors: %v", resolver.Errors())
+	}
+	p := New("fib.mk")
+	result := evaluator.New(evaluator.WithHooks(p)).Eval(program, object.NewEnvironment())
+	if result.Type() == object.ERROR_OBJ {
+		t.Fatalf("evaluation failed: %s", result.Inspect())
+	}
+	p.Stop()
+	return p
+}
+
+// evaluations by function and line, of the innermost location of each sample
+func flatCounts(p *Profiler) map[string]int64 {
+	counts := make(map[string]int64)
+	for _, s := range p.Samples() {
+		loc := p.Location(s.Locations[0])
+		counts[loc.Function.Name] += s.Evaluations
+	}
+	return counts
+}
+
+func TestFunctions(t *testing.T) {
+	p := profileProgram(t, fibProgram)
+
+	functions := make(map[string]*Function)
+	for _, fn := range p.sortedFunctions() {
+		functions[fn.Name] = fn
+	}
+	tests := []struct {
+		name      string
+		filename  string
+		startLine int
+	}{
+		{"main", "fib.mk", 1},
+		{"fib", "fib.mk", 1},
+		{"map", "", 0},
+		{"fn@5", "fib.mk", 5}, // double, called by map without a call site
+		{"len", "", 0},
+	}
+	for _, tt := range tests {
+		fn, ok := functions[tt.name]
+		if !ok {
+			t.Errorf("no function %s, got=%v", tt.name, functions)
+			continue
+		}
+		if fn.Filename != tt.filename || fn.StartLine != tt.startLine {
+			t.Errorf("wrong location of %s. got=%s:%d, want=%s:%d",
+				tt.name, fn.Filename, fn.StartLine, tt.filename, tt.startLine)
+		}
+	}
+	if len(functions) != len(tests) {
+		t.Errorf("wrong number of functions. got=%d, want=%d", len(functions), len(tests))
+	}
+}
+
+func TestEvaluations(t *testing.T) {
+	p := profileProgram(t, fibProgram)
+	counts := flatCounts(p)
+
+	// fib(5) makes 15 calls, doubling one of them evaluates the same body once more
+	fibCalls, fibAgain := profileProgram(t, `let fib = fn(n) {
+   if (n < 2) { return n; }
+   fib(n - 1) + fib(n - 2)
+};
+fib(5); fib(5)`), counts["fib"]
+	if twice := flatCounts(fibCalls)["fib"]; twice != 2*fibAgain {
+		t.Errorf("evaluations of fib not proportional to calls. got=%d, want=%d", twice, 2*fibAgain)
+	}
+	if counts["fn@5"] == 0 || counts["main"] == 0 {
+		t.Errorf("missing evaluations. got=%v", counts)
+	}
+	if counts["map"] != 0 || counts["len"] != 0 {
+		t.Errorf("builtins evaluate no Monkey code. got=%v", counts)
+	}
+
+	var total int64
+	for _, s := range p.Samples() {
+		total += s.Evaluations
+		if last := p.Location(s.Locations[len(s.Locations)-1]); last.Function.Name != "main" {
+			t.Errorf("sample not rooted in main. got=%s", last.Function.Name)
+		}
+	}
+	var sum int64
+	for _, n := range counts {
+		sum += n
+	}
+	if sum != total {
+		t.Errorf("wrong total. got=%d, want=%d", sum, total)
+	}
+}
+
+func TestStacks(t *testing.T) {
+	p := profileProgram(t, fibProgram)
+
+	// double, named after its literal, is called by map, called on line 6 of main
+	found := false
+	for _, s := range p.Samples() {
+		var names []string
+		for _, id := range s.Locations {
+			loc := p.Location(id)
+			names = append(names, loc.Function.Name)
+		}
+		if names[0] != "fn@5" {
+			continue
+		}
+		found = true
+		if got := strings.Join(names, " "); got != "fn@5 map main" {
+			t.Errorf("wrong stack. got=%q, want=%q", got, "fn@5 map main")
+		}
+		if line := p.Location(s.Locations[2]).Line; line != 6 {
+			t.Errorf("wrong line of the call. got=%d, want=6", line)
+		}
+	}
+	if !found {
+		t.Errorf("no samples in double")
+	}
+}
+
+func TestWriteTop(t *testing.T) {
+	p := profileProgram(t, fibProgram)
+	var out bytes.Buffer
+	p.WriteTop(&out, 3)
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("wrong number of lines. got=%d, want=5\n%s", len(lines), out.String())
+	}
+	if !strings.HasSuffix(lines[0], "evaluations in "+p.duration.Round(1000).String()) {
+		t.Errorf("wrong header. got=%q", lines[0])
+	}
+	if !strings.HasSuffix(lines[2], "fib (fib.mk:1)") {
+		t.Errorf("fib is not on top. got=%q", lines[2])
+	}
+	if !strings.Contains(lines[3], "main (fib.mk:1)") {
+		t.Errorf("main is not second. got=%q", lines[3])
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	p := profileProgram(t, fibProgram)
+	var out bytes.Buffer
+	if err := p.WritePprof(&out); err != nil {
+		t.Fatalf("WritePprof failed: %s", err)
+	}
+	r, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("not gzipped: %s", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("not gzipped: %s", err)
+	}
+	// the string table is the last field, one entry per distinct string
+	for _, s := range []string{"evaluations", "count", "time", "nanoseconds", "main", "fib", "fn@5", "map", "len", "fib.mk"} {
+		if bytes.Count(data, []byte{0x32, byte(len(s))}) == 0 || !bytes.Contains(data, []byte(s)) {
+			t.Errorf("string %q missing in the profile", s)
+		}
+	}
+}
+
+func TestProtobuf(t *testing.T) {
+	var b protobuf
+	b.int(1, 150)
+	b.int(2, 0)
+	b.bytes(2, []byte("testing"))
+	b.packed(4, []int64{3, 270})
+	expected := []byte{0x08, 0x96, 0x01, 0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g', 0x22, 0x03, 0x03, 0x8e, 0x02}
+	if !bytes.Equal(b, expected) {
+		t.Errorf("wrong encoding. got=% x, want=% x", []byte(b), expected)
+	}
+}
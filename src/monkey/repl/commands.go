@@ -0,0 +1,189 @@
+package repl
+
+import (
+   "fmt"
+   "os"
+   "sort"
+   "strings"
+   "time"
+   "monkey/object"
+)
+
+/*
+ * Meta-commands: ":name argument" lines, handled by the REPL instead of being evaluated
+ *    ~ :tokens, :ast and :trace switch debug views on and off (toggle without argument)
+ *    ~ :load evaluates a file in the session, :save writes the inputs evaluated since the last :reset
+ */
+type command struct {
+   usage string
+   help  string
+   run   func(s *session, arg string)
+}
+
+var commands = map[string]*command{
+   "tokens": &command{
+      usage: ":tokens [on|off]",
+      help: "print the tokens of each input",
+      run: func(s *session, arg string) {
+         s.toggle("tokens", arg, &s.showTokens)
+      },
+   },
+   "ast": &command{
+      usage: ":ast [on|off]",
+      help: "print the AST of each input",
+      run: func(s *session, arg string) {
+         s.toggle("ast", arg, &s.showAST)
+      },
+   },
+   "trace": &command{
+      usage: ":trace [on|off]",
+      help: "print function calls and their results",
+      run: func(s *session, arg string) {
+         if s.toggle("trace", arg, &s.trace) {
+            if s.trace {
+               s.interpreter.SetTracer(s.out)
+            } else {
+               s.interpreter.SetTracer(nil)
+            }
+         }
+      },
+   },
+   "env": &command{
+      usage: ":env",
+      help: "list the bindings of the session",
+      run: func(s *session, arg string) {
+         names := s.env.Names()
+         sort.Strings(names)
+         for _, name := range names {
+            value, _ := s.env.Lookup(name)
+            fmt.Fprintf(s.out, "%s = %s\n", name, value.Inspect())
+         }
+      },
+   },
+   "load": &command{
+      usage: ":load <file>",
+      help: "evaluate a file in the session",
+      run: func(s *session, arg string) {
+         if arg == "" {
+            fmt.Fprintf(s.out, "usage: :load <file>\n")
+            return
+         }
+         data, err := os.ReadFile(arg)
+         if err != nil {
+            fmt.Fprintf(s.out, "load: %s\n", err)
+            return
+         }
+         s.eval(string(data))
+      },
+   },
+   "save": &command{
+      usage: ":save <file>",
+      help: "write the inputs evaluated since the last :reset to a file",
+      run: func(s *session, arg string) {
+         if arg == "" {
+            fmt.Fprintf(s.out, "usage: :save <file>\n")
+            return
+         }
+         var source strings.Builder
+         for _, input := range s.log {
+            source.WriteString(input + "\n")
+         }
+         if err := os.WriteFile(arg, []byte(source.String()), 0644); err != nil {
+            fmt.Fprintf(s.out, "save: %s\n", err)
+            return
+         }
+         fmt.Fprintf(s.out, "saved %d inputs to %s\n", len(s.log), arg)
+      },
+   },
+   "reset": &command{
+      usage: ":reset",
+      help: "forget all bindings",
+      run: func(s *session, arg string) {
+         s.reset()
+         fmt.Fprintf(s.out, "session reset\n")
+      },
+   },
+   "type": &command{
+      usage: ":type <expr>",
+      help: "evaluate an expression and print the type of its value",
+      run: func(s *session, arg string) {
+         eval, ok := s.run(arg)
+         if !ok || eval == nil {
+            return
+         }
+         if eval.Type() == object.ERROR_OBJ {
+            fmt.Fprintf(s.out, "%s\n", eval.Inspect())
+            return
+         }
+         fmt.Fprintf(s.out, "%s\n", eval.Type())
+      },
+   },
+   "time": &command{
+      usage: ":time <expr>",
+      help: "evaluate an expression and print how long it took",
+      run: func(s *session, arg string) {
+         start := time.Now()
+         eval, ok := s.run(arg)
+         elapsed := time.Since(start)
+         if !ok {
+            return
+         }
+         if eval != nil {
+            fmt.Fprintf(s.out, "%s\n", eval.Inspect())
+         }
+         fmt.Fprintf(s.out, "time: %s\n", elapsed)
+      },
+   },
+}
+
+func init() {
+   commands["help"] = &command{ // refers to commands
+      usage: ":help",
+      help: "list the commands",
+      run: func(s *session, arg string) {
+         names := make([]string, 0, len(commands))
+         for name := range commands {
+            names = append(names, name)
+         }
+         sort.Strings(names)
+         for _, name := range names {
+            fmt.Fprintf(s.out, "%-18s %s\n", commands[name].usage, commands[name].help)
+         }
+      },
+   }
+}
+
+func isCommand(input string) bool {
+   return strings.HasPrefix(strings.TrimSpace(input), ":")
+}
+
+func (s *session) command(input string) {
+   name, arg, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(input), ":"), " ")
+   cmd, ok := commands[name]
+   if !ok {
+      fmt.Fprintf(s.out, "unknown command :%s, try :help\n", name)
+      return
+   }
+   cmd.run(s, strings.TrimSpace(arg))
+}
+
+// sets or toggles a debug view, false on a bad argument
+func (s *session) toggle(name, arg string, view *bool) bool {
+   switch arg {
+      case "":
+         *view = !*view
+      case "on":
+         *view = true
+      case "off":
+         *view = false
+      default:
+         fmt.Fprintf(s.out, "usage: :%s [on|off]\n", name)
+         return false
+   }
+   if *view {
+      fmt.Fprintf(s.out, "%s: on\n", name)
+   } else {
+      fmt.Fprintf(s.out, "%s: off\n", name)
+   }
+   return true
+}
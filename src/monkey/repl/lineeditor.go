@@ -0,0 +1,279 @@
+package repl
+
+import (
+   "bufio"
+   "errors"
+   "fmt"
+   "io"
+   "os"
+   "strings"
+   "unicode"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// source of input lines, io.EOF at the end of input, errInterrupted when the user cancels a line (Ctrl-C)
+type lineReader interface {
+   readLine(prompt string) (string, error)
+}
+
+// lines of a file or pipe, no editing
+type plainReader struct {
+   in  *bufio.Reader
+   out io.Writer
+}
+
+func (r *plainReader) readLine(prompt string) (string, error) {
+   io.WriteString(r.out, prompt)
+   line, err := r.in.ReadString('\n')
+   if err != nil && (err != io.EOF || line == "") {
+      return "", err
+   }
+   return strings.TrimRight(line, "\r\n"), nil
+}
+
+/*
+ * lineEditor: interactive line editing on a raw-mode terminal
+ *    ~ Left/Right, Home/End (Ctrl-A/Ctrl-E), Backspace, Delete, Ctrl-K, Ctrl-U and Ctrl-W edit the line
+ *    ~ Up/Down walk through the history, Tab completes the word before the cursor
+ *    ~ Ctrl-C cancels the line, Ctrl-D on an empty line ends the input
+ *    ~ every character is assumed to be one column wide
+ */
+type lineEditor struct {
+   rawMode  func() (restore func(), err error) // nil: input is already raw
+   in       *bufio.Reader
+   out      io.Writer
+   history  *history
+   complete func(prefix string) []string // candidates starting with prefix
+}
+
+func (e *lineEditor) readLine(prompt string) (string, error) {
+   if e.rawMode != nil {
+      restore, err := e.rawMode()
+      if err != nil {
+         return "", err
+      }
+      defer restore()
+   }
+
+   var buf []rune
+   pos := 0
+   index, draft := len(e.history.entries), "" // history entry being edited, draft is the new line
+   for {
+      e.refresh(prompt, buf, pos)
+      r, _, err := e.in.ReadRune()
+      if err != nil {
+         return "", err
+      }
+      switch r {
+         case '\r', '\n':
+            io.WriteString(e.out, "\r\n")
+            line := string(buf)
+            e.history.add(line)
+            return line, nil
+         case ctrl('C'):
+            io.WriteString(e.out, "^C\r\n")
+            return "", errInterrupted
+         case ctrl('D'):
+            if len(buf) == 0 {
+               io.WriteString(e.out, "\r\n")
+               return "", io.EOF
+            }
+            buf, pos = deleteRunes(buf, pos, pos + 1)
+         case 127, ctrl('H'): // backspace
+            buf, pos = deleteRunes(buf, pos - 1, pos)
+         case ctrl('A'):
+            pos = 0
+         case ctrl('E'):
+            pos = len(buf)
+         case ctrl('B'):
+            pos = max(pos - 1, 0)
+         case ctrl('F'):
+            pos = min(pos + 1, len(buf))
+         case ctrl('K'):
+            buf = buf[:pos]
+         case ctrl('U'):
+            buf, pos = deleteRunes(buf, 0, pos)
+         case ctrl('W'): // back to the previous whitespace
+            start := pos
+            for start > 0 && unicode.IsSpace(buf[start - 1]) {
+               start -= 1
+            }
+            for start > 0 && !unicode.IsSpace(buf[start - 1]) {
+               start -= 1
+            }
+            buf, pos = deleteRunes(buf, start, pos)
+         case '\t':
+            buf, pos = e.completeWord(buf, pos)
+         case 27: // escape sequence
+            switch e.readEscape() {
+               case "[D", "OD":
+                  pos = max(pos - 1, 0)
+               case "[C", "OC":
+                  pos = min(pos + 1, len(buf))
+               case "[H", "OH", "[1~":
+                  pos = 0
+               case "[F", "OF", "[4~":
+                  pos = len(buf)
+               case "[3~":
+                  buf, pos = deleteRunes(buf, pos, pos + 1)
+               case "[A", "OA":
+                  if index > 0 {
+                     if index == len(e.history.entries) {
+                        draft = string(buf)
+                     }
+                     index -= 1
+                     buf = []rune(e.history.entries[index])
+                     pos = len(buf)
+                  }
+               case "[B", "OB":
+                  if index < len(e.history.entries) {
+                     index += 1
+                     if index == len(e.history.entries) {
+                        buf = []rune(draft)
+                     } else {
+                        buf = []rune(e.history.entries[index])
+                     }
+                     pos = len(buf)
+                  }
+            }
+         default:
+            if unicode.IsPrint(r) {
+               buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+               pos += 1
+            }
+      }
+   }
+}
+
+func ctrl(ch rune) rune {
+   return ch & 0x1f
+}
+
+// the rest of an escape sequence (after ESC), e.g. "[A" for the Up key
+func (e *lineEditor) readEscape() string {
+   first, _, err := e.in.ReadRune()
+   if err != nil || (first != '[' && first != 'O') {
+      return ""
+   }
+   seq := []rune{first}
+   for {
+      r, _, err := e.in.ReadRune()
+      if err != nil {
+         return ""
+      }
+      seq = append(seq, r)
+      if r >= 0x40 && r <= 0x7e { // final byte
+         return string(seq)
+      }
+   }
+}
+
+// redraw prompt and line, then move the cursor back to pos
+func (e *lineEditor) refresh(prompt string, buf []rune, pos int) {
+   fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+   if back := len(buf) - pos; back > 0 {
+      fmt.Fprintf(e.out, "\x1b[%dD", back)
+   }
+}
+
+// extends the word before the cursor by the common prefix of its completions, lists them if ambiguous
+func (e *lineEditor) completeWord(buf []rune, pos int) ([]rune, int) {
+   start := wordStart(buf, pos)
+   prefix := string(buf[start:pos])
+   if prefix == "" || e.complete == nil {
+      return buf, pos
+   }
+   candidates := e.complete(prefix)
+   if len(candidates) == 0 {
+      io.WriteString(e.out, "\a")
+      return buf, pos
+   }
+   common := candidates[0]
+   for _, candidate := range candidates[1:] {
+      for !strings.HasPrefix(candidate, common) {
+         common = common[:len(common) - 1]
+      }
+   }
+   if len(common) > len(prefix) {
+      insert := []rune(common[len(prefix):])
+      buf = append(buf[:pos], append(insert, buf[pos:]...)...)
+      return buf, pos + len(insert)
+   }
+   if len(candidates) > 1 {
+      fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+   }
+   return buf, pos
+}
+
+func isWordChar(r rune) bool {
+   return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func wordStart(buf []rune, pos int) int {
+   for pos > 0 && isWordChar(buf[pos - 1]) {
+      pos -= 1
+   }
+   return pos
+}
+
+// buf without buf[from:to] (bounds clamped) and the new cursor position
+func deleteRunes(buf []rune, from, to int) ([]rune, int) {
+   from, to = max(from, 0), min(to, len(buf))
+   if from >= to {
+      return buf, max(from, 0)
+   }
+   return append(buf[:from], buf[to:]...), from
+}
+
+/*
+ * history: previously entered lines, oldest first
+ *    ~ persisted by appending to a file, one line per entry
+ *    ~ blank lines and repetitions of the last entry are not recorded
+ */
+const maxHistory = 1000
+
+type history struct {
+   entries []string
+   path    string // "": not persisted
+}
+
+func loadHistory(path string) *history {
+   h := &history{entries: []string{}, path: path}
+   if path == "" {
+      return h
+   }
+   data, err := os.ReadFile(path)
+   if err != nil {
+      return h
+   }
+   for _, line := range strings.Split(string(data), "\n") {
+      if line != "" {
+         h.entries = append(h.entries, line)
+      }
+   }
+   if len(h.entries) > maxHistory { // compact the file
+      h.entries = h.entries[len(h.entries) - maxHistory:]
+      os.WriteFile(path, []byte(strings.Join(h.entries, "\n") + "\n"), 0600)
+   }
+   return h
+}
+
+func (h *history) add(line string) {
+   if strings.TrimSpace(line) == "" || (len(h.entries) > 0 && h.entries[len(h.entries) - 1] == line) {
+      return
+   }
+   h.entries = append(h.entries, line)
+   if len(h.entries) > maxHistory {
+      h.entries = h.entries[1:]
+   }
+   if h.path == "" {
+      return
+   }
+   f, err := os.OpenFile(h.path, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0600)
+   if err != nil {
+      return
+   }
+   defer f.Close()
+   io.WriteString(f, line + "\n")
+}
@@ -4,6 +4,9 @@ import (
    "bufio"
    "fmt"
    "io"
+   "os"
+   "sort"
+   "strings"
    "monkey/lexer"
    "monkey/token"
    "monkey/ast"
@@ -26,60 +29,272 @@ const MONKEY_FACE = `            __,__
 `
 
 const PROMPT = "> "
+const CONTINUATION_PROMPT = ".. "
 
-func Start(in io.Reader, out io.Writer) {
-   scanner := bufio.NewScanner(in)
-   env := object.NewEnvironment()
+type Option func(c *config)
+
+type config struct {
+   historyFile string
+}
+
+// persist the input history in a file (interactive sessions only)
+func WithHistoryFile(path string) Option {
+   return func(c *config) {
+      c.historyFile = path
+   }
+}
+
+/*
+ * Start: read-eval-print loop
+ *    ~ incomplete input (open brackets or string, or a parser error at EOF) continues
+ *      on the next line, an empty line evaluates it anyway
+ *    ~ lines starting with ':' are meta-commands (see commands.go)
+ *    ~ a terminal gets line editing, history and tab completion (see lineeditor.go)
+ */
+func Start(in io.Reader, out io.Writer, options ...Option) {
+   var c config
+   for _, option := range options {
+      option(&c)
+   }
+   s := newSession(out)
+   defer s.close()
+   reader := newLineReader(in, out, c, func(prefix string) []string {
+      return completions(prefix, s.interpreter, s.env)
+   })
 
    for {
-      fmt.Printf(PROMPT)
-      scanned := scanner.Scan()
-      if !scanned {
+      input, err := readInput(reader)
+      if err != nil {
          return
       }
+      if isCommand(input) {
+         s.command(input)
+      } else if strings.TrimSpace(input) != "" {
+         s.eval(input)
+      }
+   }
+}
 
+// evaluation state and debug views of a REPL
+type session struct {
+   out         io.Writer
+   env         *object.Environment
+   resolver    *evaluator.Resolver
+   interpreter *evaluator.Interpreter
+   fsys        evaluator.FileSystem // nil if the working directory cannot be opened
+   showTokens  bool
+   showAST     bool
+   trace       bool
+   log         []string // inputs evaluated since the last reset, see :save
+}
 
-      line := scanner.Text()
-      l := lexer.New(line)
-      p := parser.New(l)
+func newSession(out io.Writer) *session {
+   s := &session{out: out}
+   s.reset()
+   return s
+}
 
-      printTokens(line)
+// forget all bindings, keep the debug views
+func (s *session) reset() {
+   s.close()
+   s.env = object.NewEnvironment()
+   s.resolver = evaluator.NewResolver()
+   options := []evaluator.Option{evaluator.WithOutput(s.out)}
+   if fsys, err := evaluator.DirFS("."); err == nil { // scripts see the working directory
+      s.fsys = fsys
+      options = append(options, evaluator.WithFileSystem(fsys))
+   }
+   if s.trace {
+      options = append(options, evaluator.WithTracer(s.out))
+   }
+   s.interpreter = evaluator.New(options...)
+   s.log = nil
+}
 
-      prog := p.ParseProgram()
-      if len(p.Errors()) != 0 {
-         printParserErrors(out, p.Errors())
+// releases the file system of the interpreter
+func (s *session) close() {
+   if s.fsys != nil {
+      s.fsys.Close()
+      s.fsys = nil
+   }
+}
+
+// parse, resolve and evaluate input, false if it has errors (reported to out), see eval for logging
+func (s *session) run(input string) (object.Object, bool) {
+   if s.showTokens {
+      printTokens(input, s.out)
+   }
+
+   l := lexer.New(input)
+   p := parser.New(l)
+   prog := p.ParseProgram()
+   if len(p.Diagnostics()) != 0 {
+      printParserErrors(s.out, input, p.Diagnostics())
+      return nil, false
+   }
+
+   if s.showAST {
+      printAST(prog, s.out)
+   }
+
+   s.resolver.Resolve(prog)
+   if len(s.resolver.Errors()) != 0 {
+      printErrors(s.out, "resolver", s.resolver.Errors())
+      return nil, false
+   }
+
+   return s.interpreter.Eval(prog, s.env), true
+}
+
+// run input and print its value, logging it for :save
+func (s *session) eval(input string) {
+   eval, ok := s.run(input)
+   if ok {
+      s.log = append(s.log, input)
+   }
+   if ok && eval != nil {
+      io.WriteString(s.out, eval.Inspect())
+      io.WriteString(s.out, "\n")
+   }
+}
+
+func newLineReader(in io.Reader, out io.Writer, c config, complete func(string) []string) lineReader {
+   if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+      return &lineEditor{
+         rawMode: func() (func(), error) { return enableRawMode(int(f.Fd())) },
+         in: bufio.NewReader(f),
+         out: out,
+         history: loadHistory(c.historyFile),
+         complete: complete,
+      }
+   }
+   return &plainReader{in: bufio.NewReader(in), out: out}
+}
+
+// lines up to a complete input, Ctrl-C discards the lines read so far
+func readInput(reader lineReader) (string, error) {
+   var lines []string
+   prompt := PROMPT
+   for {
+      line, err := reader.readLine(prompt)
+      if err == errInterrupted {
+         lines, prompt = nil, PROMPT
          continue
       }
+      if len(lines) == 0 && err == nil && isCommand(line) { // commands are single lines
+         return line, nil
+      }
+      if err != nil {
+         if len(lines) > 0 { // evaluate what we have
+            return strings.Join(lines, "\n"), nil
+         }
+         return "", err
+      }
+      lines = append(lines, line)
+      input := strings.Join(lines, "\n")
+      if (line == "" && len(lines) > 1) || !isIncomplete(input) {
+         return input, nil
+      }
+      prompt = CONTINUATION_PROMPT
+   }
+}
 
-      printAST(prog, out)
+func isIncomplete(input string) bool {
+   depth := 0
+   l := lexer.New(input)
+   for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+      switch tok.Type {
+         case token.LPAREN, token.LBRACKET, token.LBRACE:
+            depth += 1
+         case token.RPAREN, token.RBRACKET, token.RBRACE:
+            depth -= 1
+      }
+   }
+   for _, err := range l.Errors() {
+      if err.Kind == lexer.UnterminatedString && err.End.Offset == len(input) { // open string
+         return true
+      }
+   }
+   if depth != 0 {
+      return depth > 0
+   }
+   p := parser.New(lexer.New(input))
+   p.ParseProgram()
+   for _, err := range p.Diagnostics() {
+      if err.Got == token.EOF { // e.g. "let x =", "if (x)"
+         return true
+      }
+   }
+   return false
+}
 
-      eval := evaluator.Eval(prog, env)
-      if eval != nil {
-         io.WriteString(out, eval.Inspect())
-         io.WriteString(out, "\n")
+// keywords, builtins and bound names starting with prefix, sorted
+func completions(prefix string, interpreter *evaluator.Interpreter, env *object.Environment) []string {
+   seen := make(map[string]bool)
+   candidates := []string{}
+   for _, names := range [][]string{token.Keywords(), interpreter.BuiltinNames(), env.Names()} {
+      for _, name := range names {
+         if strings.HasPrefix(name, prefix) && !seen[name] {
+            seen[name] = true
+            candidates = append(candidates, name)
+         }
       }
    }
+   sort.Strings(candidates)
+   return candidates
 }
 
-func printTokens(line string) {
+func printTokens(line string, out io.Writer) {
    l := lexer.New(line)
    for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-      fmt.Printf("%s\n", tok)
+      fmt.Fprintf(out, "%s\n", tok)
    }
 }
 
 func printAST(prog *ast.Program, out io.Writer) {
-   io.WriteString(out, prog.String())
-   io.WriteString(out, "\n")
+   io.WriteString(out, ast.Tree(prog))
 }
 
-func printParserErrors(out io.Writer, errors []string) {
+func printErrors(out io.Writer, stage string, errors []string) {
    io.WriteString(out, MONKEY_FACE)
    io.WriteString(out, "Whoops! We ran into some monkey business here!\n")
-   io.WriteString(out, "parser errors:\n")
+   io.WriteString(out, stage + " errors:\n")
    for _, msg := range errors {
       io.WriteString(out, "\t" + msg + "\n")
    }
 }
 
-
+/*
+ * Parser errors: each message is followed by its source line and a caret under the offending token,
+ *
+ *    1:9: expected an expression, got ";"
+ *        let x = ;
+ *                ^
+ */
+func printParserErrors(out io.Writer, input string, errors []*parser.Error) {
+   io.WriteString(out, MONKEY_FACE)
+   io.WriteString(out, "Whoops! We ran into some monkey business here!\n")
+   io.WriteString(out, "parser errors:\n")
+   lines := strings.Split(input, "\n")
+   for _, err := range errors {
+      io.WriteString(out, "\t" + err.Error() + "\n")
+      if err.Pos.Line < 1 || err.Pos.Line > len(lines) {
+         continue
+      }
+      line := lines[err.Pos.Line - 1]
+      col := min(max(err.Pos.Char - 1, 0), len(line))
+      end := err.End.Char
+      if err.End.Line != err.Pos.Line { // e.g. an unterminated string, underlined to the end of its first line
+         end = len(line) + 1
+      }
+      width := max(min(end, len(line) + 1) - err.Pos.Char, 1)
+      indent := strings.Map(func(r rune) rune { // tabs keep the caret aligned
+         if r == '\t' {
+            return r
+         }
+         return ' '
+      }, line[:col])
+      io.WriteString(out, "\t    " + line + "\n")
+      io.WriteString(out, "\t    " + indent + "^" + strings.Repeat("~", width - 1) + "\n")
+   }
+}
@@ -0,0 +1,174 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input      string
+		incomplete bool
+	}{
+		{"let x = 1;", false},
+		{"let f = fn(x) {", true},
+		{"let f = fn(x) {\n  x\n}", false},
+		{"[1, 2,", true},
+		{"let s = \"abc", true},
+		{"let s = \"a\nb\"", false},
+		{"let s = /\"/;", false},
+		{"a; // say \"hi", false},
+		{"let s = \"// not a comment", true},
+		{"let x =", true},
+		{"if (x)", true},
+		{"let = 1", false},
+		{"1 + )", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIncomplete(tt.input); got != tt.incomplete {
+			t.Errorf("isIncomplete(%q) wrong. want=%t, got=%t", tt.input, tt.incomplete, got)
+		}
+	}
+}
+
+func TestStartMultiLineInput(t *testing.T) {
+	input := "let add = fn(x, y) {\n  x + y\n};\nadd(1,\n2)\nlet x = [1,\n\n"
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if !strings.Contains(out.String(), CONTINUATION_PROMPT + "3\n") {
+		t.Errorf("multi-line function not evaluated. got=%q", out.String())
+	}
+	if !strings.HasPrefix(out.String(), PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + PROMPT + CONTINUATION_PROMPT + "3") {
+		t.Errorf("wrong number of continuation prompts. got=%q", out.String())
+	}
+	if !strings.Contains(out.String(), "parser errors:") {
+		t.Errorf("empty line did not end incomplete input. got=%q", out.String())
+	}
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "lib.mo"), []byte("let double = fn(x) { x * 2 };"), 0644)
+	session := filepath.Join(dir, "session.mo")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":load " + filepath.Join(dir, "lib.mo"), ""},
+		{"let x = double(2);", ""},
+		{"puts(x)", "4\nnull\n"},
+		{":env", "double = fn(x) { (x * 2) }\nx = 4\n"},
+		{":type x", "INTEGER\n"},
+		{":type y", "resolver errors:"},
+		{":tokens", "tokens: on\n"},
+		{"x", "token{type: IDENT, literal: \"x\"}\n4\n"},
+		{":tokens off", "tokens: off\n"},
+		{":ast on", "ast: on\n"},
+		{"1 + x", "Program @1:1\n`-- statement: ExpressionStatement @1:1\n    `-- expression: InfixExpression + @1:1\n" +
+			"        |-- left: IntegerLiteral 1 @1:1\n        `-- right: Identifier x @1:5\n5\n"},
+		{":ast", "ast: off\n"},
+		{":trace", "trace: on\n"},
+		{"double(x)", "call double(4) @1:1\nreturn 8\n8\n"},
+		{":trace maybe", "usage: :trace [on|off]\n"},
+		{":trace off", "trace: off\n"},
+		{":time double(1)", "2\ntime: "},
+		{":save " + session, "saved 6 inputs to " + session}, // not :type or :time
+		{":reset", "session reset\n"},
+		{":env", ""},
+		{":load " + session, "4\n8\n"},
+		{"x", "4\n"},
+		{":load", "usage: :load <file>\n"},
+		{":load missing.mo", "load: open missing.mo: no such file or directory\n"},
+		{":frobnicate", "unknown command :frobnicate, try :help\n"},
+		{":help", ":type <expr>       evaluate an expression and print the type of its value\n"},
+	}
+
+	var out bytes.Buffer
+	s := newSession(&out)
+	for _, tt := range tests {
+		out.Reset()
+		if isCommand(tt.input) {
+			s.command(tt.input)
+		} else {
+			s.eval(tt.input)
+		}
+		if !strings.Contains(out.String(), tt.expected) || (tt.expected == "" && out.Len() != 0) {
+			t.Errorf("wrong output for %s. want=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	os.WriteFile(path, []byte("first\nsecond\n"), 0600)
+	keys := strings.Join([]string{
+		"ac\x1b[Db\r",              // insert before the cursor
+		"\x1b[A\x1b[A\x1b[A\x1b[B\r", // Up stops at the oldest entry
+		"pu\t(1)\r",                // unique completion
+		"x\x7fyz\x01\x0b\x03",      // backspace, Ctrl-A, Ctrl-K, Ctrl-C
+		"one two\x17three\r",       // Ctrl-W
+		"p\t\r",                    // ambiguous completion lists candidates
+	}, "")
+	var out bytes.Buffer
+	e := &lineEditor{
+		in: bufio.NewReader(strings.NewReader(keys)),
+		out: &out,
+		history: loadHistory(path),
+		complete: func(prefix string) []string {
+			var candidates []string
+			for _, name := range []string{"print", "push", "puts"} {
+				if strings.HasPrefix(name, prefix) {
+					candidates = append(candidates, name)
+				}
+			}
+			return candidates
+		},
+	}
+
+	expected := []struct {
+		line string
+		err  error
+	}{
+		{"abc", nil},
+		{"second", nil},
+		{"pu(1)", nil},
+		{"", errInterrupted},
+		{"one three", nil},
+		{"p", nil},
+		{"", io.EOF},
+	}
+	for i, tt := range expected {
+		line, err := e.readLine(PROMPT)
+		if line != tt.line || err != tt.err {
+			t.Errorf("lines[%d] wrong. want=%q (%v), got=%q (%v)", i, tt.line, tt.err, line, err)
+		}
+	}
+
+	if !strings.Contains(out.String(), "print  push  puts") {
+		t.Errorf("candidates not listed. got=%q", out.String())
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "first\nsecond\nabc\nsecond\npu(1)\none three\np\n" {
+		t.Errorf("wrong history file. got=%q", string(data))
+	}
+}
+
+func TestParserErrorCaret(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("let x = (1 + 2 3;\n"), &out)
+
+	expected := "\t1:16: expected \")\", got integer \"3\"\n" +
+		"\t    let x = (1 + 2 3;\n" +
+		"\t                   ^\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("parser error not shown with caret. want=%q, got=%q", expected, out.String())
+	}
+}
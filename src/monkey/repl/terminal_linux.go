@@ -0,0 +1,47 @@
+//go:build linux
+
+package repl
+
+import (
+   "syscall"
+   "unsafe"
+)
+
+func getTermios(fd int) (*syscall.Termios, error) {
+   termios := &syscall.Termios{}
+   _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCGETS, uintptr(unsafe.Pointer(termios)))
+   if errno != 0 {
+      return nil, errno
+   }
+   return termios, nil
+}
+
+func setTermios(fd int, termios *syscall.Termios) error {
+   _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCSETS, uintptr(unsafe.Pointer(termios)))
+   if errno != 0 {
+      return errno
+   }
+   return nil
+}
+
+func isTerminal(fd int) bool {
+   _, err := getTermios(fd)
+   return err == nil
+}
+
+// unbuffered input without echo, Ctrl-C and Ctrl-D are read as characters, output is still post-processed
+func enableRawMode(fd int) (restore func(), err error) {
+   old, err := getTermios(fd)
+   if err != nil {
+      return nil, err
+   }
+   raw := *old
+   raw.Iflag &^= syscall.ICRNL | syscall.IXON
+   raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+   raw.Cc[syscall.VMIN] = 1
+   raw.Cc[syscall.VTIME] = 0
+   if err := setTermios(fd, &raw); err != nil {
+      return nil, err
+   }
+   return func() { setTermios(fd, old) }, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package repl
+
+import (
+   "errors"
+)
+
+// line editing is only supported on Linux terminals, other platforms read plain lines
+
+func isTerminal(fd int) bool {
+   return false
+}
+
+func enableRawMode(fd int) (restore func(), err error) {
+   return nil, errors.New("raw mode not supported")
+}
@@ -2,6 +2,7 @@ package token
 
 import (
    "fmt"
+   "sort"
 )
 
 type TokenType string
@@ -10,16 +11,25 @@ type Token struct {
 	Type     TokenType
 	Literal  string
    Position SourcePosition
+   End      SourcePosition // just after the token, with quotes, escapes and flags of strings and regexes
 }
 
+/*
+ * Source position of a byte of the input:
+ *    ~ Line: 1-based line number
+ *    ~ Char: 1-based column, in bytes
+ *    ~ Offset: 0-based byte offset from the start of the input
+ */
 type SourcePosition struct {
-   Line int
-   Char int
+   Line   int
+   Char   int
+   Offset int
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+   COMMENT = "COMMENT" // only returned by Lexer.Comments
 
 	// Identifier
 	IDENT = "IDENT"
@@ -28,6 +38,7 @@ const (
 	INT = "INT"
    STRING = "STRING"
    BOOL = "BOOL"
+   REGEX = "REGEX"
 
 	// Operator
 	ASSIGN = "="
@@ -87,6 +98,16 @@ func LookupIdent(ident string) TokenType {
 	return IDENT
 }
 
+// keywords in alphabetical order
+func Keywords() []string {
+   names := make([]string, 0, len(keywords))
+   for name := range keywords {
+      names = append(names, name)
+   }
+   sort.Strings(names)
+   return names
+}
+
 func (tok Token) String() string {
    return fmt.Sprintf("token{type: %v, literal: %q}", tok.Type, tok.Literal)
 }